@@ -0,0 +1,157 @@
+package dmr
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/pd0mz/go-dmr/crc/quadres_16_7"
+)
+
+// Burst sources, used to select the SYNC pattern.
+const (
+	SourceBS     uint8 = iota // Base station sourced, repeater mode
+	SourceMS                  // Mobile station sourced, repeater mode
+	SourceDirect              // Mobile station sourced, TDMA direct mode
+)
+
+var syncPatternBytes = map[uint8][]byte{
+	SyncPatternBSSourcedVoice: bsSourcedVoice,
+	SyncPatternBSSourcedData:  bsSourcedData,
+	SyncPatternMSSourcedVoice: msSourcedVoice,
+	SyncPatternMSSourcedData:  msSourcedData,
+	SyncPatternMSSourcedRC:    msSourcedRC,
+	SyncPatternDirectVoiceTS1: directVoiceTS1,
+	SyncPatternDirectDataTS1:  directDataTS1,
+	SyncPatternDirectVoiceTS2: directVoiceTS2,
+	SyncPatternDirectDataTS2:  directDataTS2,
+}
+
+// SyncPatternFor returns the SYNC pattern for a voice or data burst
+// originating from source on the given timeslot.
+func SyncPatternFor(source uint8, voice bool, timeslot uint8) uint8 {
+	switch source {
+	case SourceBS:
+		if voice {
+			return SyncPatternBSSourcedVoice
+		}
+		return SyncPatternBSSourcedData
+	case SourceMS:
+		if voice {
+			return SyncPatternMSSourcedVoice
+		}
+		return SyncPatternMSSourcedData
+	case SourceDirect:
+		switch {
+		case voice && timeslot == 0:
+			return SyncPatternDirectVoiceTS1
+		case voice:
+			return SyncPatternDirectVoiceTS2
+		case timeslot == 0:
+			return SyncPatternDirectDataTS1
+		default:
+			return SyncPatternDirectDataTS2
+		}
+	default:
+		return SyncPatternUnknown
+	}
+}
+
+// SyncPatternBits returns the 48 bits of a SYNC pattern.
+func SyncPatternBits(pattern uint8) ([]byte, error) {
+	b, ok := syncPatternBytes[pattern]
+	if !ok {
+		return nil, fmt.Errorf("dmr/burst: unknown sync pattern %d", pattern)
+	}
+	return BytesToBits(b), nil
+}
+
+// Bits packs the embedded signalling, including the QR(16,7,6) parity.
+func (emb *EMB) Bits() []byte {
+	var bits = make([]byte, EMBBits)
+	bits[0] = (emb.ColorCode >> 3) & 0x01
+	bits[1] = (emb.ColorCode >> 2) & 0x01
+	bits[2] = (emb.ColorCode >> 1) & 0x01
+	bits[3] = emb.ColorCode & 0x01
+	// bits[4] is the privacy indicator, always 0
+	bits[5] = (emb.LCSS >> 1) & 0x01
+	bits[6] = emb.LCSS & 0x01
+	copy(bits[7:], quadres_16_7.ParityBits(bits[:7]))
+	return bits
+}
+
+// SetBits sets the burst bits and updates the packet data.
+func (p *Packet) SetBits(bits []byte) {
+	p.Bits = bits
+	p.Data = BitsToBytes(bits)
+}
+
+// SetInfoBits builds a data burst from the info bits, the slot type bits and
+// the SYNC pattern.
+func (p *Packet) SetInfoBits(info, slotType []byte, pattern uint8) error {
+	if len(info) != InfoBits {
+		return fmt.Errorf("dmr/burst: expected %d info bits, got %d", InfoBits, len(info))
+	}
+	if len(slotType) != SlotTypeBits {
+		return fmt.Errorf("dmr/burst: expected %d slot type bits, got %d", SlotTypeBits, len(slotType))
+	}
+	sync, err := SyncPatternBits(pattern)
+	if err != nil {
+		return err
+	}
+
+	var (
+		bits = make([]byte, PayloadBits)
+		o    = SyncOffsetBits + SyncBits
+	)
+	copy(bits[:InfoHalfBits], info[:InfoHalfBits])
+	copy(bits[InfoHalfBits:SyncOffsetBits], slotType[:SlotTypeHalfBits])
+	copy(bits[SyncOffsetBits:o], sync)
+	copy(bits[o:o+SlotTypeHalfBits], slotType[SlotTypeHalfBits:])
+	copy(bits[o+SlotTypeHalfBits:], info[InfoHalfBits:])
+	p.SetBits(bits)
+	return nil
+}
+
+// SetVoiceBits builds a voice burst from the voice bits and the SYNC pattern,
+// as used in voice burst A.
+func (p *Packet) SetVoiceBits(voice []byte, pattern uint8) error {
+	sync, err := SyncPatternBits(pattern)
+	if err != nil {
+		return err
+	}
+	return p.setVoiceBits(voice, sync)
+}
+
+// SetVoiceEmbeddedBits builds a voice burst from the voice bits, the embedded
+// signalling and an embedded signalling fragment, as used in voice bursts B
+// to F.
+func (p *Packet) SetVoiceEmbeddedBits(voice []byte, emb *EMB, fragment []byte) error {
+	if emb == nil {
+		return errors.New("dmr/burst: EMB can't be nil")
+	}
+	if len(fragment) != EMBSignallingLCFragmentBits {
+		return fmt.Errorf("dmr/burst: expected %d embedded signalling bits, got %d", EMBSignallingLCFragmentBits, len(fragment))
+	}
+
+	var (
+		sync = make([]byte, SyncBits)
+		e    = emb.Bits()
+	)
+	copy(sync[:EMBHalfBits], e[:EMBHalfBits])
+	copy(sync[EMBHalfBits:EMBHalfBits+EMBSignallingLCFragmentBits], fragment)
+	copy(sync[EMBHalfBits+EMBSignallingLCFragmentBits:], e[EMBHalfBits:])
+	return p.setVoiceBits(voice, sync)
+}
+
+func (p *Packet) setVoiceBits(voice, sync []byte) error {
+	if len(voice) != VoiceBits {
+		return fmt.Errorf("dmr/burst: expected %d voice bits, got %d", VoiceBits, len(voice))
+	}
+
+	var bits = make([]byte, PayloadBits)
+	copy(bits[:VoiceHalfBits], voice[:VoiceHalfBits])
+	copy(bits[VoiceHalfBits:VoiceHalfBits+SignalBits], sync)
+	copy(bits[VoiceHalfBits+SignalBits:], voice[VoiceHalfBits:])
+	p.SetBits(bits)
+	return nil
+}
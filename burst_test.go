@@ -0,0 +1,80 @@
+package dmr
+
+import (
+	"bytes"
+	"testing"
+)
+
+func testBits(n int) []byte {
+	var bits = make([]byte, n)
+	for i := range bits {
+		bits[i] = byte((i*7 + i/3) & 0x01)
+	}
+	return bits
+}
+
+func TestDataBurst(t *testing.T) {
+	var (
+		info     = testBits(InfoBits)
+		slotType = testBits(SlotTypeBits)
+		p        = &Packet{}
+	)
+	for _, ts := range []uint8{0, 1} {
+		pattern := SyncPatternFor(SourceDirect, false, ts)
+		if err := p.SetInfoBits(info, slotType, pattern); err != nil {
+			t.Fatalf("encode failed: %v", err)
+		}
+		if len(p.Data) != 33 {
+			t.Fatalf("encode failed: expected 33 bytes, got %d", len(p.Data))
+		}
+		if !bytes.Equal(p.InfoBits(), info) {
+			t.Fatal("decode failed: info bits mismatch")
+		}
+		if !bytes.Equal(p.SlotTypeBits(), slotType) {
+			t.Fatal("decode failed: slot type bits mismatch")
+		}
+		if test := SyncPattern(p.SyncBits()); test != pattern {
+			t.Fatalf("decode failed: expected %s, got %s", SyncPatternName[pattern], SyncPatternName[test])
+		}
+	}
+}
+
+func TestVoiceBurst(t *testing.T) {
+	var (
+		voice    = testBits(VoiceBits)
+		fragment = testBits(EMBSignallingLCFragmentBits)
+		p        = &Packet{}
+	)
+
+	if err := p.SetVoiceBits(voice, SyncPatternFor(SourceMS, true, 0)); err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	if !bytes.Equal(p.VoiceBits(), voice) {
+		t.Fatal("decode failed: voice bits mismatch")
+	}
+	if test := SyncPattern(p.SyncBits()); test != SyncPatternMSSourcedVoice {
+		t.Fatalf("decode failed: expected %s, got %s", SyncPatternName[SyncPatternMSSourcedVoice], SyncPatternName[test])
+	}
+
+	want := &EMB{ColorCode: 9, LCSS: Continuation}
+	if err := p.SetVoiceEmbeddedBits(voice, want, fragment); err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	if !bytes.Equal(p.VoiceBits(), voice) {
+		t.Fatal("decode failed: voice bits mismatch")
+	}
+	emb, err := ParseEMB(p.EMBBits())
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if emb.ColorCode != want.ColorCode || emb.LCSS != want.LCSS {
+		t.Fatalf("decode failed: expected %s, got %s", want, emb)
+	}
+	test, err := ParseEmbeddedSignallingLCFromSyncBits(p.SyncBits())
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if !bytes.Equal(test, fragment) {
+		t.Fatal("decode failed: embedded signalling fragment mismatch")
+	}
+}
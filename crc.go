@@ -1,5 +1,37 @@
 package dmr
 
+// G(x) = x^7+x^5+x^2+x+1
+func crc7(crc *uint8, b uint8, bits int) {
+	var v uint8 = 0x80
+	for i := 0; i < 8-bits; i++ {
+		v >>= 1
+	}
+	for i := 0; i < bits; i++ {
+		xor := (*crc)&0x40 > 0
+		(*crc) <<= 1
+		// Limit the number of shift registers to 7.
+		*crc &= 0x7f
+		if b&v > 0 {
+			(*crc)++
+		}
+		if xor {
+			(*crc) ^= 0x27
+		}
+		v >>= 1
+	}
+}
+
+func crc7end(crc *uint8) {
+	for i := 0; i < 7; i++ {
+		xor := (*crc)&0x40 > 0
+		(*crc) <<= 1
+		*crc &= 0x7f
+		if xor {
+			(*crc) ^= 0x27
+		}
+	}
+}
+
 // G(x) = x^9+x^6+x^4+x^3+1
 func crc9(crc *uint16, b uint8, bits int) {
 	var v uint8 = 0x80
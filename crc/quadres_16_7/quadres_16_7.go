@@ -48,7 +48,7 @@ func Check(bits []byte) bool {
 	var dataval uint8
 	for col := uint8(0); col < 7; col++ {
 		if codeword.Data[col] == 1 {
-			dataval |= (1 << (7 - col))
+			dataval |= (1 << (6 - col))
 		}
 	}
 
@@ -68,6 +68,6 @@ func toBits(b byte) []byte {
 func init() {
 	for i := byte(0); i < 128; i++ {
 		bits := toBits(i)
-		validDataParities[i] = ParityBits(bits)
+		validDataParities[i] = ParityBits(bits[1:])
 	}
 }
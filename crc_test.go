@@ -2,6 +2,25 @@ package dmr
 
 import "testing"
 
+func TestCRC7(t *testing.T) {
+	tests := map[uint8][]byte{
+		0x00: []byte{},
+		0x27: []byte{0x00, 0x01},
+		0x46: []byte("hello world"),
+	}
+
+	for want, test := range tests {
+		var crc uint8
+		for _, b := range test {
+			crc7(&crc, b, 8)
+		}
+		crc7end(&crc)
+		if crc != want {
+			t.Fatalf("crc7 %v failed: %#02x != %#02x", test, crc, want)
+		}
+	}
+}
+
 func TestCRC9(t *testing.T) {
 	tests := map[uint16][]byte{
 		0x0000: []byte{},
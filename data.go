@@ -19,7 +19,7 @@ const (
 var crc9Masks = map[uint8]uint16{
 	Rate12Data: 0x00f0,
 	Rate34Data: 0x01ff,
-	//Rate1Data: 0x010f,
+	Rate1Data:  0x010f,
 }
 
 func calculateCRC9(serial uint8, data []byte, dataType uint8) (crc uint16) {
@@ -63,9 +63,10 @@ func ParseDataBlock(data []byte, dataType uint8, confirmed bool) (*DataBlock, er
 
 		crc = calculateCRC9(db.Serial, db.Data, dataType)
 
-		// FIXME(pd0mz): this is not working
+		// The block is returned along with the error, so the serial can be
+		// used to request retransmission.
 		if crc != db.CRC {
-			return nil, fmt.Errorf("dmr: block CRC error (%#04x != %#04x)", crc, db.CRC)
+			return db, fmt.Errorf("dmr: block CRC error (%#04x != %#04x)", crc, db.CRC)
 		}
 	} else {
 		db.Data = make([]byte, db.Length)
@@ -102,7 +103,7 @@ func dataBlockLength(dataType uint8, confirmed bool) uint8 {
 	var size uint8
 
 	switch dataType {
-	case Data:
+	case Rate1Data:
 		size = 22
 		break
 	case Rate12Data:
@@ -121,6 +122,32 @@ func dataBlockLength(dataType uint8, confirmed bool) uint8 {
 	return size
 }
 
+// Rate1Bytes extracts the 24 bytes of rate 1 (uncoded) data from the 196 info
+// bits, bits 96 to 99 are reserved.
+func Rate1Bytes(bits []byte) ([]byte, error) {
+	if len(bits) != InfoBits {
+		return nil, fmt.Errorf("dmr: expected %d rate 1 info bits, got %d", InfoBits, len(bits))
+	}
+	var data = make([]byte, 0, 192)
+	data = append(data, bits[:96]...)
+	data = append(data, bits[100:]...)
+	return BitsToBytes(data), nil
+}
+
+// Rate1Bits packs 24 bytes of rate 1 (uncoded) data to 196 info bits.
+func Rate1Bits(data []byte) ([]byte, error) {
+	if len(data) != 24 {
+		return nil, fmt.Errorf("dmr: expected 24 rate 1 data bytes, got %d", len(data))
+	}
+	var (
+		bits = make([]byte, InfoBits)
+		b    = BytesToBits(data)
+	)
+	copy(bits[:96], b[:96])
+	copy(bits[100:], b[96:])
+	return bits, nil
+}
+
 type DataFragment struct {
 	Data   []byte
 	Stored int
@@ -144,6 +171,7 @@ func (df *DataFragment) DataBlocks(dataType uint8, confirm bool) ([]*DataBlock,
 	}
 
 	// Calculate fragment CRC32
+	df.CRC = 0
 	for i := 0; i < (df.Needed*size)-4; i += 2 {
 		if i+1 < df.Stored {
 			crc32(&df.CRC, df.Data[i+1])
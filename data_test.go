@@ -28,6 +28,32 @@ func TestDataBlock(t *testing.T) {
 	// Decoding is tested in the DataFragment test
 }
 
+func TestDataBlockCRCError(t *testing.T) {
+	want := &DataBlock{
+		Serial: 42,
+		Data:   make([]byte, dataBlockLength(Rate12Data, true)),
+		Length: dataBlockLength(Rate12Data, true),
+	}
+
+	data := want.Bytes(Rate12Data, true)
+	data[5] ^= 0x01
+
+	// The block is returned, so the serial can be used in a selective ACK
+	test, err := ParseDataBlock(data, Rate12Data, true)
+	if err == nil {
+		t.Fatal("decode failed: expected CRC error")
+	}
+	if test == nil {
+		t.Fatal("decode failed: expected block with CRC error")
+	}
+	if test.OK {
+		t.Fatal("decode failed: block with CRC error is OK")
+	}
+	if test.Serial != want.Serial {
+		t.Fatalf("decode failed: expected serial %d, got %d", want.Serial, test.Serial)
+	}
+}
+
 func TestDataFragment(t *testing.T) {
 	msg, err := BuildMessageData("CQCQCQ PD0MZ", DDFormatUTF16, true)
 	if err != nil {
@@ -62,6 +88,46 @@ func TestDataFragment(t *testing.T) {
 	}
 }
 
+func TestDataFragmentRate1(t *testing.T) {
+	msg, err := BuildMessageData("CQCQCQ PD0MZ, this is a rate 1 data test", DDFormatUTF16, true)
+	if err != nil {
+		t.Fatalf("build message failed: %v", err)
+	}
+
+	for _, confirmed := range []bool{false, true} {
+		want := &DataFragment{Data: msg}
+		blocks, err := want.DataBlocks(Rate1Data, confirmed)
+		if err != nil {
+			t.Fatalf("encode failed: %v", err)
+		}
+
+		var parsed = make([]*DataBlock, len(blocks))
+		for i, block := range blocks {
+			bits, err := Rate1Bits(block.Bytes(Rate1Data, confirmed))
+			if err != nil {
+				t.Fatalf("encode failed: %v", err)
+			}
+			data, err := Rate1Bytes(bits)
+			if err != nil {
+				t.Fatalf("decode failed: %v", err)
+			}
+			if parsed[i], err = ParseDataBlock(data, Rate1Data, confirmed); err != nil {
+				t.Fatalf("decode failed: %v", err)
+			}
+		}
+
+		test, err := CombineDataBlocks(parsed)
+		if err != nil {
+			t.Fatalf("decode failed: %v", err)
+		}
+		if !bytes.Equal(test.Data[:len(want.Data)], want.Data) {
+			t.Log(fmt.Sprintf("want:\n%s", hex.Dump(want.Data)))
+			t.Log(fmt.Sprintf("got:\n%s", hex.Dump(test.Data)))
+			t.Fatal("decode failed: data is wrong")
+		}
+	}
+}
+
 func TestMessage(t *testing.T) {
 	msg := "CQCQCQ PD0MZ"
 
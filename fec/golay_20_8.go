@@ -24,10 +24,67 @@ func Golay_20_8_Check(bits []byte) error {
 		return fmt.Errorf("fec/golay_20_8: expected 20 bits, got %d", len(bits))
 	}
 	parity := Golay_20_8_Parity(bits[:8])
-	for i := 0; i < 20; i++ {
+	for i := 0; i < 12; i++ {
 		if parity[i] != bits[8+i] {
 			return fmt.Errorf("fec/golay_20_8: parity error at bit %d: %v != %v", i, parity, bits[8:])
 		}
 	}
 	return nil
 }
+
+// golay_20_8_codewords contains all valid Golay(20, 8, 7) codewords.
+var golay_20_8_codewords [256]uint32
+
+// Golay_20_8_Correct corrects up to 3 bit errors in the 20 bits, by finding
+// the nearest valid codeword. It returns the number of corrected bits.
+func Golay_20_8_Correct(bits []byte) (int, error) {
+	if len(bits) != 20 {
+		return 0, fmt.Errorf("fec/golay_20_8: expected 20 bits, got %d", len(bits))
+	}
+
+	var word uint32
+	for _, b := range bits {
+		word = word<<1 | uint32(b&0x01)
+	}
+
+	var (
+		best     uint32
+		distance = 21
+	)
+	for _, codeword := range golay_20_8_codewords {
+		if d := popcount(word ^ codeword); d < distance {
+			best, distance = codeword, d
+		}
+	}
+	if distance > 3 {
+		return 0, fmt.Errorf("fec/golay_20_8: uncorrectable, %d bit errors", distance)
+	}
+
+	for i := range bits {
+		bits[i] = byte(best>>uint(19-i)) & 0x01
+	}
+	return distance, nil
+}
+
+func popcount(v uint32) int {
+	var n int
+	for ; v != 0; v &= v - 1 {
+		n++
+	}
+	return n
+}
+
+func init() {
+	var bits = make([]byte, 8)
+	for i := range golay_20_8_codewords {
+		for j := range bits {
+			bits[j] = byte(i>>uint(7-j)) & 0x01
+		}
+
+		var word = uint32(i)
+		for _, p := range Golay_20_8_Parity(bits) {
+			word = word<<1 | uint32(p)
+		}
+		golay_20_8_codewords[i] = word
+	}
+}
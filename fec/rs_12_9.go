@@ -51,7 +51,7 @@ var (
 		31, 45, 67, 216, 183, 123, 164, 118, 196, 23, 73, 236, 127, 12, 111, 246,
 		108, 161, 59, 82, 41, 157, 85, 170, 251, 96, 134, 177, 187, 204, 62, 90,
 		203, 89, 95, 176, 156, 169, 160, 81, 11, 245, 22, 235, 122, 117, 44, 215,
-		79, 174, 213, 233, 230, 231, 173, 232, 116, 214, 244, 234, 168, 80, 88, 175
+		79, 174, 213, 233, 230, 231, 173, 232, 116, 214, 244, 234, 168, 80, 88, 175,
 	}
 )
 
@@ -63,7 +63,7 @@ func RS_12_9_Galois_Mul(a, b uint8) uint8 {
 	if a == 0 || b == 0 {
 		return 0
 	}
-	return rs_12_9_galois_exp_table[(rs_12_9_galois_log_table[a]+rs_12_9_galois_log_table[b])%255]
+	return rs_12_9_galois_exp_table[(int(rs_12_9_galois_log_table[a])+int(rs_12_9_galois_log_table[b]))%255]
 }
 
 // Multiply by z (shift right by 1).
@@ -267,12 +267,12 @@ func RS_12_9_Correct(data []byte, syndrome *RS_12_9_Poly) (int, error) {
 			var num, denom uint8
 			// Evaluate rs_12_9_error_evaluator_poly at alpha^(-i)
 			for j = 0; j < RS_12_9_POLY_MAXDEG; j++ {
-				num ^= RS_12_9_Galois_Mul(evaluator[j], rs_12_9_galois_exp_table[((255-i)*j)%255])
+				num ^= RS_12_9_Galois_Mul(evaluator[j], rs_12_9_galois_exp_table[((255-int(i))*int(j))%255])
 			}
 
 			// Evaluate rs_12_9_error_evaluator_poly' (derivative) at alpha^(-i). All odd powers disappear.
 			for j = 1; j < RS_12_9_POLY_MAXDEG; j += 2 {
-				denom ^= RS_12_9_Galois_Mul(locator[j], rs_12_9_galois_exp_table[((255-i)*(j-1))%255])
+				denom ^= RS_12_9_Galois_Mul(locator[j], rs_12_9_galois_exp_table[((255-int(i))*int(j-1))%255])
 			}
 
 			data[len(data)-int(i)-1] ^= RS_12_9_Galois_Mul(num, RS_12_9_Galois_Inv(denom))
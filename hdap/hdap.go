@@ -0,0 +1,154 @@
+// Package hdap implements the Hytera Data Application Protocol.
+//
+// HDAP messages are carried over UDP between radios and applications, each
+// service (registration, location, text messages, ...) has its own port. The
+// connection between an application and a radio connected over USB or
+// Ethernet is framed with the Hytera Radio Network Protocol (HRNP).
+package hdap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+)
+
+// Services, the service is the message header octet.
+const (
+	ServiceRCP uint8 = 0x02 // Radio control protocol
+	ServiceLP  uint8 = 0x08 // Location protocol
+	ServiceTMP uint8 = 0x09 // Text message protocol
+	ServiceRRS uint8 = 0x11 // Radio registration service
+	ServiceTP  uint8 = 0x12 // Telemetry protocol
+	ServiceDTP uint8 = 0x13 // Data transfer protocol
+	ServiceDDS uint8 = 0x14 // Data delivery service
+)
+
+var ServiceName = map[uint8]string{
+	ServiceRCP: "radio control",
+	ServiceLP:  "location",
+	ServiceTMP: "text message",
+	ServiceRRS: "radio registration",
+	ServiceTP:  "telemetry",
+	ServiceDTP: "data transfer",
+	ServiceDDS: "data delivery",
+}
+
+// UDP ports of the services, text messages use sms.HyteraPort.
+const (
+	RRSPort = 3002
+	LPPort  = 3003
+)
+
+const (
+	// Reliable is set in the header if reliable delivery is requested.
+	Reliable uint8 = 0x80
+
+	// End terminates every message.
+	End uint8 = 0x03
+)
+
+// Network is the first octet of the IP addresses Hytera radios use, the other
+// octets contain the radio ID.
+var Network uint8 = 10
+
+// PDU is a HDAP message. The layout is:
+//
+//	header (1 octet, service and reliable flag)
+//	opcode (2 octets, big endian)
+//	payload length (2 octets, big endian)
+//	payload
+//	checksum (1 octet)
+//	end (1 octet)
+type PDU struct {
+	Service  uint8
+	Reliable bool
+	Opcode   uint16
+	Payload  []byte
+}
+
+func (p *PDU) String() string {
+	return fmt.Sprintf("HDAP %s (%#02x), reliable %t, opcode %#04x, %d bytes payload",
+		ServiceName[p.Service], p.Service, p.Reliable, p.Opcode, len(p.Payload))
+}
+
+// Parse parses a HDAP message from the UDP payload, trailing bytes are ignored.
+func Parse(data []byte) (*PDU, error) {
+	if len(data) < 7 {
+		return nil, fmt.Errorf("hdap: expected at least 7 bytes, got %d", len(data))
+	}
+
+	var size = int(binary.BigEndian.Uint16(data[3:]))
+	if 5+size+2 > len(data) {
+		return nil, fmt.Errorf("hdap: payload length %d exceeds %d bytes", size, len(data)-7)
+	}
+	if data[5+size+1] != End {
+		return nil, fmt.Errorf("hdap: unexpected end %#02x", data[5+size+1])
+	}
+	if sum := checksum(data[1 : 5+size]); sum != data[5+size] {
+		return nil, fmt.Errorf("hdap: checksum error (%#02x != %#02x)", sum, data[5+size])
+	}
+
+	return &PDU{
+		Service:  data[0] &^ Reliable,
+		Reliable: data[0]&Reliable > 0,
+		Opcode:   binary.BigEndian.Uint16(data[1:]),
+		Payload:  data[5 : 5+size],
+	}, nil
+}
+
+// Bytes packs the message as UDP payload.
+func (p *PDU) Bytes() ([]byte, error) {
+	if len(p.Payload) > 0xffff {
+		return nil, fmt.Errorf("hdap: payload of %d bytes too long", len(p.Payload))
+	}
+
+	var data = make([]byte, 5, 5+len(p.Payload)+2)
+	data[0] = p.Service
+	if p.Reliable {
+		data[0] |= Reliable
+	}
+	binary.BigEndian.PutUint16(data[1:], p.Opcode)
+	binary.BigEndian.PutUint16(data[3:], uint16(len(p.Payload)))
+	data = append(data, p.Payload...)
+	data = append(data, checksum(data[1:]), End)
+	return data, nil
+}
+
+// parseService parses a HDAP message and checks the service.
+func parseService(data []byte, service uint8, size int) (*PDU, error) {
+	p, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	if p.Service != service {
+		return nil, fmt.Errorf("hdap: expected %s service, got %#02x", ServiceName[service], p.Service)
+	}
+	if len(p.Payload) < size {
+		return nil, fmt.Errorf("hdap: expected at least %d bytes payload, got %d", size, len(p.Payload))
+	}
+	return p, nil
+}
+
+// RadioIP returns the IP address of a radio.
+func RadioIP(id uint32) net.IP {
+	return net.IPv4(Network, uint8(id>>16), uint8(id>>8), uint8(id)).To4()
+}
+
+// radioID returns the radio ID of an address as found in payloads.
+func radioID(data []byte) uint32 {
+	return binary.BigEndian.Uint32(data) & 0x00ffffff
+}
+
+// putRadioID stores the address of a radio as found in payloads.
+func putRadioID(data []byte, id uint32) {
+	binary.BigEndian.PutUint32(data, uint32(Network)<<24|id&0x00ffffff)
+}
+
+// checksum calculates the checksum over the opcode, length and payload.
+func checksum(data []byte) uint8 {
+	var sum uint8
+	for _, b := range data {
+		sum += b
+	}
+	return ^sum + 0x33
+}
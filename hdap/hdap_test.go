@@ -0,0 +1,150 @@
+package hdap
+
+import (
+	"bytes"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestPDU(t *testing.T) {
+	want := &PDU{
+		Service:  ServiceTMP,
+		Reliable: true,
+		Opcode:   0x00a1,
+		Payload:  []byte{0x01, 0x02, 0x03},
+	}
+
+	data, err := want.Bytes()
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	if data[0] != 0x89 || data[len(data)-1] != End {
+		t.Fatalf("encode failed: got %x", data)
+	}
+
+	test, err := Parse(data)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if test.Service != want.Service || test.Reliable != want.Reliable || test.Opcode != want.Opcode || !bytes.Equal(test.Payload, want.Payload) {
+		t.Fatalf("decode failed: expected %s, got %s", want, test)
+	}
+
+	data[5] ^= 0x01
+	if _, err = Parse(data); err == nil {
+		t.Fatal("decode failed: expected checksum error")
+	}
+}
+
+func TestRegistration(t *testing.T) {
+	data, err := (&Registration{Opcode: RRSRegistration, RadioID: 2042214}).Bytes()
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	r, err := ParseRegistration(data)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if r.Opcode != RRSRegistration || r.RadioID != 2042214 {
+		t.Fatalf("decode failed: got %s", r)
+	}
+
+	if data, err = r.Answer().Bytes(); err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	if r, err = ParseRegistration(data); err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if r.Opcode != RRSRegistrationAnswer || r.RadioID != 2042214 || r.Result != RRSResultSuccess || r.Validity != DefaultRegistrationValidity {
+		t.Fatalf("decode failed: got %s", r)
+	}
+
+	// Location messages are not registrations
+	if data, err = (&Location{Opcode: LPImmediateRequest}).Bytes(); err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	if _, err = ParseRegistration(data); err == nil {
+		t.Fatal("decode failed: expected service error")
+	}
+}
+
+func TestLocation(t *testing.T) {
+	var tests = []*Location{
+		{Opcode: LPImmediateRequest, RequestID: 1, RadioID: 2042214},
+		{Opcode: LPTriggeredRequest, RequestID: 2, RadioID: 2042214, Interval: time.Minute},
+		{
+			Opcode:    LPImmediateReport,
+			RequestID: 1,
+			RadioID:   2042214,
+			GPS: &GPS{
+				Time:      time.Date(2016, 3, 20, 13, 37, 42, 0, time.UTC),
+				Valid:     true,
+				Latitude:  52.379189,
+				Longitude: 4.899431,
+				Speed:     18.52,
+				Direction: 270,
+			},
+		},
+		{
+			Opcode:        LPEmergencyReport,
+			RadioID:       2042214,
+			EmergencyType: 1,
+			GPS:           &GPS{Latitude: -33.856784, Longitude: -70.651367},
+		},
+	}
+
+	for _, want := range tests {
+		data, err := want.Bytes()
+		if err != nil {
+			t.Fatalf("encode failed: %v", err)
+		}
+		test, err := ParseLocation(data)
+		if err != nil {
+			t.Fatalf("decode failed: %v", err)
+		}
+		if test.Opcode != want.Opcode || test.RequestID != want.RequestID || test.RadioID != want.RadioID ||
+			test.EmergencyType != want.EmergencyType || test.Interval != want.Interval || test.Result != want.Result {
+			t.Fatalf("decode failed: expected %s, got %s", want, test)
+		}
+		if want.GPS == nil {
+			if test.GPS != nil {
+				t.Fatalf("decode failed: expected no GPS data, got %s", test)
+			}
+			continue
+		}
+		if test.GPS == nil || !test.GPS.Time.Equal(want.GPS.Time) || test.GPS.Valid != want.GPS.Valid ||
+			test.GPS.Speed != want.GPS.Speed || test.GPS.Direction != want.GPS.Direction {
+			t.Fatalf("decode failed: expected %s, got %s", want, test)
+		}
+		// Minutes have 4 decimals
+		if math.Abs(test.GPS.Latitude-want.GPS.Latitude) > 1e-5 || math.Abs(test.GPS.Longitude-want.GPS.Longitude) > 1e-5 {
+			t.Fatalf("decode failed: expected %s, got %s", want.GPS, test.GPS)
+		}
+	}
+}
+
+func TestFrame(t *testing.T) {
+	data, err := (&Registration{Opcode: RRSRegistration, RadioID: 1}).Bytes()
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+
+	want := &Frame{Opcode: HRNPData, Source: 0x20, Dest: 0x10, Sequence: 42, Data: data}
+	if data, err = want.Bytes(); err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	test, err := ParseFrame(data)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if test.Opcode != want.Opcode || test.Source != want.Source || test.Dest != want.Dest ||
+		test.Sequence != want.Sequence || !bytes.Equal(test.Data, want.Data) {
+		t.Fatalf("decode failed: expected %s, got %s", want, test)
+	}
+
+	data[HRNPHeaderSize] ^= 0x01
+	if _, err = ParseFrame(data); err == nil {
+		t.Fatal("decode failed: expected checksum error")
+	}
+}
@@ -0,0 +1,140 @@
+package hdap
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// HRNP header fields.
+const (
+	HRNPHeader  uint8 = 0x7e
+	HRNPVersion uint8 = 0x04
+)
+
+// HRNP opcodes.
+const (
+	HRNPData     uint8 = 0x00
+	HRNPDataAck  uint8 = 0x10
+	HRNPCloseAck uint8 = 0xfa
+	HRNPClose    uint8 = 0xfb
+	HRNPReject   uint8 = 0xfc
+	HRNPAccept   uint8 = 0xfd
+	HRNPConnect  uint8 = 0xfe
+)
+
+var HRNPOpcodeName = map[uint8]string{
+	HRNPData:     "data",
+	HRNPDataAck:  "data ack",
+	HRNPCloseAck: "close ack",
+	HRNPClose:    "close",
+	HRNPReject:   "reject",
+	HRNPAccept:   "accept",
+	HRNPConnect:  "connect",
+}
+
+// HRNPHeaderSize is the size of the HRNP header.
+const HRNPHeaderSize = 12
+
+// Frame is a HRNP frame, data frames carry HDAP messages. The layout is:
+//
+//	header (1 octet)
+//	version (1 octet)
+//	block (1 octet)
+//	opcode (1 octet)
+//	source ID (1 octet)
+//	destination ID (1 octet)
+//	packet number (2 octets)
+//	length (2 octets, including the header)
+//	checksum (2 octets)
+//	data
+type Frame struct {
+	Opcode   uint8
+	Source   uint8
+	Dest     uint8
+	Sequence uint16
+	Data     []byte
+}
+
+func (f *Frame) String() string {
+	return fmt.Sprintf("HRNP %s (%#02x), %d->%d, sequence %d, %d bytes data",
+		HRNPOpcodeName[f.Opcode], f.Opcode, f.Source, f.Dest, f.Sequence, len(f.Data))
+}
+
+// Ack builds the acknowledgement for a data frame.
+func (f *Frame) Ack() *Frame {
+	return &Frame{
+		Opcode:   HRNPDataAck,
+		Source:   f.Dest,
+		Dest:     f.Source,
+		Sequence: f.Sequence,
+	}
+}
+
+// ParseFrame parses a HRNP frame.
+func ParseFrame(data []byte) (*Frame, error) {
+	if len(data) < HRNPHeaderSize {
+		return nil, fmt.Errorf("hdap/hrnp: expected at least %d bytes, got %d", HRNPHeaderSize, len(data))
+	}
+	if data[0] != HRNPHeader {
+		return nil, fmt.Errorf("hdap/hrnp: unexpected header %#02x", data[0])
+	}
+	if data[1] != HRNPVersion {
+		return nil, fmt.Errorf("hdap/hrnp: unsupported version %#02x", data[1])
+	}
+
+	var size = int(binary.BigEndian.Uint16(data[8:]))
+	if size < HRNPHeaderSize || size > len(data) {
+		return nil, fmt.Errorf("hdap/hrnp: invalid length %d, got %d bytes", size, len(data))
+	}
+	data = data[:size]
+	if sum := hrnpChecksum(data); sum != binary.BigEndian.Uint16(data[10:]) {
+		return nil, fmt.Errorf("hdap/hrnp: checksum error (%#04x != %#04x)", sum, binary.BigEndian.Uint16(data[10:]))
+	}
+
+	return &Frame{
+		Opcode:   data[3],
+		Source:   data[4],
+		Dest:     data[5],
+		Sequence: binary.BigEndian.Uint16(data[6:]),
+		Data:     data[HRNPHeaderSize:],
+	}, nil
+}
+
+// Bytes packs the frame.
+func (f *Frame) Bytes() ([]byte, error) {
+	if HRNPHeaderSize+len(f.Data) > 0xffff {
+		return nil, fmt.Errorf("hdap/hrnp: data of %d bytes too long", len(f.Data))
+	}
+
+	var data = make([]byte, HRNPHeaderSize, HRNPHeaderSize+len(f.Data))
+	data[0] = HRNPHeader
+	data[1] = HRNPVersion
+	data[3] = f.Opcode
+	data[4] = f.Source
+	data[5] = f.Dest
+	binary.BigEndian.PutUint16(data[6:], f.Sequence)
+	binary.BigEndian.PutUint16(data[8:], uint16(HRNPHeaderSize+len(f.Data)))
+	data = append(data, f.Data...)
+	binary.BigEndian.PutUint16(data[10:], hrnpChecksum(data))
+	return data, nil
+}
+
+// hrnpChecksum is the one's complement of the one's complement sum of all
+// 16-bit words in the frame, excluding the checksum field.
+func hrnpChecksum(data []byte) uint16 {
+	var sum uint32
+	for i := 0; i < len(data); i += 2 {
+		if i == 10 {
+			continue
+		}
+		if i+1 < len(data) {
+			sum += uint32(data[i])<<8 | uint32(data[i+1])
+		} else {
+			sum += uint32(data[i]) << 8
+		}
+	}
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+	return ^uint16(sum)
+}
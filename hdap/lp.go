@@ -0,0 +1,310 @@
+package hdap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Location protocol opcodes.
+const (
+	LPImmediateRequest     uint16 = 0xa001
+	LPImmediateReport      uint16 = 0xa002
+	LPEmergencyReport      uint16 = 0xb001
+	LPTriggeredRequest     uint16 = 0xc001
+	LPTriggeredAnswer      uint16 = 0xc002
+	LPTriggeredReport      uint16 = 0xc003
+	LPTriggeredStopRequest uint16 = 0xc004
+	LPTriggeredStopAnswer  uint16 = 0xc005
+)
+
+var LPOpcodeName = map[uint16]string{
+	LPImmediateRequest:     "immediate location request",
+	LPImmediateReport:      "immediate location report",
+	LPEmergencyReport:      "emergency location report",
+	LPTriggeredRequest:     "triggered location request",
+	LPTriggeredAnswer:      "triggered location answer",
+	LPTriggeredReport:      "triggered location report",
+	LPTriggeredStopRequest: "triggered location stop request",
+	LPTriggeredStopAnswer:  "triggered location stop answer",
+}
+
+// Location protocol results.
+const (
+	LPResultSuccess     uint16 = 0x0000
+	LPResultNoPosition  uint16 = 0x0006
+	LPResultUnsupported uint16 = 0x000c
+)
+
+// GPSDataSize is the size of the GPS data in location reports.
+const GPSDataSize = 40
+
+// knots is the speed of one knot in km/h.
+const knots = 1.852
+
+// GPS is a position fix in a location report. The GPS data is ASCII in the
+// NMEA format:
+//
+//	time (6 octets, hhmmss UTC)
+//	date (6 octets, ddmmyy)
+//	status (1 octet, A is valid, V is invalid)
+//	latitude hemisphere (1 octet, N or S)
+//	latitude (9 octets, ddmm.mmmm)
+//	longitude hemisphere (1 octet, E or W)
+//	longitude (10 octets, dddmm.mmmm)
+//	speed (3 octets, knots)
+//	direction (3 octets, degrees)
+type GPS struct {
+	Time      time.Time
+	Valid     bool
+	Latitude  float64 // Degrees, positive is north
+	Longitude float64 // Degrees, positive is east
+	Speed     float64 // km/h
+	Direction uint16  // Degrees
+}
+
+func (g *GPS) String() string {
+	return fmt.Sprintf("%f,%f, valid %t, time %s, speed %.1fkm/h, direction %d",
+		g.Latitude, g.Longitude, g.Valid, g.Time.Format(time.RFC3339), g.Speed, g.Direction)
+}
+
+// Location is a location protocol message. The payload layout is:
+//
+//	request ID (4 octets, all but emergency reports)
+//	radio IP address (4 octets)
+//	emergency type (1 octet, emergency reports only)
+//	interval in seconds (4 octets, triggered requests only)
+//	result (2 octets, reports and answers only)
+//	GPS data (40 octets, reports only)
+type Location struct {
+	Opcode        uint16
+	RequestID     uint32
+	RadioID       uint32
+	EmergencyType uint8
+	Interval      time.Duration
+	Result        uint16
+	GPS           *GPS // Nil if not a report
+}
+
+func (l *Location) String() string {
+	var s = fmt.Sprintf("LP %s, request %d, radio %d", LPOpcodeName[l.Opcode], l.RequestID, l.RadioID)
+	switch l.Opcode {
+	case LPEmergencyReport:
+		s += fmt.Sprintf(", emergency type %d", l.EmergencyType)
+	case LPTriggeredRequest:
+		s += fmt.Sprintf(", interval %s", l.Interval)
+	}
+	if lpHasResult(l.Opcode) {
+		s += fmt.Sprintf(", result %d", l.Result)
+	}
+	if l.GPS != nil {
+		s += ", position " + l.GPS.String()
+	}
+	return s
+}
+
+func lpHasResult(opcode uint16) bool {
+	switch opcode {
+	case LPImmediateReport, LPTriggeredAnswer, LPTriggeredReport, LPTriggeredStopAnswer:
+		return true
+	default:
+		return false
+	}
+}
+
+func lpIsReport(opcode uint16) bool {
+	switch opcode {
+	case LPImmediateReport, LPEmergencyReport, LPTriggeredReport:
+		return true
+	default:
+		return false
+	}
+}
+
+// ParseLocation parses a location protocol message from the UDP payload.
+func ParseLocation(data []byte) (*Location, error) {
+	p, err := parseService(data, ServiceLP, 4)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Location{Opcode: p.Opcode}
+	if _, ok := LPOpcodeName[l.Opcode]; !ok {
+		return nil, fmt.Errorf("hdap: unsupported LP opcode %#04x", l.Opcode)
+	}
+
+	var (
+		payload = p.Payload
+		size    = 8
+	)
+	switch l.Opcode {
+	case LPEmergencyReport:
+		size = 5
+	case LPTriggeredRequest:
+		size += 4
+	}
+	if lpHasResult(l.Opcode) {
+		size += 2
+	}
+	if lpIsReport(l.Opcode) {
+		size += GPSDataSize
+	}
+	if len(payload) < size {
+		return nil, fmt.Errorf("hdap: expected %d bytes %s payload, got %d", size, LPOpcodeName[l.Opcode], len(payload))
+	}
+
+	if l.Opcode == LPEmergencyReport {
+		l.RadioID = radioID(payload)
+		l.EmergencyType = payload[4]
+		payload = payload[5:]
+	} else {
+		l.RequestID = binary.BigEndian.Uint32(payload)
+		l.RadioID = radioID(payload[4:])
+		payload = payload[8:]
+	}
+	if l.Opcode == LPTriggeredRequest {
+		l.Interval = time.Duration(binary.BigEndian.Uint32(payload)) * time.Second
+		payload = payload[4:]
+	}
+	if lpHasResult(l.Opcode) {
+		l.Result = binary.BigEndian.Uint16(payload)
+		payload = payload[2:]
+	}
+	if lpIsReport(l.Opcode) {
+		if l.GPS, err = parseGPS(payload[:GPSDataSize]); err != nil {
+			return nil, err
+		}
+	}
+
+	return l, nil
+}
+
+// Bytes packs the message as UDP payload.
+func (l *Location) Bytes() ([]byte, error) {
+	if _, ok := LPOpcodeName[l.Opcode]; !ok {
+		return nil, fmt.Errorf("hdap: unsupported LP opcode %#04x", l.Opcode)
+	}
+
+	var payload []byte
+	if l.Opcode == LPEmergencyReport {
+		payload = make([]byte, 5)
+		putRadioID(payload, l.RadioID)
+		payload[4] = l.EmergencyType
+	} else {
+		payload = make([]byte, 8)
+		binary.BigEndian.PutUint32(payload, l.RequestID)
+		putRadioID(payload[4:], l.RadioID)
+	}
+	if l.Opcode == LPTriggeredRequest {
+		payload = append(payload, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(payload[len(payload)-4:], uint32(l.Interval/time.Second))
+	}
+	if lpHasResult(l.Opcode) {
+		payload = append(payload, uint8(l.Result>>8), uint8(l.Result))
+	}
+	if lpIsReport(l.Opcode) {
+		if l.GPS == nil {
+			return nil, fmt.Errorf("hdap: %s without GPS data", LPOpcodeName[l.Opcode])
+		}
+		payload = append(payload, l.GPS.bytes()...)
+	}
+
+	p := &PDU{Service: ServiceLP, Opcode: l.Opcode, Payload: payload}
+	return p.Bytes()
+}
+
+func parseGPS(data []byte) (*GPS, error) {
+	var (
+		s   = string(data)
+		g   = &GPS{Valid: s[12] == 'A'}
+		err error
+	)
+
+	if s[:12] != "000000000000" {
+		if g.Time, err = time.Parse("150405020106", s[:12]); err != nil {
+			return nil, fmt.Errorf("hdap: invalid GPS time %q", s[:12])
+		}
+	}
+	if g.Latitude, err = parseCoordinate(s[14:23], 2); err != nil {
+		return nil, err
+	}
+	if s[13] == 'S' {
+		g.Latitude = -g.Latitude
+	}
+	if g.Longitude, err = parseCoordinate(s[24:34], 3); err != nil {
+		return nil, err
+	}
+	if s[23] == 'W' {
+		g.Longitude = -g.Longitude
+	}
+
+	speed, err := strconv.Atoi(s[34:37])
+	if err != nil {
+		return nil, fmt.Errorf("hdap: invalid GPS speed %q", s[34:37])
+	}
+	g.Speed = float64(speed) * knots
+	direction, err := strconv.Atoi(s[37:40])
+	if err != nil {
+		return nil, fmt.Errorf("hdap: invalid GPS direction %q", s[37:40])
+	}
+	g.Direction = uint16(direction)
+
+	return g, nil
+}
+
+func (g *GPS) bytes() []byte {
+	var (
+		status    = "V"
+		latitude  = "N"
+		longitude = "E"
+		s         string
+	)
+	if g.Valid {
+		status = "A"
+	}
+	if g.Latitude < 0 {
+		latitude = "S"
+	}
+	if g.Longitude < 0 {
+		longitude = "W"
+	}
+
+	if g.Time.IsZero() {
+		s = "000000000000"
+	} else {
+		s = g.Time.UTC().Format("150405020106")
+	}
+	s += status
+	s += latitude + formatCoordinate(math.Abs(g.Latitude), 2)
+	s += longitude + formatCoordinate(math.Abs(g.Longitude), 3)
+	s += fmt.Sprintf("%03d%03d", int(math.Round(g.Speed/knots))%1000, g.Direction%1000)
+	return []byte(s)
+}
+
+// parseCoordinate parses degrees and decimal minutes.
+func parseCoordinate(s string, digits int) (float64, error) {
+	degrees, err := strconv.Atoi(s[:digits])
+	if err != nil {
+		return 0, fmt.Errorf("hdap: invalid GPS coordinate %q", s)
+	}
+	minutes, err := strconv.ParseFloat(s[digits:], 64)
+	if err != nil {
+		return 0, fmt.Errorf("hdap: invalid GPS coordinate %q", s)
+	}
+	return float64(degrees) + minutes/60, nil
+}
+
+// formatCoordinate formats degrees and decimal minutes.
+func formatCoordinate(v float64, digits int) string {
+	var (
+		degrees = math.Floor(v)
+		minutes = math.Round((v-degrees)*60*10000) / 10000
+	)
+	if minutes >= 60 {
+		degrees++
+		minutes = 0
+	}
+	return fmt.Sprintf("%0*d%07.4f", digits, int(degrees), minutes)
+}
@@ -0,0 +1,123 @@
+package hdap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// Radio registration service opcodes.
+const (
+	RRSDeregistration     uint16 = 0x0001 // Radio goes offline
+	RRSOnlineCheck        uint16 = 0x0002
+	RRSRegistration       uint16 = 0x0003 // Radio comes online
+	RRSOnlineCheckAnswer  uint16 = 0x8002
+	RRSRegistrationAnswer uint16 = 0x8003
+)
+
+var RRSOpcodeName = map[uint16]string{
+	RRSDeregistration:     "deregistration",
+	RRSOnlineCheck:        "online check",
+	RRSRegistration:       "registration",
+	RRSOnlineCheckAnswer:  "online check answer",
+	RRSRegistrationAnswer: "registration answer",
+}
+
+// Radio registration results.
+const (
+	RRSResultSuccess uint8 = 0x00
+	RRSResultFailure uint8 = 0x01
+)
+
+// DefaultRegistrationValidity is the validity returned in registration answers.
+var DefaultRegistrationValidity = time.Hour
+
+// Registration is a radio registration service message. The payload layout is:
+//
+//	radio IP address (4 octets)
+//	result (1 octet, answers only)
+//	validity in seconds (4 octets, registration answers only)
+type Registration struct {
+	Opcode   uint16
+	RadioID  uint32
+	Result   uint8
+	Validity time.Duration
+}
+
+func (r *Registration) String() string {
+	switch r.Opcode {
+	case RRSOnlineCheckAnswer:
+		return fmt.Sprintf("RRS %s, radio %d, result %d", RRSOpcodeName[r.Opcode], r.RadioID, r.Result)
+	case RRSRegistrationAnswer:
+		return fmt.Sprintf("RRS %s, radio %d, result %d, valid %s", RRSOpcodeName[r.Opcode], r.RadioID, r.Result, r.Validity)
+	default:
+		return fmt.Sprintf("RRS %s, radio %d", RRSOpcodeName[r.Opcode], r.RadioID)
+	}
+}
+
+// Answer builds the answer to a registration or online check, the result is
+// success.
+func (r *Registration) Answer() *Registration {
+	a := &Registration{
+		Opcode:  r.Opcode | 0x8000,
+		RadioID: r.RadioID,
+		Result:  RRSResultSuccess,
+	}
+	if r.Opcode == RRSRegistration {
+		a.Validity = DefaultRegistrationValidity
+	}
+	return a
+}
+
+// ParseRegistration parses a radio registration service message from the UDP
+// payload.
+func ParseRegistration(data []byte) (*Registration, error) {
+	p, err := parseService(data, ServiceRRS, 4)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Registration{
+		Opcode:  p.Opcode,
+		RadioID: radioID(p.Payload),
+	}
+	switch r.Opcode {
+	case RRSDeregistration, RRSOnlineCheck, RRSRegistration:
+		break
+	case RRSOnlineCheckAnswer:
+		if len(p.Payload) < 5 {
+			return nil, fmt.Errorf("hdap: expected 5 bytes %s payload, got %d", RRSOpcodeName[r.Opcode], len(p.Payload))
+		}
+		r.Result = p.Payload[4]
+	case RRSRegistrationAnswer:
+		if len(p.Payload) < 9 {
+			return nil, fmt.Errorf("hdap: expected 9 bytes %s payload, got %d", RRSOpcodeName[r.Opcode], len(p.Payload))
+		}
+		r.Result = p.Payload[4]
+		r.Validity = time.Duration(binary.BigEndian.Uint32(p.Payload[5:])) * time.Second
+	default:
+		return nil, fmt.Errorf("hdap: unsupported RRS opcode %#04x", r.Opcode)
+	}
+	return r, nil
+}
+
+// Bytes packs the message as UDP payload.
+func (r *Registration) Bytes() ([]byte, error) {
+	var payload = make([]byte, 4, 9)
+	putRadioID(payload, r.RadioID)
+
+	switch r.Opcode {
+	case RRSDeregistration, RRSOnlineCheck, RRSRegistration:
+		break
+	case RRSOnlineCheckAnswer:
+		payload = append(payload, r.Result)
+	case RRSRegistrationAnswer:
+		payload = append(payload, r.Result, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(payload[5:], uint32(r.Validity/time.Second))
+	default:
+		return nil, fmt.Errorf("hdap: unsupported RRS opcode %#04x", r.Opcode)
+	}
+
+	p := &PDU{Service: ServiceRRS, Opcode: r.Opcode, Payload: payload}
+	return p.Bytes()
+}
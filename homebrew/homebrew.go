@@ -29,7 +29,7 @@ func (a *AuthStatus) String() string {
 	case AuthBegin:
 		return "begin"
 	case AuthDone:
-		return "none"
+		return "done"
 	case AuthFailed:
 		return "failed"
 	default:
@@ -51,8 +51,12 @@ var (
 	MasterACK       = []byte("MSTACK")
 	RepeaterLogin   = []byte("RPTL")
 	RepeaterKey     = []byte("RPTK")
+	RepeaterConfig  = []byte("RPTC")
+	RepeaterOptions = []byte("RPTO")
 	MasterPing      = []byte("MSTPING")
 	RepeaterPong    = []byte("RPTPONG")
+	RepeaterPing    = []byte("RPTPING")
+	MasterPong      = []byte("MSTPONG")
 	MasterClosing   = []byte("MSTCL")
 	RepeaterClosing = []byte("RPTCL")
 )
@@ -65,12 +69,18 @@ var (
 	SendInterval = time.Millisecond * 30
 )
 
+// AuthFunc looks up the shared secret of a repeater by its DMR ID. It is used
+// in master mode to authenticate repeaters that were not linked with Link(),
+// a nil key or an error refuses the login.
+type AuthFunc func(id uint32) ([]byte, error)
+
 // Homebrew is implements the Homebrew IPSC DMR Air Interface protocol
 type Homebrew struct {
 	Config *RepeaterConfiguration
 	Peer   map[string]*Peer
 	PeerID map[uint32]*Peer
 
+	af     AuthFunc
 	pf     dmr.PacketFunc
 	conn   *net.UDPConn
 	closed bool
@@ -110,6 +120,8 @@ func New(config *RepeaterConfiguration, addr *net.UDPAddr) (*Homebrew, error) {
 }
 
 func (h *Homebrew) Active() bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
 	return !h.closed && h.conn != nil
 }
 
@@ -118,7 +130,7 @@ func (h *Homebrew) Close() error {
 	h.mutex.Lock()
 	defer h.mutex.Unlock()
 
-	if !h.Active() {
+	if h.closed || h.conn == nil {
 		return nil
 	}
 
@@ -128,7 +140,11 @@ func (h *Homebrew) Close() error {
 closing:
 	for _, peer := range h.Peer {
 		if peer.Status == AuthDone {
-			if err := h.WriteToPeer(append(RepeaterClosing, h.id...), peer); err != nil {
+			var msg = append(RepeaterClosing, h.id...)
+			if peer.Incoming {
+				msg = append(MasterClosing, peer.id...)
+			}
+			if err := h.writeToPeer(msg, peer); err != nil {
 				break closing
 			}
 		}
@@ -174,6 +190,28 @@ func (h *Homebrew) Link(peer *Peer) error {
 	return h.handleAuth(peer)
 }
 
+// SetOptions changes the options of a linked peer, if the link is established
+// the options are sent right away, otherwise they are sent after login.
+func (h *Homebrew) SetOptions(id uint32, options Options) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	peer, ok := h.PeerID[id]
+	if !ok {
+		return fmt.Errorf("homebrew: peer %d not linked", id)
+	}
+	if peer.Incoming {
+		return fmt.Errorf("homebrew: peer %d is an incoming peer", id)
+	}
+
+	peer.Options = options
+	if peer.Status != AuthDone {
+		return nil
+	}
+	peer.optionsSent = true
+	return h.writeToPeer(h.buildOptions(peer), peer)
+}
+
 func (h *Homebrew) Unlink(id uint32) error {
 	h.mutex.Lock()
 	defer h.mutex.Unlock()
@@ -183,25 +221,35 @@ func (h *Homebrew) Unlink(id uint32) error {
 		return fmt.Errorf("homebrew: peer %d not linked", id)
 	}
 
-	delete(h.Peer, peer.Addr.String())
-	delete(h.PeerID, id)
+	h.unlink(peer)
 	return nil
 }
 
+// unlink removes the peer, the caller must hold the mutex.
+func (h *Homebrew) unlink(peer *Peer) {
+	delete(h.Peer, peer.Addr.String())
+	if h.PeerID[peer.ID] == peer {
+		delete(h.PeerID, peer.ID)
+	}
+}
+
 func (h *Homebrew) ListenAndServe() error {
-	var data = make([]byte, 53)
+	// Large enough to hold the biggest frame, which is the RPTC configuration
+	var data = make([]byte, 512)
 
+	h.mutex.Lock()
 	h.stop = make(chan bool)
+	h.closed = false
 	go h.keepalive(h.stop)
+	h.mutex.Unlock()
 
-	h.closed = false
-	for !h.closed {
+	for {
 		n, peer, err := h.conn.ReadFromUDP(data)
-		if err != nil {
-			return err
+		if err == nil {
+			err = h.handle(peer, data[:n])
 		}
-		if err := h.handle(peer, data[:n]); err != nil {
-			if h.closed && strings.HasSuffix(err.Error(), "use of closed network connection") {
+		if err != nil {
+			if !h.Active() && strings.HasSuffix(err.Error(), "use of closed network connection") {
 				break
 			}
 			return err
@@ -217,9 +265,15 @@ func (h *Homebrew) Send(p *dmr.Packet) error {
 	h.rxtx.Lock()
 	defer h.rxtx.Unlock()
 
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
 	data := BuildData(p, h.Config.ID)
-	for _, peer := range h.getPeers() {
-		if err := h.WriteToPeer(data, peer); err != nil {
+	for _, peer := range h.Peer {
+		if peer.Status != AuthDone {
+			continue
+		}
+		if err := h.writeToPeer(data, peer); err != nil {
 			return err
 		}
 	}
@@ -235,11 +289,26 @@ func (h *Homebrew) SetPacketFunc(f dmr.PacketFunc) {
 	h.pf = f
 }
 
+// SetAuthFunc enables master mode, where logins from repeaters that were not
+// linked with Link() are accepted if f returns an authentication key for them.
+func (h *Homebrew) SetAuthFunc(f AuthFunc) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.af = f
+}
+
 func (h *Homebrew) WritePacketToPeer(p *dmr.Packet, peer *Peer) error {
 	return h.WriteToPeer(h.parsePacket(p), peer)
 }
 
 func (h *Homebrew) WriteToPeer(b []byte, peer *Peer) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.writeToPeer(b, peer)
+}
+
+// writeToPeer sends to the peer, the caller must hold the mutex.
+func (h *Homebrew) writeToPeer(b []byte, peer *Peer) error {
 	if peer == nil {
 		return errors.New("homebrew: can't write to nil peer")
 	}
@@ -269,101 +338,91 @@ func (h *Homebrew) getPeer(id uint32) *Peer {
 	return nil
 }
 
-func (h *Homebrew) getPeerByAddr(addr *net.UDPAddr) *Peer {
-	h.mutex.Lock()
-	defer h.mutex.Unlock()
-
-	if peer, ok := h.Peer[addr.String()]; ok {
-		return peer
-	}
-
-	return nil
-}
-
-func (h *Homebrew) getPeers() []*Peer {
-	h.mutex.Lock()
-	defer h.mutex.Unlock()
-
-	var peers = make([]*Peer, 0)
-	for _, peer := range h.Peer {
-		peers = append(peers, peer)
-	}
-
-	return peers
-}
-
 func (h *Homebrew) handle(remote *net.UDPAddr, data []byte) error {
-	peer := h.getPeerByAddr(remote)
-	if peer == nil {
-		log.Debugf("ignored packet from unknown peer %s\n", remote)
+	// Ignore packet that are clearly invalid, this is the minimum packet length for any Homebrew protocol frame
+	if len(data) < 12 {
 		return nil
 	}
 
-	// Ignore packet that are clearly invalid, this is the minimum packet length for any Homebrew protocol frame
-	if len(data) < 14 {
-		return nil
+	// DMR data is passed on without holding the mutex
+	if bytes.Equal(data[:4], DMRData) {
+		return h.handleData(remote, data)
 	}
 
-	if peer.Status != AuthDone {
-		// Ignore DMR data at this stage
-		if bytes.Equal(data[:4], DMRData) {
+	h.mutex.Lock()
+	peer, ok := h.Peer[remote.String()]
+	af := h.af
+	h.mutex.Unlock()
+
+	if !ok {
+		// In master mode, unknown repeaters may log in
+		if af == nil || !bytes.Equal(data[:4], RepeaterLogin) {
+			log.Debugf("ignored packet from unknown peer %s\n", remote)
 			return nil
 		}
 
-		if peer.Incoming {
-			switch peer.Status {
-			case AuthNone:
-				switch {
-				case bytes.Equal(data[:4], RepeaterLogin):
-					if !peer.CheckRepeaterID(data[4:]) {
-						log.Warningf("peer %d@%s sent invalid repeater ID %q (ignored)\n", peer.ID, remote, string(data[4:]))
-						return h.WriteToPeer(append(MasterNAK, h.id...), peer)
-					}
-
-					// Peer is verified, generate a nonce
-					nonce := make([]byte, 4)
-					if _, err := rand.Read(nonce); err != nil {
-						log.Errorf("peer %d@%s nonce generation failed: %v\n", peer.ID, remote, err)
-						return h.WriteToPeer(append(MasterNAK, h.id...), peer)
-					}
+		var err error
+		if peer, err = h.acceptPeer(remote, data[4:12], af); err != nil {
+			log.Warningf("peer %s refused login: %v\n", remote, err)
+			_, err = h.conn.WriteTo(append(MasterNAK, data[4:12]...), remote)
+			return err
+		}
+		log.Infof("peer %d@%s requested login\n", peer.ID, remote)
+	}
 
-					peer.UpdateToken(nonce)
-					peer.Status = AuthBegin
-					return h.WriteToPeer(append(append(MasterACK, h.id...), nonce...), peer)
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	peer.Last.PacketReceived = time.Now()
 
-				default:
-					// Ignore unauthenticated repeater, we're not going to reply unless it's
-					// an actual login request; if it was indeed a valid repeater and we missed
-					// anything, we rely on the remote end to retry to reconnect if it doesn't
-					// get an answer in a timely manner.
-					break
+	if peer.Status != AuthDone {
+		if peer.Incoming {
+			switch {
+			case bytes.Equal(data[:4], RepeaterLogin):
+				// Repeaters may retry their login at any stage
+				return h.handleLogin(peer, data)
+
+			case peer.Status == AuthBegin && bytes.Equal(data[:4], RepeaterKey):
+				if len(data) != 76 {
+					h.dropPeer(peer)
+					return h.writeToPeer(append(MasterNAK, peer.id...), peer)
+				}
+				if !peer.CheckRepeaterID(data[4:12]) {
+					log.Warningf("peer %d@%s sent invalid repeater ID %q (ignored)\n", peer.ID, remote, string(data[4:12]))
+					return h.writeToPeer(append(MasterNAK, peer.id...), peer)
+				}
+				if !bytes.EqualFold(data[12:], peer.Token) {
+					log.Errorf("peer %d@%s sent invalid key challenge token\n", peer.ID, remote)
+					h.dropPeer(peer)
+					return h.writeToPeer(append(MasterNAK, peer.id...), peer)
 				}
-				break
-
-			case AuthBegin:
-				switch {
-				case bytes.Equal(data[:4], RepeaterKey):
-					if !peer.CheckRepeaterID(data[4:]) {
-						log.Warningf("peer %d@%s sent invalid repeater ID %q (ignored)\n", peer.ID, remote, string(data[4:]))
-						return h.WriteToPeer(append(MasterNAK, h.id...), peer)
-					}
-					if len(data) != 76 {
-						peer.Status = AuthNone
-						return h.WriteToPeer(append(MasterNAK, h.id...), peer)
-					}
-					if !bytes.Equal(data[12:], peer.Token) {
-						log.Errorf("peer %d@%s sent invalid key challenge token\n", peer.ID, remote)
-						peer.Status = AuthNone
-						return h.WriteToPeer(append(MasterNAK, h.id...), peer)
-					}
 
-					peer.Last.PingSent = time.Now()
-					peer.Last.PongReceived = time.Now()
-					peer.Status = AuthDone
-					return h.WriteToPeer(append(MasterACK, h.id...), peer)
+				log.Infof("peer %d@%s logged in\n", peer.ID, remote)
+				if other, ok := h.PeerID[peer.ID]; ok && other != peer {
+					// Repeater reconnected from another address, the old
+					// session is replaced now the new address is authenticated
+					log.Infof("peer %d moved from %s\n", peer.ID, other.Addr)
+					h.unlink(other)
 				}
+				h.PeerID[peer.ID] = peer
+				peer.Last.PingSent = time.Now()
+				peer.Last.PingReceived = time.Now()
+				peer.Last.PongReceived = time.Now()
+				peer.Status = AuthDone
+				return h.writeToPeer(append(MasterACK, peer.id...), peer)
+
+			default:
+				// Ignore unauthenticated repeater, we're not going to reply unless it's
+				// an actual login request; if it was indeed a valid repeater and we missed
+				// anything, we rely on the remote end to retry to reconnect if it doesn't
+				// get an answer in a timely manner.
+				break
 			}
 		} else {
+			// Ignore frames that are too short to carry our repeater ID
+			if len(data) < 14 {
+				return nil
+			}
+
 			// Verify we have a matching peer ID
 			if !h.checkRepeaterID(data[6:14]) {
 				log.Warningf("peer %d@%s sent invalid repeater ID %q (ignored)\n", peer.ID, remote, string(data[6:14]))
@@ -383,7 +442,7 @@ func (h *Homebrew) handle(remote *net.UDPAddr, data []byte) error {
 					log.Errorf("peer %d@%s refused login\n", peer.ID, remote)
 					peer.Status = AuthFailed
 					if peer.UnlinkOnAuthFailure {
-						h.Unlink(peer.ID)
+						h.unlink(peer)
 					}
 					break
 
@@ -399,13 +458,14 @@ func (h *Homebrew) handle(remote *net.UDPAddr, data []byte) error {
 					peer.Status = AuthDone
 					peer.Last.PingSent = time.Now()
 					peer.Last.PongReceived = time.Now()
-					return h.WriteToPeer(h.Config.Bytes(), peer)
+					peer.optionsSent = false
+					return h.writeToPeer(h.Config.Bytes(), peer)
 
 				case bytes.Equal(data[:6], MasterNAK):
 					log.Errorf("peer %d@%s refused login\n", peer.ID, remote)
 					peer.Status = AuthFailed
 					if peer.UnlinkOnAuthFailure {
-						h.Unlink(peer.ID)
+						h.unlink(peer)
 					}
 					break
 
@@ -419,18 +479,60 @@ func (h *Homebrew) handle(remote *net.UDPAddr, data []byte) error {
 		// Authentication is done
 		if peer.Incoming {
 			switch {
-			case bytes.Equal(data[:4], DMRData):
-				p, err := h.parseData(data)
+			case bytes.Equal(data[:4], RepeaterLogin):
+				log.Infof("peer %d@%s logging in again\n", peer.ID, remote)
+				peer.Status = AuthNone
+				return h.handleLogin(peer, data)
+
+			case len(data) == 13 && bytes.Equal(data[:5], RepeaterClosing):
+				if !peer.CheckRepeaterID(data[5:]) {
+					log.Warningf("peer %d@%s sent invalid repeater ID %q (ignored)\n", peer.ID, remote, string(data[5:]))
+					return nil
+				}
+				log.Infof("peer %d@%s closed the connection\n", peer.ID, remote)
+				h.dropPeer(peer)
+				break
+
+			case bytes.Equal(data[:4], RepeaterOptions):
+				if !peer.CheckRepeaterID(data[4:12]) {
+					log.Warningf("peer %d@%s sent invalid repeater ID %q (ignored)\n", peer.ID, remote, string(data[4:12]))
+					return nil
+				}
+				options, err := ParseOptions(string(data[12:]))
+				if err != nil {
+					log.Warningf("peer %d@%s sent invalid options: %v\n", peer.ID, remote, err)
+					return h.writeToPeer(append(MasterNAK, peer.id...), peer)
+				}
+
+				log.Debugf("peer %d@%s sent options: %s\n", peer.ID, remote, options)
+				peer.Options = options
+				return h.writeToPeer(append(MasterACK, peer.id...), peer)
+
+			case bytes.Equal(data[:4], RepeaterConfig):
+				config, err := ParseRepeaterConfiguration(data)
+				if err == nil && config.ID != peer.ID {
+					err = fmt.Errorf("homebrew: configuration is for repeater %d", config.ID)
+				}
 				if err != nil {
-					return err
+					log.Warningf("peer %d@%s sent invalid configuration: %v\n", peer.ID, remote, err)
+					h.dropPeer(peer)
+					return h.writeToPeer(append(MasterNAK, peer.id...), peer)
 				}
-				return h.handlePacket(p, peer)
+
+				log.Debugf("peer %d@%s sent configuration: %s (%s)\n", peer.ID, remote, config.Callsign, config.Location)
+				peer.Config = config
+				return h.writeToPeer(append(MasterACK, peer.id...), peer)
 
 			case bytes.Equal(data[:6], MasterACK):
 				break
 
 			case len(data) == 15 && bytes.Equal(data[:7], MasterPing):
-				return h.WriteToPeer(append(RepeaterPong, data[7:]...), peer)
+				peer.Last.PingReceived = time.Now()
+				return h.writeToPeer(append(RepeaterPong, data[7:]...), peer)
+
+			case len(data) == 15 && bytes.Equal(data[:7], RepeaterPing):
+				peer.Last.PingReceived = time.Now()
+				return h.writeToPeer(append(MasterPong, data[7:]...), peer)
 
 			default:
 				log.Warningf("peer %d@%s sent unexpected packet (status=%s):\n", peer.ID, remote, peer.Status.String())
@@ -439,20 +541,27 @@ func (h *Homebrew) handle(remote *net.UDPAddr, data []byte) error {
 			}
 		} else {
 			switch {
-			case bytes.Equal(data[:4], DMRData):
-				p, err := h.parseData(data)
-				if err != nil {
-					return err
-				}
-				return h.handlePacket(p, peer)
-
 			case bytes.Equal(data[:6], MasterACK):
 				if !h.checkRepeaterID(data[6:]) {
 					log.Warningf("peer %d@%s sent invalid repeater ID %q (ignored)\n", peer.ID, remote, string(data[6:14]))
 					return nil
 				}
+
+				// Later ACKs are for our options
+				if peer.optionsSent {
+					break
+				}
+
+				// Configuration is accepted, send our options (if any) and start pinging
+				peer.optionsSent = true
+				if len(h.peerOptions(peer)) > 0 {
+					if err := h.writeToPeer(h.buildOptions(peer), peer); err != nil {
+						return err
+					}
+				}
+
 				peer.Last.PingSent = time.Now()
-				return h.WriteToPeer(append(MasterPing, h.id...), peer)
+				return h.writeToPeer(append(MasterPing, h.id...), peer)
 
 			case bytes.Equal(data[:6], MasterNAK):
 				if !h.checkRepeaterID(data[6:]) {
@@ -492,16 +601,110 @@ func (h *Homebrew) handle(remote *net.UDPAddr, data []byte) error {
 	return nil
 }
 
+// acceptPeer registers a repeater that is logging in while we are in master
+// mode, its authentication key is looked up with the AuthFunc.
+func (h *Homebrew) acceptPeer(addr *net.UDPAddr, data []byte, af AuthFunc) (*Peer, error) {
+	id, err := h.parseRepeaterID(data)
+	if err != nil {
+		return nil, fmt.Errorf("homebrew: invalid repeater ID %q", string(data))
+	}
+
+	key, err := af(id)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) == 0 {
+		return nil, fmt.Errorf("homebrew: no AuthKey for repeater %d", id)
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	other, ok := h.PeerID[id]
+	if ok && !other.accepted {
+		return nil, fmt.Errorf("homebrew: repeater %d is linked at %s", id, other.Addr)
+	}
+
+	peer := &Peer{
+		ID:       id,
+		Addr:     addr,
+		AuthKey:  key,
+		Incoming: true,
+		accepted: true,
+		id:       packRepeaterID(id),
+	}
+	h.Peer[addr.String()] = peer
+
+	// A repeater that reconnects from another address keeps its session until
+	// the new address completes the login
+	if !ok {
+		h.PeerID[id] = peer
+	}
+
+	return peer, nil
+}
+
+// dropPeer ends the session of an incoming peer. Peers that were accepted in
+// master mode are forgotten, linked peers have to log in again. The caller
+// must hold the mutex.
+func (h *Homebrew) dropPeer(peer *Peer) {
+	peer.Status = AuthNone
+	if peer.accepted {
+		h.unlink(peer)
+	}
+}
+
+// handleData passes DMR data from an authenticated peer on.
+func (h *Homebrew) handleData(remote *net.UDPAddr, data []byte) error {
+	h.mutex.Lock()
+	peer, ok := h.Peer[remote.String()]
+	if ok {
+		peer.Last.PacketReceived = time.Now()
+		ok = peer.Status == AuthDone
+	}
+	h.mutex.Unlock()
+
+	// Ignore DMR data from unknown peers, or before the login completed
+	if !ok {
+		return nil
+	}
+
+	p, err := h.parseData(data)
+	if err != nil {
+		return err
+	}
+	return h.handlePacket(p, peer)
+}
+
+// handleLogin answers the login request of an incoming peer with a nonce.
+func (h *Homebrew) handleLogin(peer *Peer, data []byte) error {
+	if !peer.CheckRepeaterID(data[4:12]) {
+		log.Warningf("peer %d@%s sent invalid repeater ID %q (ignored)\n", peer.ID, peer.Addr, string(data[4:12]))
+		return h.writeToPeer(append(MasterNAK, peer.id...), peer)
+	}
+
+	// Peer is verified, generate a nonce
+	nonce := make([]byte, 4)
+	if _, err := rand.Read(nonce); err != nil {
+		log.Errorf("peer %d@%s nonce generation failed: %v\n", peer.ID, peer.Addr, err)
+		return h.writeToPeer(append(MasterNAK, peer.id...), peer)
+	}
+
+	peer.UpdateToken(nonce)
+	peer.Status = AuthBegin
+	return h.writeToPeer(append(append(MasterACK, peer.id...), nonce...), peer)
+}
+
 func (h *Homebrew) handleAuth(peer *Peer) error {
 	if !peer.Incoming {
 		switch peer.Status {
 		case AuthNone:
 			// Send login packet
-			return h.WriteToPeer(append(RepeaterLogin, h.id...), peer)
+			return h.writeToPeer(append(RepeaterLogin, h.id...), peer)
 
 		case AuthBegin:
 			// Send repeater key exchange packet
-			return h.WriteToPeer(append(append(RepeaterKey, h.id...), peer.Token...), peer)
+			return h.writeToPeer(append(append(RepeaterKey, h.id...), peer.Token...), peer)
 		}
 	}
 	return nil
@@ -531,19 +734,28 @@ func (h *Homebrew) keepalive(stop <-chan bool) {
 		case <-time.After(time.Second):
 			now := time.Now()
 
-			for _, peer := range h.getPeers() {
+			h.mutex.Lock()
+			for _, peer := range h.Peer {
 				// Ping protocol only applies to outgoing links, and also the auth retries
 				// are entirely up to the peer.
 				if peer.Incoming {
 					switch peer.Status {
+					case AuthNone, AuthBegin:
+						switch {
+						case peer.accepted && now.Sub(peer.Last.PacketReceived) > AuthTimeout:
+							log.Errorf("peer %d@%s did not complete login; dropping connection", peer.ID, peer.Addr)
+							h.dropPeer(peer)
+							break
+						}
+
 					case AuthDone:
 						switch {
 						case now.Sub(peer.Last.PingReceived) > PingTimeout:
-							peer.Status = AuthNone
 							log.Errorf("peer %d@%s not requesting to ping; dropping connection", peer.ID, peer.Addr)
-							if err := h.WriteToPeer(append(MasterClosing, h.id...), peer); err != nil {
+							if err := h.writeToPeer(append(MasterClosing, peer.id...), peer); err != nil {
 								log.Errorf("peer %d@%s close failed: %v\n", peer.ID, peer.Addr, err)
 							}
+							h.dropPeer(peer)
 							break
 						}
 						break
@@ -566,7 +778,7 @@ func (h *Homebrew) keepalive(stop <-chan bool) {
 						case now.Sub(peer.Last.PongReceived) > PingTimeout:
 							peer.Status = AuthNone
 							log.Errorf("peer %d@%s not responding to ping; trying to re-establish connection", peer.ID, peer.Addr)
-							if err := h.WriteToPeer(append(RepeaterClosing, h.id...), peer); err != nil {
+							if err := h.writeToPeer(append(RepeaterClosing, h.id...), peer); err != nil {
 								log.Errorf("peer %d@%s close failed: %v\n", peer.ID, peer.Addr, err)
 							}
 							if err := h.handleAuth(peer); err != nil {
@@ -576,7 +788,7 @@ func (h *Homebrew) keepalive(stop <-chan bool) {
 
 						case now.Sub(peer.Last.PingSent) > PingInterval:
 							peer.Last.PingSent = now
-							if err := h.WriteToPeer(append(MasterPing, h.id...), peer); err != nil {
+							if err := h.writeToPeer(append(MasterPing, h.id...), peer); err != nil {
 								log.Errorf("peer %d@%s ping failed: %v\n", peer.ID, peer.Addr, err)
 							}
 							break
@@ -584,6 +796,7 @@ func (h *Homebrew) keepalive(stop <-chan bool) {
 					}
 				}
 			}
+			h.mutex.Unlock()
 
 		case <-stop:
 			return
@@ -591,6 +804,20 @@ func (h *Homebrew) keepalive(stop <-chan bool) {
 	}
 }
 
+// peerOptions returns the options for an outgoing peer, the caller must hold
+// the mutex.
+func (h *Homebrew) peerOptions(peer *Peer) Options {
+	if peer.Options != nil {
+		return peer.Options
+	}
+	return h.Config.Options
+}
+
+// buildOptions builds the RPTO frame for an outgoing peer.
+func (h *Homebrew) buildOptions(peer *Peer) []byte {
+	return append(append(RepeaterOptions, h.id...), []byte(h.peerOptions(peer).String())...)
+}
+
 // parseData converts Homebrew packet format to DMR packet format
 func (h *Homebrew) parseData(data []byte) (*dmr.Packet, error) {
 	p, err := ParseData(data)
@@ -721,7 +948,7 @@ func ParseData(data []byte) (*dmr.Packet, error) {
 		p.DataType = dmr.VoiceBurstA + (data[15] >> 4)
 		break
 	case 0x02: // data sync
-		p.DataType = (data[15] >> 4)
+		p.DataType = dmr.ParseDataType(data[15] >> 4)
 		break
 	default: // unknown/unused
 		return nil, errors.New("homebrew: unexpected frame type 0b11")
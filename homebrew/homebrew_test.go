@@ -0,0 +1,331 @@
+package homebrew
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pd0mz/go-dmr"
+)
+
+var testAuthKey = []byte("passw0rd")
+
+func testMaster(t *testing.T) *Homebrew {
+	m, err := New(&RepeaterConfiguration{ID: 2040000, Callsign: "MASTER"}, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.SetAuthFunc(func(id uint32) ([]byte, error) {
+		if id != 2042214 {
+			return nil, errors.New("unknown repeater")
+		}
+		return testAuthKey, nil
+	})
+	go m.ListenAndServe()
+	return m
+}
+
+// testRepeater is a repeater speaking the Homebrew protocol on a plain socket.
+type testRepeater struct {
+	*testing.T
+	conn *net.UDPConn
+}
+
+func newTestRepeater(t *testing.T, m *Homebrew) *testRepeater {
+	conn, err := net.DialUDP("udp", nil, m.conn.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testRepeater{T: t, conn: conn}
+}
+
+func (r *testRepeater) send(parts ...[]byte) {
+	if _, err := r.conn.Write(bytes.Join(parts, nil)); err != nil {
+		r.Fatal(err)
+	}
+}
+
+// recv returns the next frame, or nil if nothing was received within timeout.
+func (r *testRepeater) recv(timeout time.Duration) []byte {
+	var data = make([]byte, 512)
+	r.conn.SetReadDeadline(time.Now().Add(timeout))
+	n, err := r.conn.Read(data)
+	if err != nil {
+		if e, ok := err.(net.Error); ok && e.Timeout() {
+			return nil
+		}
+		r.Fatal(err)
+	}
+	return data[:n]
+}
+
+func (r *testRepeater) expect(want ...[]byte) []byte {
+	data := r.recv(time.Second * 2)
+	if prefix := bytes.Join(want, nil); !bytes.HasPrefix(data, prefix) {
+		r.Fatalf("expected %q, got %q", prefix, data)
+	}
+	return data
+}
+
+// login logs in as repeater 2042214, up to and including the configuration.
+func (r *testRepeater) login(id []byte) {
+	r.send(RepeaterLogin, id)
+	nonce := r.expect(MasterACK, id)[14:]
+	if len(nonce) != 4 {
+		r.Fatalf("expected 4 byte nonce, got %d", len(nonce))
+	}
+
+	// Invalid key
+	r.send(RepeaterKey, id, make([]byte, 64))
+	r.expect(MasterNAK, id)
+
+	// Retry, with a valid key
+	r.send(RepeaterLogin, id)
+	nonce = r.expect(MasterACK, id)[14:]
+	hash := sha256.Sum256(append(nonce, testAuthKey...))
+	r.send(RepeaterKey, id, []byte(hex.EncodeToString(hash[:])))
+	r.expect(MasterACK, id)
+
+	r.send((&RepeaterConfiguration{ID: 2042214, Callsign: "PD0MZ"}).Bytes())
+	r.expect(MasterACK, id)
+}
+
+func TestMasterLogin(t *testing.T) {
+	var (
+		m  = testMaster(t)
+		r  = newTestRepeater(t, m)
+		id = packRepeaterID(2042214)
+	)
+	defer m.Close()
+
+	// Repeaters without an authentication key are refused
+	r.send(RepeaterLogin, packRepeaterID(2042215))
+	r.expect(MasterNAK, packRepeaterID(2042215))
+	if m.getPeer(2042215) != nil {
+		t.Fatal("refused repeater was registered")
+	}
+
+	r.login(id)
+	r.send(RepeaterOptions, id, []byte("TS1=2041;TS2=91"))
+	r.expect(MasterACK, id)
+
+	r.send(RepeaterPing, id)
+	r.expect(MasterPong, id)
+
+	// After closing, the repeater is forgotten and pings are ignored
+	r.send(RepeaterClosing, id)
+	time.Sleep(time.Millisecond * 50)
+	if m.getPeer(2042214) != nil {
+		t.Fatal("closed repeater was not dropped")
+	}
+	r.send(RepeaterPing, id)
+	if data := r.recv(time.Millisecond * 100); data != nil {
+		t.Fatalf("expected no reply after closing, got %q", data)
+	}
+
+	// Logging in again is allowed
+	r.login(id)
+	r.send(RepeaterPing, id)
+	r.expect(MasterPong, id)
+}
+
+func TestMasterMoved(t *testing.T) {
+	var (
+		m  = testMaster(t)
+		r  = newTestRepeater(t, m)
+		o  = newTestRepeater(t, m)
+		id = packRepeaterID(2042214)
+	)
+	defer m.Close()
+
+	// known returns if the master has a peer for the repeater address
+	known := func(r *testRepeater) bool {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+		_, ok := m.Peer[r.conn.LocalAddr().String()]
+		return ok
+	}
+
+	r.login(id)
+
+	// Another address can't take over the session without the key, and is
+	// forgotten after a failed key exchange
+	o.send(RepeaterLogin, id)
+	o.expect(MasterACK, id)
+	o.send(RepeaterKey, id, make([]byte, 64))
+	o.expect(MasterNAK, id)
+	if known(o) {
+		t.Fatal("repeater with invalid key was not dropped")
+	}
+	if peer := m.getPeer(2042214); peer == nil || peer.Addr.String() != r.conn.LocalAddr().String() {
+		t.Fatalf("expected repeater at %s, got %+v", r.conn.LocalAddr(), peer)
+	}
+	r.send(RepeaterPing, id)
+	r.expect(MasterPong, id)
+
+	// The repeater reconnects from another address
+	o.login(id)
+	if peer := m.getPeer(2042214); peer == nil || peer.Addr.String() != o.conn.LocalAddr().String() {
+		t.Fatalf("expected repeater at %s, got %+v", o.conn.LocalAddr(), peer)
+	}
+	if known(r) {
+		t.Fatal("old repeater address was not dropped")
+	}
+	r.send(RepeaterPing, id)
+	if data := r.recv(time.Millisecond * 100); data != nil {
+		t.Fatalf("expected no reply on the old address, got %q", data)
+	}
+	o.send(RepeaterPing, id)
+	o.expect(MasterPong, id)
+}
+
+func TestMasterTimeout(t *testing.T) {
+	defer func(auth, ping time.Duration) {
+		AuthTimeout = auth
+		PingTimeout = ping
+	}(AuthTimeout, PingTimeout)
+	AuthTimeout = time.Millisecond * 100
+	PingTimeout = time.Millisecond * 100
+
+	var (
+		m  = testMaster(t)
+		r  = newTestRepeater(t, m)
+		id = packRepeaterID(2042214)
+	)
+	defer m.Close()
+
+	// Login is not completed
+	r.send(RepeaterLogin, id)
+	r.expect(MasterACK, id)
+	time.Sleep(time.Second * 2)
+	if m.getPeer(2042214) != nil {
+		t.Fatal("repeater was not dropped after incomplete login")
+	}
+
+	// Repeater stops pinging
+	r.login(id)
+	r.expect(MasterClosing, id)
+	time.Sleep(time.Millisecond * 50)
+	if m.getPeer(2042214) != nil {
+		t.Fatal("repeater was not dropped after ping timeout")
+	}
+}
+
+func TestMasterClient(t *testing.T) {
+	var (
+		m        = testMaster(t)
+		received = make(chan *dmr.Packet, 16)
+	)
+	defer m.Close()
+	m.SetPacketFunc(func(_ dmr.Repeater, p *dmr.Packet) error {
+		received <- p
+		return nil
+	})
+
+	c, err := New(&RepeaterConfiguration{ID: 2042214, Callsign: "PD0MZ"}, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	go c.ListenAndServe()
+	if err = c.Link(&Peer{ID: 2040000, Addr: m.conn.LocalAddr().(*net.UDPAddr), AuthKey: testAuthKey}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Data is only sent after the login completed
+	p := &dmr.Packet{SrcID: 2042214, DstID: 91, DataType: dmr.CSBK, Data: make([]byte, 33)}
+	for i := 0; i < 40; i++ {
+		if err = c.Send(p); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case p := <-received:
+			if p.SrcID != 2042214 || p.DstID != 91 || p.DataType != dmr.CSBK {
+				t.Fatalf("unexpected packet %+v", p)
+			}
+			return
+		case <-time.After(time.Millisecond * 50):
+		}
+	}
+	t.Fatal("no data received from client")
+}
+
+func TestClientOptions(t *testing.T) {
+	master, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer master.Close()
+
+	c, err := New(&RepeaterConfiguration{
+		ID:       2042214,
+		Callsign: "PD0MZ",
+		Options:  Options{"TS1": "2041"},
+	}, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	go c.ListenAndServe()
+	if err = c.Link(&Peer{ID: 2040000, Addr: master.LocalAddr().(*net.UDPAddr), AuthKey: testAuthKey}); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		id   = packRepeaterID(2042214)
+		addr *net.UDPAddr
+	)
+	expect := func(want ...[]byte) []byte {
+		var data = make([]byte, 512)
+		master.SetReadDeadline(time.Now().Add(time.Second))
+		n, from, err := master.ReadFromUDP(data)
+		if err != nil {
+			t.Fatalf("expected %q: %v", bytes.Join(want, nil), err)
+		}
+		if prefix := bytes.Join(want, nil); !bytes.HasPrefix(data[:n], prefix) {
+			t.Fatalf("expected %q, got %q", prefix, data[:n])
+		}
+		addr = from
+		return data[:n]
+	}
+	send := func(parts ...[]byte) {
+		if _, err := master.WriteToUDP(bytes.Join(parts, nil), addr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	silent := func() {
+		master.SetReadDeadline(time.Now().Add(time.Millisecond * 200))
+		if n, _, err := master.ReadFromUDP(make([]byte, 512)); err == nil {
+			t.Fatalf("expected nothing, got %d bytes", n)
+		}
+	}
+
+	expect(RepeaterLogin, id)
+	send(MasterACK, id, []byte{1, 2, 3, 4})
+	expect(RepeaterKey, id)
+	send(MasterACK, id)
+	expect(RepeaterConfig)
+
+	// Options follow the configuration, then the client starts pinging
+	send(MasterACK, id)
+	expect(RepeaterOptions, id, []byte("TS1=2041"))
+	expect(MasterPing, id)
+
+	// Acknowledging the options doesn't trigger another ping
+	send(MasterACK, id)
+	silent()
+
+	// Options changed at runtime are sent right away
+	o := Options{}
+	o.SetTalkGroups(1, []uint32{91})
+	if err = c.SetOptions(2040000, o); err != nil {
+		t.Fatal(err)
+	}
+	expect(RepeaterOptions, id, []byte("TS2=91"))
+	send(MasterACK, id)
+	silent()
+}
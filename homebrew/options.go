@@ -0,0 +1,77 @@
+package homebrew
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Options are the link options a repeater sends in a RPTO frame after its
+// configuration was accepted, such as the static talk groups per timeslot:
+//
+//	TS1=2041,2042;TS2=91
+type Options map[string]string
+
+// ParseOptions parses a RPTO options string.
+func ParseOptions(s string) (Options, error) {
+	var o = Options{}
+	for _, part := range strings.Split(strings.TrimSpace(s), ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return nil, fmt.Errorf("homebrew: invalid option %q", part)
+		}
+		o[strings.ToUpper(strings.TrimSpace(kv[0]))] = strings.TrimSpace(kv[1])
+	}
+	return o, nil
+}
+
+// TalkGroups returns the static talk groups for the timeslot (0 for slot 1,
+// 1 for slot 2).
+func (o Options) TalkGroups(ts uint8) ([]uint32, error) {
+	var (
+		key = fmt.Sprintf("TS%d", ts+1)
+		tgs = []uint32{}
+	)
+	for _, f := range strings.Split(o[key], ",") {
+		if f = strings.TrimSpace(f); f == "" {
+			continue
+		}
+		tg, err := strconv.ParseUint(f, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("homebrew: invalid %s talk group %q", key, f)
+		}
+		tgs = append(tgs, uint32(tg))
+	}
+	return tgs, nil
+}
+
+// SetTalkGroups sets the static talk groups for the timeslot (0 for slot 1,
+// 1 for slot 2).
+func (o Options) SetTalkGroups(ts uint8, tgs []uint32) {
+	var f = make([]string, len(tgs))
+	for i, tg := range tgs {
+		f[i] = strconv.FormatUint(uint64(tg), 10)
+	}
+	o[fmt.Sprintf("TS%d", ts+1)] = strings.Join(f, ",")
+}
+
+// String returns the options as RPTO options string.
+func (o Options) String() string {
+	var keys = make([]string, 0, len(o))
+	for k := range o {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var part = make([]string, len(keys))
+	for i, k := range keys {
+		part[i] = k + "=" + o[k]
+	}
+	return strings.Join(part, ";")
+}
@@ -0,0 +1,34 @@
+package homebrew
+
+import "testing"
+
+func TestOptions(t *testing.T) {
+	test, err := ParseOptions("TS1=2041,2042; ts2=91;;VOICE=0")
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+
+	tgs, err := test.TalkGroups(0)
+	switch {
+	case err != nil:
+		t.Fatalf("decode failed: %v", err)
+	case len(tgs) != 2 || tgs[0] != 2041 || tgs[1] != 2042:
+		t.Fatalf("decode failed: TS1 talk groups wrong, got %v", tgs)
+	case test["TS2"] != "91":
+		t.Fatalf("decode failed: TS2 talk groups wrong, got %q", test["TS2"])
+	case test["VOICE"] != "0":
+		t.Fatalf("decode failed: VOICE wrong, got %q", test["VOICE"])
+	}
+
+	test.SetTalkGroups(1, []uint32{204, 9})
+	if s := test.String(); s != "TS1=2041,2042;TS2=204,9;VOICE=0" {
+		t.Fatalf("encode failed: got %q", s)
+	}
+
+	if _, err := ParseOptions("TS1"); err == nil {
+		t.Fatal("expected error on option without value")
+	}
+	if _, err := (Options{"TS1": "2041,foo"}).TalkGroups(0); err == nil {
+		t.Fatal("expected error on invalid talk group")
+	}
+}
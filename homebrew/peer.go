@@ -21,6 +21,8 @@ type Peer struct {
 	Incoming            bool
 	UnlinkOnAuthFailure bool
 	PacketReceived      dmr.PacketFunc
+	Config              *RepeaterConfiguration // Configuration sent by incoming peers
+	Options             Options                // Options sent to (or by incoming) peers, overrides Config.Options
 	Last                struct {
 		PacketSent     time.Time
 		PacketReceived time.Time
@@ -31,10 +33,16 @@ type Peer struct {
 
 	// Packed repeater ID
 	id []byte
+
+	// Peer logged in to us in master mode, without being linked
+	accepted bool
+
+	// Options were sent after the configuration
+	optionsSent bool
 }
 
 func (p *Peer) CheckRepeaterID(id []byte) bool {
-	return id != nil && p.id != nil && bytes.Equal(id, p.id)
+	return id != nil && p.id != nil && bytes.EqualFold(id, p.id)
 }
 
 func (p *Peer) UpdateToken(nonce []byte) {
@@ -1,11 +1,17 @@
 package homebrew
 
 import (
+	"bytes"
 	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/pd0mz/go-dmr"
 )
 
+// RepeaterConfigurationSize is the size of a RPTC configuration frame.
+const RepeaterConfigurationSize = 306
+
 // RepeaterConfiguration holds information about the current repeater. It
 // should be returned by a callback in the implementation, returning actual
 // information about the current repeater status.
@@ -24,6 +30,7 @@ type RepeaterConfiguration struct {
 	URL         string
 	SoftwareID  string
 	PackageID   string
+	Options     Options // Sent to the master after the configuration
 }
 
 // Bytes returns the configuration as bytes.
@@ -58,7 +65,7 @@ func (r *RepeaterConfiguration) String() string {
 		lon = lon[:9]
 	}
 
-	var b = "RPTC"
+	var b = string(RepeaterConfig)
 	b += fmt.Sprintf("%-8s", r.Callsign)
 	b += fmt.Sprintf("%08x", r.ID)
 	b += fmt.Sprintf("%09d", r.RXFreq)
@@ -76,6 +83,95 @@ func (r *RepeaterConfiguration) String() string {
 	return b
 }
 
+// ParseRepeaterConfiguration parses a RPTC configuration frame as sent by a
+// repeater after it has logged in.
+func ParseRepeaterConfiguration(data []byte) (*RepeaterConfiguration, error) {
+	if len(data) != RepeaterConfigurationSize {
+		return nil, fmt.Errorf("homebrew: expected %d configuration bytes, got %d", RepeaterConfigurationSize, len(data))
+	}
+	if !bytes.Equal(data[:4], RepeaterConfig) {
+		return nil, fmt.Errorf("homebrew: expected %q signature, got %q", RepeaterConfig, data[:4])
+	}
+
+	var (
+		r   = &RepeaterConfiguration{}
+		o   = 4
+		v   uint64
+		err error
+	)
+
+	// field returns the next fixed width field, with padding removed
+	field := func(size int) string {
+		f := strings.TrimSpace(string(data[o : o+size]))
+		o += size
+		return f
+	}
+	number := func(name string, size, bits int) (uint64, error) {
+		f := field(size)
+		v, err := strconv.ParseUint(f, 10, bits)
+		if err != nil {
+			return 0, fmt.Errorf("homebrew: invalid %s %q", name, f)
+		}
+		return v, nil
+	}
+	float := func(name string, size int, max float64) (float32, error) {
+		f := field(size)
+		v, err := strconv.ParseFloat(f, 32)
+		if err != nil || v < -max || v > max {
+			return 0, fmt.Errorf("homebrew: invalid %s %q", name, f)
+		}
+		return float32(v), nil
+	}
+
+	if r.Callsign = field(8); r.Callsign == "" {
+		return nil, fmt.Errorf("homebrew: invalid callsign %q", r.Callsign)
+	}
+
+	id := field(8)
+	if v, err = strconv.ParseUint(id, 16, 32); err != nil {
+		return nil, fmt.Errorf("homebrew: invalid repeater ID %q", id)
+	}
+	r.ID = uint32(v)
+
+	if v, err = number("RX frequency", 9, 32); err != nil {
+		return nil, err
+	}
+	r.RXFreq = uint32(v)
+	if v, err = number("TX frequency", 9, 32); err != nil {
+		return nil, err
+	}
+	r.TXFreq = uint32(v)
+	if v, err = number("TX power", 2, 8); err != nil {
+		return nil, err
+	}
+	r.TXPower = uint8(v)
+	if v, err = number("color code", 2, 8); err != nil {
+		return nil, err
+	}
+	if v > 15 {
+		return nil, fmt.Errorf("homebrew: invalid color code %d", v)
+	}
+	r.ColorCode = uint8(v)
+	if r.Latitude, err = float("latitude", 8, 90); err != nil {
+		return nil, err
+	}
+	if r.Longitude, err = float("longitude", 9, 180); err != nil {
+		return nil, err
+	}
+	if v, err = number("height", 3, 16); err != nil {
+		return nil, err
+	}
+	r.Height = uint16(v)
+
+	r.Location = field(20)
+	r.Description = field(20)
+	r.URL = field(124)
+	r.SoftwareID = field(40)
+	r.PackageID = field(40)
+
+	return r, nil
+}
+
 // ConfigFunc returns an actual RepeaterConfiguration instance when called.
 // This is used by the DMR repeater to poll for current configuration,
 // statistics and metrics.
@@ -0,0 +1,71 @@
+package homebrew
+
+import "testing"
+
+func TestRepeaterConfiguration(t *testing.T) {
+	want := &RepeaterConfiguration{
+		Callsign:    "PD0MZ",
+		ID:          2042214,
+		RXFreq:      430012500,
+		TXFreq:      439412500,
+		TXPower:     5,
+		ColorCode:   1,
+		Latitude:    52.296786,
+		Longitude:   4.595454,
+		Height:      12,
+		Location:    "Hillegom, ZH, NL",
+		Description: "go-dmr test",
+		URL:         "https://github.com/pd0mz/go-dmr",
+	}
+
+	data := want.Bytes()
+	if len(data) != RepeaterConfigurationSize {
+		t.Fatalf("encode failed: expected %d bytes, got %d", RepeaterConfigurationSize, len(data))
+	}
+
+	test, err := ParseRepeaterConfiguration(data)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+
+	switch {
+	case test.Callsign != want.Callsign:
+		t.Fatalf("decode failed: callsign wrong, got %q", test.Callsign)
+	case test.ID != want.ID:
+		t.Fatalf("decode failed: ID wrong, got %d", test.ID)
+	case test.RXFreq != want.RXFreq || test.TXFreq != want.TXFreq:
+		t.Fatalf("decode failed: frequencies wrong, got %d/%d", test.RXFreq, test.TXFreq)
+	case test.TXPower != want.TXPower:
+		t.Fatalf("decode failed: TX power wrong, got %d", test.TXPower)
+	case test.ColorCode != want.ColorCode:
+		t.Fatalf("decode failed: color code wrong, got %d", test.ColorCode)
+	case test.Latitude-want.Latitude > 0.0001 || want.Latitude-test.Latitude > 0.0001:
+		t.Fatalf("decode failed: latitude wrong, got %f", test.Latitude)
+	case test.Longitude-want.Longitude > 0.0001 || want.Longitude-test.Longitude > 0.0001:
+		t.Fatalf("decode failed: longitude wrong, got %f", test.Longitude)
+	case test.Height != want.Height:
+		t.Fatalf("decode failed: height wrong, got %d", test.Height)
+	case test.Location != want.Location || test.Description != want.Description || test.URL != want.URL:
+		t.Fatalf("decode failed: location, description or URL wrong")
+	case test.SoftwareID != want.SoftwareID || test.PackageID != want.PackageID:
+		t.Fatalf("decode failed: software or package ID wrong")
+	}
+}
+
+func TestRepeaterConfigurationInvalid(t *testing.T) {
+	data := (&RepeaterConfiguration{Callsign: "PD0MZ", ID: 2042214}).Bytes()
+
+	if _, err := ParseRepeaterConfiguration(data[:len(data)-1]); err == nil {
+		t.Fatal("expected error on short configuration")
+	}
+
+	// Color codes range from 0 to 15
+	data[40], data[41] = '0', '0'
+	if r, err := ParseRepeaterConfiguration(data); err != nil || r.ColorCode != 0 {
+		t.Fatalf("expected color code 0, got %v", err)
+	}
+	data[40], data[41] = '1', '6'
+	if _, err := ParseRepeaterConfiguration(data); err == nil {
+		t.Fatal("expected error on invalid color code")
+	}
+}
@@ -0,0 +1,170 @@
+package dmr
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// IPv4 and UDP header sizes, without options.
+const (
+	IPv4HeaderSize = 20
+	UDPHeaderSize  = 8
+)
+
+// IPProtocolUDP is the IPv4 protocol number of UDP.
+const IPProtocolUDP = 17
+
+// DefaultIPv4TTL is the time to live of datagrams we build.
+var DefaultIPv4TTL uint8 = 64
+
+// UDPDatagram is an IPv4/UDP datagram, as carried in IP based packet data.
+type UDPDatagram struct {
+	ID      uint16 // IPv4 identification
+	TTL     uint8
+	SrcIP   net.IP
+	DstIP   net.IP
+	SrcPort uint16
+	DstPort uint16
+	Data    []byte
+}
+
+func (d *UDPDatagram) String() string {
+	return fmt.Sprintf("UDP %s:%d->%s:%d, id %d, %d bytes",
+		d.SrcIP, d.SrcPort, d.DstIP, d.DstPort, d.ID, len(d.Data))
+}
+
+// ParseUDPDatagram parses an IPv4/UDP datagram, trailing bytes beyond the IPv4
+// total length (such as data block padding) are ignored.
+func ParseUDPDatagram(data []byte) (*UDPDatagram, error) {
+	if len(data) < IPv4HeaderSize {
+		return nil, fmt.Errorf("dmr/ip: expected at least %d bytes, got %d", IPv4HeaderSize, len(data))
+	}
+	if data[0]>>4 != 4 {
+		return nil, fmt.Errorf("dmr/ip: unsupported IP version %d", data[0]>>4)
+	}
+
+	var (
+		ihl   = int(data[0]&0x0f) * 4
+		total = int(binary.BigEndian.Uint16(data[2:]))
+	)
+	if ihl < IPv4HeaderSize || total < ihl+UDPHeaderSize || total > len(data) {
+		return nil, fmt.Errorf("dmr/ip: invalid header length %d and total length %d", ihl, total)
+	}
+	if checksum(data[:ihl]) != 0 {
+		return nil, errors.New("dmr/ip: IPv4 header checksum error")
+	}
+	if data[6]&0x3f != 0 || data[7] != 0 {
+		return nil, errors.New("dmr/ip: fragmented datagrams are not supported")
+	}
+	if data[9] != IPProtocolUDP {
+		return nil, fmt.Errorf("dmr/ip: unsupported protocol %d", data[9])
+	}
+
+	d := &UDPDatagram{
+		ID:    binary.BigEndian.Uint16(data[4:]),
+		TTL:   data[8],
+		SrcIP: net.IPv4(data[12], data[13], data[14], data[15]).To4(),
+		DstIP: net.IPv4(data[16], data[17], data[18], data[19]).To4(),
+	}
+
+	var (
+		udp    = data[ihl:total]
+		length = int(binary.BigEndian.Uint16(udp[4:]))
+	)
+	if length < UDPHeaderSize || length > len(udp) {
+		return nil, fmt.Errorf("dmr/ip: invalid UDP length %d", length)
+	}
+	if sum := binary.BigEndian.Uint16(udp[6:]); sum != 0 {
+		if udpChecksum(d.SrcIP, d.DstIP, udp[:length]) != 0 {
+			return nil, errors.New("dmr/ip: UDP checksum error")
+		}
+	}
+
+	d.SrcPort = binary.BigEndian.Uint16(udp[0:])
+	d.DstPort = binary.BigEndian.Uint16(udp[2:])
+	d.Data = make([]byte, length-UDPHeaderSize)
+	copy(d.Data, udp[UDPHeaderSize:length])
+	return d, nil
+}
+
+// Bytes packs the datagram, including the IPv4 header and UDP checksums.
+func (d *UDPDatagram) Bytes() ([]byte, error) {
+	var (
+		src = d.SrcIP.To4()
+		dst = d.DstIP.To4()
+	)
+	if src == nil || dst == nil {
+		return nil, errors.New("dmr/ip: source and destination must be IPv4 addresses")
+	}
+
+	var total = IPv4HeaderSize + UDPHeaderSize + len(d.Data)
+	if total > 0xffff {
+		return nil, fmt.Errorf("dmr/ip: datagram of %d bytes too large", total)
+	}
+
+	var (
+		data = make([]byte, total)
+		udp  = data[IPv4HeaderSize:]
+		ttl  = d.TTL
+	)
+	if ttl == 0 {
+		ttl = DefaultIPv4TTL
+	}
+
+	data[0] = 0x45 // Version 4, 5 words header
+	binary.BigEndian.PutUint16(data[2:], uint16(total))
+	binary.BigEndian.PutUint16(data[4:], d.ID)
+	data[8] = ttl
+	data[9] = IPProtocolUDP
+	copy(data[12:], src)
+	copy(data[16:], dst)
+	binary.BigEndian.PutUint16(data[10:], checksum(data[:IPv4HeaderSize]))
+
+	binary.BigEndian.PutUint16(udp[0:], d.SrcPort)
+	binary.BigEndian.PutUint16(udp[2:], d.DstPort)
+	binary.BigEndian.PutUint16(udp[4:], uint16(UDPHeaderSize+len(d.Data)))
+	copy(udp[UDPHeaderSize:], d.Data)
+	sum := udpChecksum(src, dst, udp)
+	if sum == 0 {
+		// Zero means no checksum was calculated
+		sum = 0xffff
+	}
+	binary.BigEndian.PutUint16(udp[6:], sum)
+
+	return data, nil
+}
+
+// checksum calculates the Internet checksum (RFC 1071).
+func checksum(data []byte) uint16 {
+	return ^checksumFold(checksumAdd(0, data))
+}
+
+// udpChecksum calculates the UDP checksum, including the pseudo header.
+func udpChecksum(src, dst net.IP, udp []byte) uint16 {
+	var sum uint32
+	sum = checksumAdd(sum, src.To4())
+	sum = checksumAdd(sum, dst.To4())
+	sum += IPProtocolUDP
+	sum += uint32(len(udp))
+	sum = checksumAdd(sum, udp)
+	return ^checksumFold(sum)
+}
+
+func checksumAdd(sum uint32, data []byte) uint32 {
+	for i := 0; i+1 < len(data); i += 2 {
+		sum += uint32(data[i])<<8 | uint32(data[i+1])
+	}
+	if len(data)%2 == 1 {
+		sum += uint32(data[len(data)-1]) << 8
+	}
+	return sum
+}
+
+func checksumFold(sum uint32) uint16 {
+	for sum > 0xffff {
+		sum = (sum >> 16) + (sum & 0xffff)
+	}
+	return uint16(sum)
+}
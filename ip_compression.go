@@ -0,0 +1,202 @@
+package dmr
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// UDP/IPv4 header compression address identifiers (SAID and DAID), see
+// ETSI TS 102 361-3.
+const (
+	AddressIDRadioNetwork     uint8 = iota // Radio network address of the MS
+	AddressIDInterfaceNetwork              // USB/Ethernet interface network address of the MS
+	AddressIDGroupNetwork                  // Group network address, destination only
+)
+
+var AddressIDName = map[uint8]string{
+	AddressIDRadioNetwork:     "radio network",
+	AddressIDInterfaceNetwork: "interface network",
+	AddressIDGroupNetwork:     "group network",
+}
+
+// First octet of the IPv4 addresses for the address identifiers, the other
+// octets contain the DMR ID.
+var (
+	RadioNetwork     uint8 = 12
+	InterfaceNetwork uint8 = 13
+	GroupNetwork     uint8 = 225
+)
+
+// CompressedPorts maps the UDP/IPv4 header compression port identifiers
+// (SPID and DPID) to UDP ports, port identifier 0 means the port number is
+// carried in the compressed header.
+var CompressedPorts = map[uint8]uint16{
+	1: 5016, // UTF-16BE text message
+	2: 5017, // Location information protocol
+}
+
+// UDPIPHeaderCompressedSize is the size of the compressed header, without the
+// optional port numbers.
+const UDPIPHeaderCompressedSize = 5
+
+// IPv4Address returns the IPv4 address of a DMR ID in the network.
+func IPv4Address(network uint8, id uint32) net.IP {
+	return net.IPv4(network, uint8(id>>16), uint8(id>>8), uint8(id)).To4()
+}
+
+// IPv4ID returns the network and DMR ID of an IPv4 address.
+func IPv4ID(ip net.IP) (uint8, uint32, error) {
+	ip4 := ip.To4()
+	if ip4 == nil {
+		return 0, 0, fmt.Errorf("dmr/ip: %s is not an IPv4 address", ip)
+	}
+	return ip4[0], uint32(ip4[1])<<16 | uint32(ip4[2])<<8 | uint32(ip4[3]), nil
+}
+
+// DecompressUDPDatagram reconstructs the IPv4/UDP datagram from UDP/IPv4
+// header compressed data, the source and destination ID are taken from the
+// data header. The compressed header layout is:
+//
+//	IPv4 identification (2 octets)
+//	SAID (4 bits), DAID (4 bits)
+//	opcode bit 1 (1 bit), SPID (7 bits)
+//	opcode bit 0 (1 bit), DPID (7 bits)
+//	UDP source port (2 octets, if SPID is 0)
+//	UDP destination port (2 octets, if DPID is 0)
+//	UDP payload
+func DecompressUDPDatagram(data []byte, srcID, dstID uint32) (*UDPDatagram, error) {
+	if len(data) < UDPIPHeaderCompressedSize {
+		return nil, fmt.Errorf("dmr/ip: expected at least %d bytes, got %d", UDPIPHeaderCompressedSize, len(data))
+	}
+
+	var (
+		said   = data[2] >> 4
+		daid   = data[2] & 0x0f
+		opcode = (data[3]>>7)<<1 | data[4]>>7
+		spid   = data[3] & 0x7f
+		dpid   = data[4] & 0x7f
+		o      = UDPIPHeaderCompressedSize
+		err    error
+	)
+	if opcode != 0 {
+		return nil, fmt.Errorf("dmr/ip: unsupported header compression opcode %d", opcode)
+	}
+	if said == AddressIDGroupNetwork {
+		return nil, errors.New("dmr/ip: group network can't be the source")
+	}
+
+	d := &UDPDatagram{
+		ID:  binary.BigEndian.Uint16(data),
+		TTL: DefaultIPv4TTL,
+	}
+	if d.SrcIP, err = addressForID(said, srcID); err != nil {
+		return nil, err
+	}
+	if d.DstIP, err = addressForID(daid, dstID); err != nil {
+		return nil, err
+	}
+
+	if d.SrcPort, o, err = portForID(spid, data, o); err != nil {
+		return nil, err
+	}
+	if d.DstPort, o, err = portForID(dpid, data, o); err != nil {
+		return nil, err
+	}
+
+	d.Data = make([]byte, len(data)-o)
+	copy(d.Data, data[o:])
+	return d, nil
+}
+
+// CompressedBytes packs the datagram with a UDP/IPv4 compressed header, the
+// addresses must be derived from the source and destination ID in the data
+// header.
+func (d *UDPDatagram) CompressedBytes(srcID, dstID uint32) ([]byte, error) {
+	said, err := idForAddress(d.SrcIP, srcID)
+	if err != nil {
+		return nil, err
+	}
+	if said == AddressIDGroupNetwork {
+		return nil, errors.New("dmr/ip: group network can't be the source")
+	}
+	daid, err := idForAddress(d.DstIP, dstID)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		data = make([]byte, UDPIPHeaderCompressedSize, UDPIPHeaderCompressedSize+4+len(d.Data))
+		spid = idForPort(d.SrcPort)
+		dpid = idForPort(d.DstPort)
+	)
+	binary.BigEndian.PutUint16(data, d.ID)
+	data[2] = said<<4 | daid
+	data[3] = spid
+	data[4] = dpid
+	if spid == 0 {
+		data = append(data, uint8(d.SrcPort>>8), uint8(d.SrcPort))
+	}
+	if dpid == 0 {
+		data = append(data, uint8(d.DstPort>>8), uint8(d.DstPort))
+	}
+	return append(data, d.Data...), nil
+}
+
+func addressForID(aid uint8, id uint32) (net.IP, error) {
+	switch aid {
+	case AddressIDRadioNetwork:
+		return IPv4Address(RadioNetwork, id), nil
+	case AddressIDInterfaceNetwork:
+		return IPv4Address(InterfaceNetwork, id), nil
+	case AddressIDGroupNetwork:
+		return IPv4Address(GroupNetwork, id), nil
+	default:
+		return nil, fmt.Errorf("dmr/ip: unsupported address identifier %d", aid)
+	}
+}
+
+func idForAddress(ip net.IP, id uint32) (uint8, error) {
+	network, addressID, err := IPv4ID(ip)
+	if err != nil {
+		return 0, err
+	}
+	if addressID != id&0x00ffffff {
+		return 0, fmt.Errorf("dmr/ip: address %s does not match ID %d", ip, id)
+	}
+
+	switch network {
+	case RadioNetwork:
+		return AddressIDRadioNetwork, nil
+	case InterfaceNetwork:
+		return AddressIDInterfaceNetwork, nil
+	case GroupNetwork:
+		return AddressIDGroupNetwork, nil
+	default:
+		return 0, fmt.Errorf("dmr/ip: address %s can't be compressed", ip)
+	}
+}
+
+func portForID(pid uint8, data []byte, o int) (uint16, int, error) {
+	if pid != 0 {
+		port, ok := CompressedPorts[pid]
+		if !ok {
+			return 0, o, fmt.Errorf("dmr/ip: unsupported port identifier %d", pid)
+		}
+		return port, o, nil
+	}
+	if o+2 > len(data) {
+		return 0, o, errors.New("dmr/ip: missing port in compressed header")
+	}
+	return binary.BigEndian.Uint16(data[o:]), o + 2, nil
+}
+
+func idForPort(port uint16) uint8 {
+	for pid, p := range CompressedPorts {
+		if p == port {
+			return pid
+		}
+	}
+	return 0
+}
@@ -0,0 +1,91 @@
+package dmr
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+func TestUDPDatagram(t *testing.T) {
+	want := &UDPDatagram{
+		ID:      1,
+		SrcIP:   net.IPv4(12, 31, 41, 164).To4(),
+		DstIP:   net.IPv4(13, 0, 0, 1).To4(),
+		SrcPort: 4007,
+		DstPort: 4007,
+		Data:    []byte("CQCQCQ PD0MZ"),
+	}
+
+	data, err := want.Bytes()
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+
+	// Padding, as found in data fragments, is ignored
+	test, err := ParseUDPDatagram(append(data, 0x00, 0x00, 0x00))
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if !test.SrcIP.Equal(want.SrcIP) || !test.DstIP.Equal(want.DstIP) {
+		t.Fatalf("decode failed: expected %s, got %s", want, test)
+	}
+	if test.SrcPort != want.SrcPort || test.DstPort != want.DstPort || test.TTL != DefaultIPv4TTL {
+		t.Fatalf("decode failed: expected %s, got %s", want, test)
+	}
+	if !bytes.Equal(test.Data, want.Data) {
+		t.Fatalf("decode failed: expected %q, got %q", want.Data, test.Data)
+	}
+
+	data[len(data)-1] ^= 0x01
+	if _, err = ParseUDPDatagram(data); err == nil {
+		t.Fatal("decode failed: expected UDP checksum error")
+	}
+}
+
+func TestUDPDatagramCompression(t *testing.T) {
+	var tests = []*UDPDatagram{
+		{
+			ID:      42,
+			SrcIP:   IPv4Address(RadioNetwork, 2042214),
+			DstIP:   IPv4Address(InterfaceNetwork, 2043044),
+			SrcPort: 5016,
+			DstPort: 5016,
+			Data:    []byte("CQCQCQ PD0MZ"),
+		},
+		{
+			ID:      43,
+			SrcIP:   IPv4Address(RadioNetwork, 2042214),
+			DstIP:   IPv4Address(GroupNetwork, 2043044),
+			SrcPort: 4001,
+			DstPort: 4001,
+			Data:    []byte{0x01, 0x02, 0x03},
+		},
+	}
+
+	for _, want := range tests {
+		data, err := want.CompressedBytes(2042214, 2043044)
+		if err != nil {
+			t.Fatalf("encode failed: %v", err)
+		}
+
+		test, err := DecompressUDPDatagram(data, 2042214, 2043044)
+		if err != nil {
+			t.Fatalf("decode failed: %v", err)
+		}
+		if !test.SrcIP.Equal(want.SrcIP) || !test.DstIP.Equal(want.DstIP) {
+			t.Fatalf("decode failed: expected %s, got %s", want, test)
+		}
+		if test.ID != want.ID || test.SrcPort != want.SrcPort || test.DstPort != want.DstPort {
+			t.Fatalf("decode failed: expected %s, got %s", want, test)
+		}
+		if !bytes.Equal(test.Data, want.Data) {
+			t.Fatalf("decode failed: expected %q, got %q", want.Data, test.Data)
+		}
+	}
+
+	// Addresses outside of the known networks can't be compressed
+	d := &UDPDatagram{SrcIP: net.IPv4(192, 168, 1, 1), DstIP: IPv4Address(RadioNetwork, 1)}
+	if _, err := d.CompressedBytes(1, 1); err == nil {
+		t.Fatal("encode failed: expected error")
+	}
+}
@@ -6,12 +6,19 @@ import (
 	"crypto/sha1"
 	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	"fmt"
-	"log"
 	"net"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/op/go-logging"
+	"github.com/pd0mz/go-dmr"
 )
 
+var log = logging.MustGetLogger("dmr/ipsc")
+
 type Network struct {
 	Disabled                   bool
 	RadioID                    uint32
@@ -45,13 +52,7 @@ type ipscPeerStatus struct {
 	keepAliveRXTime      time.Time
 }
 
-type ipscPeer struct {
-	radioID uint32
-	mode    byte
-	flags   []byte
-	status  ipscPeerStatus
-}
-
+// IPSC implements the Motorola IP Site Connect protocol.
 type IPSC struct {
 	Network *Network
 	Dump    bool
@@ -64,7 +65,7 @@ type IPSC struct {
 		flags   []byte
 		tsFlags []byte
 	}
-	peers  map[uint32]ipscPeer
+	peers  map[uint32]*ipscPeer
 	master struct {
 		addr    *net.UDPAddr
 		radioID uint32
@@ -72,16 +73,29 @@ type IPSC struct {
 		flags   []byte
 		status  ipscPeerStatus
 	}
-	conn *net.UDPConn
+	conn   *net.UDPConn
+	closed bool
+	pf     dmr.PacketFunc
+	mutex  *sync.Mutex // Mutex for manipulating master and peer state
+	stop   chan bool
+
+	// Transmit state per timeslot
+	tx [2]struct {
+		streamID  uint32
+		sequence  uint8
+		rtpSeq    uint16
+		timestamp uint32
+	}
 }
 
 func New(network *Network) (*IPSC, error) {
 	c := &IPSC{
 		Network: network,
+		mutex:   &sync.Mutex{},
 	}
 	c.local.radioID = make([]byte, 4)
 	c.local.flags = make([]byte, 4)
-	c.peers = make(map[uint32]ipscPeer)
+	c.peers = make(map[uint32]*ipscPeer)
 	c.master.flags = make([]byte, 4)
 
 	binary.BigEndian.PutUint32(c.local.radioID, c.Network.RadioID)
@@ -96,6 +110,9 @@ func New(network *Network) (*IPSC, error) {
 	if c.Network.AliveTimer == 0 {
 		c.Network.AliveTimer = time.Second * 5
 	}
+	if c.Network.MaxMissed == 0 {
+		c.Network.MaxMissed = 5
+	}
 	if !c.Network.PeerOperDisabled {
 		c.local.mode |= FlagPeerOperational
 	}
@@ -168,78 +185,374 @@ func New(network *Network) (*IPSC, error) {
 	return c, nil
 }
 
-func (c *IPSC) Run() error {
-	var err error
-	if c.conn, err = net.ListenUDP("udp", c.local.addr); err != nil {
-		return err
-	}
+// Active returns true if the IPSC socket is active.
+func (c *IPSC) Active() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return !c.closed && c.conn != nil
+}
 
-	go c.peerMaintenance()
+// Close deregisters from the master and stops the listener.
+func (c *IPSC) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 
-	for {
-		var peer *net.UDPAddr
-		var n int
-		var b = make([]byte, 512)
-		if n, peer, err = c.conn.ReadFromUDP(b); err != nil {
-			log.Printf("error reading from %s: %v\n", peer, err)
+	if c.closed || c.conn == nil {
+		return nil
+	}
+
+	log.Info("closing")
+	deregister := c.hashedPacket(c.authKey, append([]byte{DeregistrationRequest}, c.local.radioID...))
+	for _, peer := range c.peers {
+		if !peer.status.connected {
 			continue
 		}
-
-		if c.Dump {
-			c.dump(peer, b[:n])
+		if err := c.sendTo(deregister, peer.addr); err != nil {
+			log.Errorf("de-registration with peer %d failed: %v\n", peer.radioID, err)
 		}
-		if !c.authenticate(b[:n]) {
-			log.Printf("authentication failed, dropping packet from %s\n", peer)
-			continue
+		peer.status.connected = false
+	}
+	if c.master.status.connected {
+		if err := c.sendToMaster(deregister); err != nil {
+			log.Errorf("de-registration failed: %v\n", err)
 		}
+		c.master.status.connected = false
+		c.master.status.peerList = false
+	}
+
+	// Kill keep-alive goroutine
+	if c.stop != nil {
+		close(c.stop)
+		c.stop = nil
+	}
 
-		go c.parse(peer, c.payload(b[:n]))
+	c.closed = true
+	return c.conn.Close()
+}
+
+// ListenAndServe registers with the master and handles incoming packets. If
+// the network is configured as master peer, it accepts peer registrations
+// instead.
+func (c *IPSC) ListenAndServe() error {
+	conn, err := net.ListenUDP("udp", c.local.addr)
+	if err != nil {
+		return err
 	}
 
+	c.mutex.Lock()
+	c.conn = conn
+	c.closed = false
+	c.stop = make(chan bool)
+	go c.peerMaintenance(c.stop)
+	c.mutex.Unlock()
+
+	var data = make([]byte, 512)
+	for {
+		n, peer, err := conn.ReadFromUDP(data)
+		if err != nil {
+			if !c.Active() && strings.HasSuffix(err.Error(), "use of closed network connection") {
+				break
+			}
+			return err
+		}
+
+		c.handle(peer, data[:n])
+	}
+
+	log.Info("listener closed")
 	return nil
 }
 
+// handle authenticates and parses a received packet.
+func (c *IPSC) handle(peer *net.UDPAddr, data []byte) {
+	if c.Dump {
+		c.dump(peer, data)
+	}
+	if !c.authenticate(data) {
+		log.Warningf("authentication failed, dropping packet from %s\n", peer)
+		return
+	}
+
+	// Packet type and peer ID
+	payload := c.payload(data)
+	if len(payload) < 5 {
+		return
+	}
+
+	if err := c.parse(peer, payload); err != nil {
+		log.Errorf("error parsing packet from %s: %v\n", peer, err)
+	}
+}
+
+// Run is an alias for ListenAndServe.
+func (c *IPSC) Run() error {
+	return c.ListenAndServe()
+}
+
+// Send a DMR packet to the IPSC network.
+func (c *IPSC) Send(p *dmr.Packet) error {
+	if !c.Active() {
+		return errors.New("ipsc: not active")
+	}
+
+	i, err := NewPacket(p, c.Network.RadioID)
+	if err != nil {
+		return err
+	}
+
+	// Keep track of the call sequence and RTP stream per timeslot
+	tx := &c.tx[p.Timeslot&0x01]
+	if tx.streamID != p.StreamID {
+		tx.streamID = p.StreamID
+		tx.sequence++
+	} else {
+		tx.rtpSeq++
+		tx.timestamp += RTPTimestampIncrement
+	}
+	i.Sequence = tx.sequence
+	i.RTP.Sequence = tx.rtpSeq
+	i.RTP.Timestamp = tx.timestamp
+	i.RTP.SSRC = p.StreamID
+
+	return c.sendToAll(c.hashedPacket(c.authKey, i.Bytes()))
+}
+
+func (c *IPSC) GetPacketFunc() dmr.PacketFunc {
+	return c.pf
+}
+
+func (c *IPSC) SetPacketFunc(f dmr.PacketFunc) {
+	c.pf = f
+}
+
 func (c *IPSC) authenticate(data []byte) bool {
 	if c.authKey == nil || len(c.authKey) == 0 {
 		return true
 	}
+	if len(data) < 10 {
+		return false
+	}
 
 	payload := c.payload(data)
 	hash := data[len(data)-10:]
 	mac := hmac.New(sha1.New, c.authKey)
 	mac.Write(payload)
-	return hmac.Equal(hash, mac.Sum(nil))
+	return hmac.Equal(hash, mac.Sum(nil)[:10])
 }
 
-func (c *IPSC) parse(peer *net.UDPAddr, data []byte) {
+func (c *IPSC) parse(peer *net.UDPAddr, data []byte) error {
 	packetType := data[0]
 	peerID := binary.BigEndian.Uint32(data[1:5])
 	//seq := data[5:6]
 
+	if c.Network.MasterPeer {
+		switch packetType {
+		case MasterRegistrationRequest, MasterAliveRequest, PeerListRequest:
+			return c.handleMaster(peer, peerID, packetType, data)
+		}
+	}
+
 	switch {
+	case AnyPeerRequired[packetType]:
+		if !c.validPeer(peerID) {
+			log.Debugf("%s: peer ID %d is not a registered peer\n", peer, peerID)
+			return nil
+		}
+
+		switch {
+		case UserGenerated[packetType]:
+			return c.handleUserPacket(data)
+
+		case packetType == DeregistrationRequest:
+			return c.handleDeregistration(peer, peerID)
+		}
+
+	case PeerRequired[packetType]:
+		if !c.validPeer(peerID) {
+			log.Debugf("%s: peer ID %d is not in the peer list\n", peer, peerID)
+			return nil
+		}
+
+		return c.handlePeer(peer, peerID, packetType, data)
+
 	case MasterRequired[packetType]:
 		if !c.validMaster(peerID) {
-			log.Printf("%s: peer ID %d is not a valid master, expected %d\n",
+			log.Warningf("%s: peer ID %d is not a valid master, expected %d\n",
 				peer, peerID, c.Network.MasterID)
-			return
+			return nil
 		}
 
 		switch packetType {
 		case MasterAliveReply:
+			c.mutex.Lock()
 			c.resetKeepAlive(peerID)
 			c.master.status.keepAliveReceived++
 			c.master.status.keepAliveRXTime = time.Now()
+			c.mutex.Unlock()
+
+		case PeerListReply:
+			return c.handlePeerList(data)
 		}
 
 	case packetType == MasterRegistrationReply:
+		if c.master.addr == nil || peer.String() != c.master.addr.String() {
+			log.Warningf("%s: ignored master registration reply, expected %s\n", peer, c.master.addr)
+			return nil
+		}
+		if c.Network.MasterID != 0 && peerID != c.Network.MasterID {
+			log.Warningf("%s: peer ID %d is not a valid master, expected %d\n",
+				peer, peerID, c.Network.MasterID)
+			return nil
+		}
+		if len(data) < 10 {
+			return fmt.Errorf("ipsc: master registration reply too short (%d bytes)", len(data))
+		}
+
 		// We have successfully registered to a master
+		c.mutex.Lock()
 		c.master.radioID = peerID
 		c.master.mode = data[5]
 		c.master.flags = data[6:10]
 		c.master.status.connected = true
+		c.master.status.peerList = false
 		c.master.status.keepAliveOutstanding = 0
-		log.Printf("registered to master %d\n", c.master.radioID)
+		c.mutex.Unlock()
+		log.Infof("registered to master %d\n", peerID)
+
+		// Request the list of peers, so we can register with them
+		return c.sendToMaster(c.hashedPacket(c.authKey, append([]byte{PeerListRequest}, c.local.radioID...)))
 	}
+
+	return nil
+}
+
+// handlePeer handles peer registration and keep-alive messages.
+func (c *IPSC) handlePeer(addr *net.UDPAddr, peerID uint32, packetType byte, data []byte) error {
+	c.mutex.Lock()
+	peer := c.peers[peerID]
+	if peer == nil {
+		c.mutex.Unlock()
+		return nil
+	}
+
+	var reply []byte
+	switch packetType {
+	case PeerRegistrationRequest:
+		log.Debugf("peer %d at %s registered with us\n", peerID, addr)
+		peer.addr = addr
+		reply = append([]byte{PeerRegistrationReply}, c.local.radioID...)
+		reply = append(reply, []byte{LinkTypeIPSC, Version17, LinkTypeIPSC, Version16}...)
+
+	case PeerRegistrationReply:
+		if !peer.status.connected {
+			log.Infof("registered to peer %d\n", peerID)
+		}
+		peer.status.connected = true
+		peer.status.keepAliveOutstanding = 0
+		peer.status.keepAliveRXTime = time.Now()
+
+	case PeerAliveRequest:
+		if len(data) >= 10 {
+			peer.mode = data[5]
+			copy(peer.flags, data[6:10])
+		}
+		peer.status.keepAliveRXTime = time.Now()
+		reply = append([]byte{PeerAliveReply}, c.local.radioID...)
+		reply = append(reply, c.local.tsFlags...)
+		reply = append(reply, []byte{LinkTypeIPSC, Version17, LinkTypeIPSC, Version16}...)
+
+	case PeerAliveReply:
+		c.resetKeepAlive(peerID)
+		peer.status.keepAliveReceived++
+		peer.status.keepAliveRXTime = time.Now()
+	}
+	c.mutex.Unlock()
+
+	if reply != nil {
+		return c.sendTo(c.hashedPacket(c.authKey, reply), addr)
+	}
+	return nil
+}
+
+// handlePeerList updates the peer table from a peer list reply.
+func (c *IPSC) handlePeerList(data []byte) error {
+	peers, err := parsePeerList(data[5:])
+	if err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var seen = map[uint32]bool{}
+	for _, peer := range peers {
+		if peer.radioID == c.Network.RadioID {
+			continue
+		}
+		seen[peer.radioID] = true
+		if known, ok := c.peers[peer.radioID]; ok {
+			known.mode = peer.mode
+			if known.addr.String() != peer.addr.String() {
+				// Peer moved, register again
+				known.addr = peer.addr
+				known.status = ipscPeerStatus{}
+			}
+			continue
+		}
+		log.Infof("new peer %d at %s\n", peer.radioID, peer.addr)
+		c.peers[peer.radioID] = peer
+	}
+	for radioID := range c.peers {
+		if !seen[radioID] {
+			log.Infof("peer %d left the network\n", radioID)
+			delete(c.peers, radioID)
+		}
+	}
+	c.master.status.peerList = true
+
+	return nil
+}
+
+// handleDeregistration handles a de-registration request from the master or a peer.
+func (c *IPSC) handleDeregistration(addr *net.UDPAddr, peerID uint32) error {
+	var changed bool
+	c.mutex.Lock()
+	if c.master.status.connected && c.validMaster(peerID) {
+		log.Warningf("de-registered by master %d\n", peerID)
+		c.master.status.connected = false
+		c.master.status.peerList = false
+	} else if _, ok := c.peers[peerID]; ok {
+		log.Infof("peer %d de-registered\n", peerID)
+		delete(c.peers, peerID)
+		changed = true
+	}
+	c.mutex.Unlock()
+
+	if err := c.sendTo(c.hashedPacket(c.authKey, append([]byte{DeregistrationReply}, c.local.radioID...)), addr); err != nil {
+		return err
+	}
+	if changed && c.Network.MasterPeer {
+		// Let the remaining peers know this peer has left
+		return c.sendPeerList()
+	}
+	return nil
+}
+
+// handleUserPacket decodes voice and data packets and passes them to the packet func.
+func (c *IPSC) handleUserPacket(data []byte) error {
+	p, err := ParsePacket(data)
+	if err != nil {
+		return err
+	}
+	if p.SlotType == IPSCSync {
+		// Sync frames carry no on-air data
+		return nil
+	}
+
+	if c.pf == nil {
+		return errors.New("ipsc: no PacketFunc defined to handle DMR packet")
+	}
+	return c.pf(c, p.DMRPacket())
 }
 
 func (c *IPSC) payload(data []byte) []byte {
@@ -263,15 +576,26 @@ func (c *IPSC) validMaster(peerID uint32) bool {
 	return c.master.radioID == peerID
 }
 
+func (c *IPSC) validPeer(peerID uint32) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.master.status.connected && c.validMaster(peerID) {
+		return true
+	}
+	_, ok := c.peers[peerID]
+	return ok
+}
+
 func (c *IPSC) dump(addr *net.UDPAddr, data []byte) {
 	if len(data) < 7 {
 		fmt.Printf("%d bytes of unreadable data from %s:\n", len(data), addr)
-		fmt.Printf(hex.Dump(data))
+		fmt.Print(hex.Dump(data))
 		return
 	}
 
 	fmt.Printf("%d bytes of data %s:\n", len(data), addr)
-	fmt.Printf(hex.Dump(data))
+	fmt.Print(hex.Dump(data))
 
 	packetType := data[0]
 	peerID := binary.BigEndian.Uint32(data[1:5])
@@ -338,20 +662,24 @@ func (c *IPSC) hashedPacket(key, data []byte) []byte {
 		return data
 	}
 
+	// The packet is suffixed with the first 10 bytes of the HMAC-SHA1 digest
 	mac := hmac.New(sha1.New, key)
 	mac.Write(data)
-
-	hash := make([]byte, 20)
-	hex.Encode(hash, mac.Sum(nil))
-
-	return append(data, hash...)
+	return append(data, mac.Sum(nil)[:10]...)
 }
 
-func (c *IPSC) peerMaintenance() {
+func (c *IPSC) peerMaintenance(stop <-chan bool) {
+	if c.Network.MasterPeer {
+		c.masterMaintenance(stop)
+		return
+	}
+
 	for {
 		var p []byte
+
+		c.mutex.Lock()
 		if c.master.status.connected {
-			log.Printf("sending keep-alive to master %d\n", c.master.radioID)
+			log.Debugf("sending keep-alive to master %d\n", c.master.radioID)
 			r := []byte{MasterAliveRequest}
 			r = append(r, c.local.radioID...)
 			r = append(r, c.local.tsFlags...)
@@ -360,41 +688,135 @@ func (c *IPSC) peerMaintenance() {
 
 			if c.master.status.keepAliveOutstanding > 0 {
 				c.master.status.keepAliveMissed++
-				log.Printf("%d outstanding keep-alives from master\n", c.master.status.keepAliveOutstanding)
+				log.Warningf("%d outstanding keep-alives from master\n", c.master.status.keepAliveOutstanding)
 			}
 			if c.master.status.keepAliveOutstanding > c.Network.MaxMissed {
 				c.master.status.connected = false
+				c.master.status.peerList = false
 				c.master.status.keepAliveOutstanding = 0
-				log.Printf("connection to master %d lost\n", c.master.radioID)
+				log.Errorf("connection to master %d lost\n", c.master.radioID)
+				c.mutex.Unlock()
 				continue
 			}
 
 			c.master.status.keepAliveSent++
 			c.master.status.keepAliveOutstanding++
 		} else {
-			log.Println("registering with master")
+			log.Info("registering with master")
 			r := []byte{MasterRegistrationRequest}
 			r = append(r, c.local.radioID...)
 			r = append(r, c.local.tsFlags...)
 			r = append(r, []byte{LinkTypeIPSC, Version17, LinkTypeIPSC, Version16}...)
 			p = c.hashedPacket(c.authKey, r)
 		}
+		var (
+			requestPeerList = c.master.status.connected && !c.master.status.peerList
+			peerPackets     = c.peerPackets()
+		)
+		c.mutex.Unlock()
 
 		if err := c.sendToMaster(p); err != nil {
-			log.Fatalf("error sending registration request to master: %v\n", err)
+			log.Errorf("error sending registration request to master: %v\n", err)
+		}
+		if requestPeerList {
+			if err := c.sendToMaster(c.hashedPacket(c.authKey, append([]byte{PeerListRequest}, c.local.radioID...))); err != nil {
+				log.Errorf("error sending peer list request to master: %v\n", err)
+			}
+		}
+		for addr, p := range peerPackets {
+			if err := c.sendTo(p, addr); err != nil {
+				log.Errorf("error sending to peer %s: %v\n", addr, err)
+			}
+		}
+
+		select {
+		case <-time.After(c.Network.AliveTimer):
+		case <-stop:
+			return
+		}
+	}
+}
+
+// masterMaintenance expires peers that stopped sending keep-alives.
+func (c *IPSC) masterMaintenance(stop <-chan bool) {
+	for {
+		select {
+		case <-time.After(c.Network.AliveTimer):
+		case <-stop:
 			return
 		}
 
-		time.Sleep(c.Network.AliveTimer)
+		if c.expirePeers() {
+			if err := c.sendPeerList(); err != nil {
+				log.Errorf("error sending peer list: %v\n", err)
+			}
+		}
 	}
 }
 
-func (c *IPSC) sendToMaster(data []byte) error {
+// peerPackets builds the registration and keep-alive requests for our peers,
+// the caller must hold the mutex.
+func (c *IPSC) peerPackets() map[*net.UDPAddr][]byte {
+	var packets = map[*net.UDPAddr][]byte{}
+	for _, peer := range c.peers {
+		var r []byte
+		if peer.status.connected {
+			if peer.status.keepAliveOutstanding > 0 {
+				peer.status.keepAliveMissed++
+				log.Warningf("%d outstanding keep-alives from peer %d\n", peer.status.keepAliveOutstanding, peer.radioID)
+			}
+			if peer.status.keepAliveOutstanding > c.Network.MaxMissed {
+				log.Errorf("connection to peer %d lost\n", peer.radioID)
+				peer.status.connected = false
+				peer.status.keepAliveOutstanding = 0
+			}
+		}
+
+		if peer.status.connected {
+			log.Debugf("sending keep-alive to peer %d\n", peer.radioID)
+			r = append([]byte{PeerAliveRequest}, c.local.radioID...)
+			r = append(r, c.local.tsFlags...)
+			r = append(r, []byte{LinkTypeIPSC, Version17, LinkTypeIPSC, Version16}...)
+			peer.status.keepAliveSent++
+			peer.status.keepAliveOutstanding++
+		} else {
+			log.Debugf("registering with peer %d\n", peer.radioID)
+			r = append([]byte{PeerRegistrationRequest}, c.local.radioID...)
+			r = append(r, []byte{LinkTypeIPSC, Version17, LinkTypeIPSC, Version16}...)
+		}
+		packets[peer.addr] = c.hashedPacket(c.authKey, r)
+	}
+	return packets
+}
+
+// sendToAll sends a packet to the master and all registered peers.
+func (c *IPSC) sendToAll(data []byte) error {
+	c.mutex.Lock()
+	var addrs []*net.UDPAddr
+	if c.master.addr != nil && c.master.status.connected {
+		addrs = append(addrs, c.master.addr)
+	}
+	for _, peer := range c.peers {
+		if peer.status.connected {
+			addrs = append(addrs, peer.addr)
+		}
+	}
+	c.mutex.Unlock()
+
+	for _, addr := range addrs {
+		if err := c.sendTo(data, addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *IPSC) sendTo(data []byte, addr *net.UDPAddr) error {
 	if c.Dump {
-		c.dump(c.master.addr, data)
+		c.dump(addr, data)
 	}
 	for len(data) > 0 {
-		n, err := c.conn.WriteToUDP(data, c.master.addr)
+		n, err := c.conn.WriteToUDP(data, addr)
 		if err != nil {
 			return err
 		}
@@ -402,3 +824,10 @@ func (c *IPSC) sendToMaster(data []byte) error {
 	}
 	return nil
 }
+
+func (c *IPSC) sendToMaster(data []byte) error {
+	return c.sendTo(data, c.master.addr)
+}
+
+// Interface compliance check
+var _ dmr.Repeater = (*IPSC)(nil)
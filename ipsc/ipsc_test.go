@@ -0,0 +1,102 @@
+package ipsc
+
+import (
+	"net"
+	"testing"
+
+	"github.com/pd0mz/go-dmr"
+)
+
+func testIPSC(t *testing.T, network *Network) *IPSC {
+	network.AuthKey = "0123456789"
+	network.Listen = "127.0.0.1:0"
+	c, err := New(network)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.conn, err = net.ListenUDP("udp", c.local.addr); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestHandleShortPacket(t *testing.T) {
+	c := testIPSC(t, &Network{RadioID: 1})
+	defer c.conn.Close()
+
+	// Authenticated, but too short to carry a peer ID
+	for n := 0; n < 5; n++ {
+		c.handle(&net.UDPAddr{}, c.hashedPacket(c.authKey, make([]byte, n)))
+	}
+}
+
+func TestHandleUserPacket(t *testing.T) {
+	var (
+		c        = testIPSC(t, &Network{RadioID: 1})
+		addr     = &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 50000}
+		received []*dmr.Packet
+	)
+	defer c.conn.Close()
+	c.SetPacketFunc(func(_ dmr.Repeater, p *dmr.Packet) error {
+		received = append(received, p)
+		return nil
+	})
+
+	i, err := NewPacket(testDMRPacket(dmr.VoiceLC, dmr.CallTypeGroup), 2)
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	data := c.hashedPacket(c.authKey, i.Bytes())
+
+	// Packets from unknown peers and with an invalid HMAC are ignored
+	c.handle(addr, data)
+	c.peers[2] = &ipscPeer{radioID: 2, addr: addr, flags: make([]byte, 4)}
+	corrupt := append([]byte{}, data...)
+	corrupt[len(corrupt)-1] ^= 0xff
+	c.handle(addr, corrupt)
+	if len(received) != 0 {
+		t.Fatalf("expected no packets, got %d", len(received))
+	}
+
+	c.handle(addr, data)
+	if len(received) != 1 {
+		t.Fatalf("expected 1 packet, got %d", len(received))
+	}
+	if p := received[0]; p.DataType != dmr.VoiceLC || p.SrcID != 2042214 || p.RepeaterID != 2 {
+		t.Fatalf("unexpected packet %+v", p)
+	}
+}
+
+func TestMasterRegistrationReply(t *testing.T) {
+	master, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer master.Close()
+
+	c := testIPSC(t, &Network{RadioID: 1, Master: master.LocalAddr().String(), MasterID: 100})
+	defer c.conn.Close()
+
+	reply := append([]byte{MasterRegistrationReply, 0, 0, 0, 100}, c.local.tsFlags...)
+	connected := func() bool {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		return c.master.status.connected
+	}
+
+	// Replies from other addresses or radio IDs are ignored
+	c.handle(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1}, c.hashedPacket(c.authKey, reply))
+	if connected() {
+		t.Fatal("registered by reply from another address")
+	}
+	other := append([]byte{MasterRegistrationReply, 0, 0, 0, 101}, c.local.tsFlags...)
+	c.handle(c.master.addr, c.hashedPacket(c.authKey, other))
+	if connected() {
+		t.Fatal("registered by reply from another master")
+	}
+
+	c.handle(c.master.addr, c.hashedPacket(c.authKey, reply))
+	if !connected() {
+		t.Fatal("not registered by reply from the master")
+	}
+}
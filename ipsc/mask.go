@@ -88,5 +88,5 @@ const (
 	RTPCSICMask    Mask = 0x0f
 	// Byte 2
 	RTPMRKRMask    Mask = 0x80
-	RTPPayTypeMask Mask = 0xf7
+	RTPPayTypeMask Mask = 0x7f
 )
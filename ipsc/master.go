@@ -0,0 +1,131 @@
+package ipsc
+
+import (
+	"encoding/binary"
+	"net"
+	"sort"
+	"time"
+)
+
+// handleMaster handles registration, keep-alive and peer list requests from
+// peers when we are the master peer.
+func (c *IPSC) handleMaster(addr *net.UDPAddr, peerID uint32, packetType byte, data []byte) error {
+	if peerID == c.Network.RadioID {
+		log.Warningf("%s: peer is using our radio ID %d\n", addr, peerID)
+		return nil
+	}
+
+	c.mutex.Lock()
+	peer, known := c.peers[peerID]
+	if !known && packetType != MasterRegistrationRequest {
+		c.mutex.Unlock()
+		log.Debugf("%s: peer ID %d is not registered\n", addr, peerID)
+		return nil
+	}
+
+	var (
+		reply   []byte
+		changed bool
+	)
+	switch packetType {
+	case MasterRegistrationRequest:
+		if !known {
+			peer = &ipscPeer{
+				radioID: peerID,
+				flags:   make([]byte, 4),
+			}
+			c.peers[peerID] = peer
+			log.Infof("peer %d at %s registered\n", peerID, addr)
+		}
+		if !known || !peer.status.connected || peer.addr.String() != addr.String() {
+			changed = true
+		}
+		peer.addr = addr
+		if len(data) >= 10 {
+			peer.mode = data[5]
+			copy(peer.flags, data[6:10])
+		}
+		peer.status.connected = true
+		peer.status.keepAliveOutstanding = 0
+		peer.status.keepAliveRXTime = time.Now()
+
+		var count = make([]byte, 2)
+		binary.BigEndian.PutUint16(count, uint16(len(c.peers)))
+		reply = append([]byte{MasterRegistrationReply}, c.local.radioID...)
+		reply = append(reply, c.local.tsFlags...)
+		reply = append(reply, count...)
+		reply = append(reply, []byte{LinkTypeIPSC, Version17, LinkTypeIPSC, Version16}...)
+
+	case MasterAliveRequest:
+		peer.addr = addr
+		peer.status.keepAliveReceived++
+		peer.status.keepAliveRXTime = time.Now()
+		reply = append([]byte{MasterAliveReply}, c.local.radioID...)
+		reply = append(reply, c.local.tsFlags...)
+		reply = append(reply, []byte{LinkTypeIPSC, Version17, LinkTypeIPSC, Version16}...)
+
+	case PeerListRequest:
+		reply = c.peerListReply()
+	}
+	c.mutex.Unlock()
+
+	if err := c.sendTo(c.hashedPacket(c.authKey, reply), addr); err != nil {
+		return err
+	}
+	if changed {
+		return c.sendPeerList()
+	}
+	return nil
+}
+
+// expirePeers removes peers that have not sent a keep-alive for MaxMissed
+// keep-alive intervals, returns true if the peer table has changed.
+func (c *IPSC) expirePeers() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var (
+		timeout = c.Network.AliveTimer * time.Duration(c.Network.MaxMissed+1)
+		changed bool
+	)
+	for radioID, peer := range c.peers {
+		if time.Since(peer.status.keepAliveRXTime) > timeout {
+			log.Warningf("peer %d timed out\n", radioID)
+			delete(c.peers, radioID)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// peerListReply builds a peer list reply, the caller must hold the mutex.
+func (c *IPSC) peerListReply() []byte {
+	var peers = make([]*ipscPeer, 0, len(c.peers))
+	for _, peer := range c.peers {
+		peers = append(peers, peer)
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i].radioID < peers[j].radioID })
+
+	reply := append([]byte{PeerListReply}, c.local.radioID...)
+	return append(reply, buildPeerList(peers)...)
+}
+
+// sendPeerList sends the current peer list to all registered peers.
+func (c *IPSC) sendPeerList() error {
+	c.mutex.Lock()
+	var (
+		data  = c.hashedPacket(c.authKey, c.peerListReply())
+		addrs = make([]*net.UDPAddr, 0, len(c.peers))
+	)
+	for _, peer := range c.peers {
+		addrs = append(addrs, peer.addr)
+	}
+	c.mutex.Unlock()
+
+	for _, addr := range addrs {
+		if err := c.sendTo(data, addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package ipsc
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func testNetwork(t *testing.T, network *Network) *IPSC {
+	network.AuthKey = "0123456789"
+	network.AliveTimer = 100 * time.Millisecond
+	network.MaxMissed = 2
+	c, err := New(network)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go c.ListenAndServe()
+	return c
+}
+
+func testWaitFor(t *testing.T, what string, cond func() bool) {
+	for deadline := time.Now().Add(3 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatalf("timeout waiting for %s", what)
+}
+
+func testPeerIDs(c *IPSC) []uint32 {
+	var ids []uint32
+	for _, peer := range c.Peers() {
+		if peer.Connected {
+			ids = append(ids, peer.RadioID)
+		}
+	}
+	return ids
+}
+
+func testEqualIDs(a []uint32, b ...uint32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestMaster(t *testing.T) {
+	// Find a free port for the master, the peers need to know where to register
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	listen := conn.LocalAddr().String()
+	conn.Close()
+
+	m := testNetwork(t, &Network{RadioID: 1, MasterPeer: true, Listen: listen})
+	defer m.Close()
+	testWaitFor(t, "master", m.Active)
+
+	a := testNetwork(t, &Network{RadioID: 2, Master: listen, Listen: "127.0.0.1:0"})
+	defer a.Close()
+	b := testNetwork(t, &Network{RadioID: 3, Master: listen, Listen: "127.0.0.1:0"})
+
+	// Both peers register with the master, and with each other through the peer list
+	testWaitFor(t, "registration", func() bool {
+		return testEqualIDs(testPeerIDs(m), 2, 3) &&
+			testEqualIDs(testPeerIDs(a), 3) &&
+			testEqualIDs(testPeerIDs(b), 2)
+	})
+
+	// Peer 3 disappears without de-registering, the master expires it after
+	// MaxMissed keep-alive intervals and distributes the new peer list
+	b.mutex.Lock()
+	close(b.stop)
+	b.stop = nil
+	b.closed = true
+	b.conn.Close()
+	b.mutex.Unlock()
+	testWaitFor(t, "peer expiry", func() bool {
+		return testEqualIDs(testPeerIDs(m), 2) && len(a.Peers()) == 0
+	})
+
+	// Peer 2 de-registers
+	a.Close()
+	testWaitFor(t, "de-registration", func() bool {
+		return len(m.Peers()) == 0
+	})
+}
@@ -1,7 +1,9 @@
 package ipsc
 
 import (
+	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	"fmt"
 
 	"github.com/pd0mz/go-dmr"
@@ -29,6 +31,28 @@ const (
 	CallTypeGroup
 )
 
+// Call info flags, byte 17 of user packets.
+const (
+	CallInfoTS2 uint8 = 0x20
+	CallInfoEnd uint8 = 0x40
+)
+
+// Sizes of the user packet parts.
+const (
+	HeaderSize  = 18
+	RTPSize     = 12
+	PayloadSize = 34
+	PacketSize  = HeaderSize + RTPSize + 2 + PayloadSize
+)
+
+// RTP payload types used in user packets.
+const (
+	RTPVersion            uint8 = 2
+	RTPPayloadVoice       uint8 = 0x5d
+	RTPPayloadTerminator  uint8 = 0x5e
+	RTPTimestampIncrement       = 480 // 60 ms at 8 kHz
+)
+
 var (
 	TimeslotName = map[uint8]string{
 		0x00: "TS1",
@@ -62,16 +86,270 @@ var (
 	}
 )
 
+// Mapping between IPSC slot types and DMR data types.
+var (
+	slotTypeDataType = map[uint16]uint8{
+		VoiceLCHeader:    dmr.VoiceLC,
+		TerminatorWithLC: dmr.TerminatorWithLC,
+		CSBK:             dmr.CSBK,
+		DataHeader:       dmr.Data,
+		Rate12Data:       dmr.Rate12Data,
+		Rate34Data:       dmr.Rate34Data,
+		VoiceDataA:       dmr.VoiceBurstA,
+		VoiceDataB:       dmr.VoiceBurstB,
+		VoiceDataC:       dmr.VoiceBurstC,
+		VoiceDataD:       dmr.VoiceBurstD,
+		VoiceDataE:       dmr.VoiceBurstE,
+		VoiceDataF:       dmr.VoiceBurstF,
+		IPSCSync:         dmr.IPSCSync,
+	}
+	dataTypeSlotType = map[uint8]uint16{}
+)
+
+func init() {
+	for slotType, dataType := range slotTypeDataType {
+		dataTypeSlotType[dataType] = slotType
+	}
+}
+
+// RTPHeader is the RTP header carried in user packets.
+type RTPHeader struct {
+	Version     uint8
+	Padding     bool
+	Extension   bool
+	CSRCCount   uint8
+	Marker      bool
+	PayloadType uint8
+	Sequence    uint16
+	Timestamp   uint32
+	SSRC        uint32
+}
+
+// Bytes packs the RTP header.
+func (h *RTPHeader) Bytes() []byte {
+	var data = make([]byte, RTPSize)
+	data[0] = (h.Version << 6) & uint8(RTPVersionMask)
+	if h.Padding {
+		data[0] |= uint8(RTPPadMask)
+	}
+	if h.Extension {
+		data[0] |= uint8(RTPExtMask)
+	}
+	data[0] |= h.CSRCCount & uint8(RTPCSICMask)
+	data[1] = h.PayloadType & uint8(RTPPayTypeMask)
+	if h.Marker {
+		data[1] |= uint8(RTPMRKRMask)
+	}
+	binary.BigEndian.PutUint16(data[2:], h.Sequence)
+	binary.BigEndian.PutUint32(data[4:], h.Timestamp)
+	binary.BigEndian.PutUint32(data[8:], h.SSRC)
+	return data
+}
+
+// ParseRTPHeader parses a packed RTP header.
+func ParseRTPHeader(data []byte) (*RTPHeader, error) {
+	if len(data) < RTPSize {
+		return nil, fmt.Errorf("ipsc: expected %d RTP header bytes, got %d", RTPSize, len(data))
+	}
+	return &RTPHeader{
+		Version:     (data[0] & uint8(RTPVersionMask)) >> 6,
+		Padding:     (data[0] & uint8(RTPPadMask)) > 0,
+		Extension:   (data[0] & uint8(RTPExtMask)) > 0,
+		CSRCCount:   (data[0] & uint8(RTPCSICMask)),
+		Marker:      (data[1] & uint8(RTPMRKRMask)) > 0,
+		PayloadType: (data[1] & uint8(RTPPayTypeMask)),
+		Sequence:    binary.BigEndian.Uint16(data[2:]),
+		Timestamp:   binary.BigEndian.Uint32(data[4:]),
+		SSRC:        binary.BigEndian.Uint32(data[8:]),
+	}, nil
+}
+
+// Packet is an IPSC user packet (voice or data). The layout is:
+//
+//	 0     packet type
+//	 1-4   peer ID
+//	 5     IPSC sequence number
+//	 6-8   source ID
+//	 9-11  destination ID
+//	12     call priority
+//	13-16  call control info (stream ID)
+//	17     call info (timeslot and call end flags)
+//	18-29  RTP header
+//	30-31  slot type
+//	32-65  burst payload with swapped byte pairs
 type Packet struct {
-	Timeslot  uint8 // 0=ts1, 1=ts2
-	FrameType uint8
-	SlotType  uint16
-	CallType  uint8 // 0=private, 1=group
-	SrcID     uint32
-	DstID     uint32
-	Payload   []byte // 34 bytes
-	Bits      []byte // 264 bits
-	Sequence  uint8
+	PacketType uint8
+	PeerID     uint32
+	Timeslot   uint8 // 0=ts1, 1=ts2
+	End        bool
+	FrameType  uint8
+	SlotType   uint16
+	CallType   uint8 // 0=private, 1=group
+	Priority   uint8
+	StreamID   uint32
+	SrcID      uint32
+	DstID      uint32
+	RTP        RTPHeader
+	Payload    []byte // 34 bytes
+	Bits       []byte // 264 bits
+	Sequence   uint8  // Incremented for each call
+}
+
+// ParsePacket parses an IPSC user packet.
+func ParsePacket(data []byte) (*Packet, error) {
+	if len(data) < PacketSize {
+		return nil, fmt.Errorf("ipsc: expected %d user packet bytes, got %d", PacketSize, len(data))
+	}
+	if !UserGenerated[data[0]] {
+		return nil, fmt.Errorf("ipsc: packet type %#02x is not a user packet", data[0])
+	}
+
+	rtp, err := ParseRTPHeader(data[HeaderSize:])
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Packet{
+		PacketType: data[0],
+		PeerID:     binary.BigEndian.Uint32(data[1:5]),
+		Sequence:   data[5],
+		SrcID:      uint32(data[6])<<16 | uint32(data[7])<<8 | uint32(data[8]),
+		DstID:      uint32(data[9])<<16 | uint32(data[10])<<8 | uint32(data[11]),
+		Priority:   data[12],
+		StreamID:   binary.BigEndian.Uint32(data[13:17]),
+		End:        (data[17] & CallInfoEnd) > 0,
+		RTP:        *rtp,
+		SlotType:   binary.BigEndian.Uint16(data[30:32]),
+		Payload:    make([]byte, PayloadSize),
+	}
+	if (data[17] & CallInfoTS2) > 0 {
+		p.Timeslot = 1
+	}
+	switch p.PacketType {
+	case GroupVoice, GroupData:
+		p.CallType = CallTypeGroup
+	default:
+		p.CallType = CallTypePrivate
+	}
+	if _, ok := slotTypeDataType[p.SlotType]; !ok {
+		return nil, fmt.Errorf("ipsc: unknown slot type %#04x", p.SlotType)
+	}
+	p.FrameType = frameType(slotTypeDataType[p.SlotType])
+
+	copy(p.Payload, data[32:32+PayloadSize])
+	var burst = make([]byte, PayloadSize)
+	copy(burst, p.Payload)
+	SwapPayloadBytes(burst)
+	p.Bits = dmr.BytesToBits(burst[:33])
+
+	return p, nil
+}
+
+// NewPacket converts a DMR packet to an IPSC user packet.
+func NewPacket(p *dmr.Packet, peerID uint32) (*Packet, error) {
+	if p == nil {
+		return nil, errors.New("ipsc: packet can't be nil")
+	}
+	slotType, ok := dataTypeSlotType[p.DataType]
+	if !ok {
+		return nil, fmt.Errorf("ipsc: unsupported data type %s (%d)", dmr.DataTypeName[p.DataType], p.DataType)
+	}
+
+	i := &Packet{
+		PeerID:    peerID,
+		Timeslot:  p.Timeslot,
+		End:       p.DataType == dmr.TerminatorWithLC,
+		FrameType: frameType(p.DataType),
+		SlotType:  slotType,
+		CallType:  p.CallType,
+		StreamID:  p.StreamID,
+		SrcID:     p.SrcID,
+		DstID:     p.DstID,
+		Payload:   make([]byte, PayloadSize),
+		Bits:      make([]byte, 264),
+		RTP: RTPHeader{
+			Version:     RTPVersion,
+			PayloadType: RTPPayloadVoice,
+			Sequence:    uint16(p.Sequence),
+		},
+	}
+	switch p.DataType {
+	case dmr.VoiceLC, dmr.TerminatorWithLC, dmr.VoiceBurstA, dmr.VoiceBurstB, dmr.VoiceBurstC, dmr.VoiceBurstD, dmr.VoiceBurstE, dmr.VoiceBurstF:
+		i.PacketType = PVTVoice
+		if p.CallType == dmr.CallTypeGroup {
+			i.PacketType = GroupVoice
+		}
+	default:
+		i.PacketType = PVTData
+		if p.CallType == dmr.CallTypeGroup {
+			i.PacketType = GroupData
+		}
+	}
+	switch p.DataType {
+	case dmr.VoiceLC, dmr.Data:
+		i.RTP.Marker = true
+	case dmr.TerminatorWithLC:
+		i.RTP.PayloadType = RTPPayloadTerminator
+	}
+
+	copy(i.Payload, p.Data)
+	copy(i.Bits, p.Bits)
+	SwapPayloadBytes(i.Payload)
+	return i, nil
+}
+
+// Bytes packs the user packet.
+func (p *Packet) Bytes() []byte {
+	var data = make([]byte, PacketSize)
+	data[0] = p.PacketType
+	binary.BigEndian.PutUint32(data[1:5], p.PeerID)
+	data[5] = p.Sequence
+	data[6] = uint8(p.SrcID >> 16)
+	data[7] = uint8(p.SrcID >> 8)
+	data[8] = uint8(p.SrcID)
+	data[9] = uint8(p.DstID >> 16)
+	data[10] = uint8(p.DstID >> 8)
+	data[11] = uint8(p.DstID)
+	data[12] = p.Priority
+	binary.BigEndian.PutUint32(data[13:17], p.StreamID)
+	if p.Timeslot == 1 {
+		data[17] |= CallInfoTS2
+	}
+	if p.End {
+		data[17] |= CallInfoEnd
+	}
+	copy(data[HeaderSize:], p.RTP.Bytes())
+	binary.BigEndian.PutUint16(data[30:32], p.SlotType)
+	copy(data[32:], p.Payload)
+	return data
+}
+
+// DMRPacket converts the user packet to a DMR packet.
+func (p *Packet) DMRPacket() *dmr.Packet {
+	var d = &dmr.Packet{
+		Timeslot:   p.Timeslot,
+		Sequence:   uint8(p.RTP.Sequence),
+		SrcID:      p.SrcID,
+		DstID:      p.DstID,
+		RepeaterID: p.PeerID,
+		StreamID:   p.StreamID,
+		DataType:   slotTypeDataType[p.SlotType],
+		CallType:   p.CallType,
+	}
+	d.SetData(dmr.BitsToBytes(p.Bits))
+	return d
+}
+
+// frameType returns the frame type (voice, voice sync or data sync) for the DMR data type.
+func frameType(dataType uint8) uint8 {
+	switch dataType {
+	case dmr.VoiceBurstA:
+		return 0x01
+	case dmr.VoiceBurstB, dmr.VoiceBurstC, dmr.VoiceBurstD, dmr.VoiceBurstE, dmr.VoiceBurstF:
+		return 0x00
+	default:
+		return 0x02
+	}
 }
 
 func (p *Packet) Dump() string {
@@ -0,0 +1,103 @@
+package ipsc
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pd0mz/go-dmr"
+)
+
+func TestRTPHeader(t *testing.T) {
+	want := &RTPHeader{
+		Version:     RTPVersion,
+		Marker:      true,
+		PayloadType: RTPPayloadVoice,
+		Sequence:    0x1234,
+		Timestamp:   0xdeadbeef,
+		SSRC:        0x01020304,
+	}
+
+	test, err := ParseRTPHeader(want.Bytes())
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if *test != *want {
+		t.Fatalf("decode failed: expected %+v, got %+v", want, test)
+	}
+
+	if _, err = ParseRTPHeader(want.Bytes()[:RTPSize-1]); err == nil {
+		t.Fatal("decode of truncated RTP header did not fail")
+	}
+}
+
+func testDMRPacket(dataType, callType uint8) *dmr.Packet {
+	p := &dmr.Packet{
+		Timeslot: 1,
+		Sequence: 5,
+		SrcID:    2042214,
+		DstID:    2043044,
+		StreamID: 0x12345678,
+		DataType: dataType,
+		CallType: callType,
+	}
+	var data = make([]byte, 33)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	p.SetData(data)
+	return p
+}
+
+func TestPacket(t *testing.T) {
+	for dataType := range dataTypeSlotType {
+		for _, callType := range []uint8{dmr.CallTypePrivate, dmr.CallTypeGroup} {
+			want := testDMRPacket(dataType, callType)
+			i, err := NewPacket(want, 1234)
+			if err != nil {
+				t.Fatalf("encode failed: %v", err)
+			}
+			data := i.Bytes()
+			if len(data) != PacketSize {
+				t.Fatalf("encode failed: expected %d bytes, got %d", PacketSize, len(data))
+			}
+
+			test, err := ParsePacket(data)
+			if err != nil {
+				t.Fatalf("decode failed: %v", err)
+			}
+			switch {
+			case test.PeerID != 1234:
+				t.Fatalf("decode failed: peer ID wrong, got %d", test.PeerID)
+			case test.SlotType != i.SlotType || test.FrameType != frameType(dataType):
+				t.Fatalf("decode failed: slot type wrong, got %#04x", test.SlotType)
+			case test.End != (dataType == dmr.TerminatorWithLC):
+				t.Fatalf("decode failed: call end wrong for %s", dmr.DataTypeName[dataType])
+			case test.RTP != i.RTP:
+				t.Fatalf("decode failed: RTP header wrong, got %+v", test.RTP)
+			}
+
+			p := test.DMRPacket()
+			switch {
+			case p.Timeslot != want.Timeslot:
+				t.Fatalf("decode failed: timeslot wrong, got %d", p.Timeslot)
+			case p.SrcID != want.SrcID || p.DstID != want.DstID:
+				t.Fatalf("decode failed: expected %d->%d, got %d->%d", want.SrcID, want.DstID, p.SrcID, p.DstID)
+			case p.StreamID != want.StreamID:
+				t.Fatalf("decode failed: stream ID wrong, got %#08x", p.StreamID)
+			case p.DataType != dataType:
+				t.Fatalf("decode failed: expected %s, got %s", dmr.DataTypeName[dataType], dmr.DataTypeName[p.DataType])
+			case p.CallType != callType:
+				t.Fatalf("decode failed: call type wrong, got %d", p.CallType)
+			case !bytes.Equal(p.Data, want.Data):
+				t.Fatalf("decode failed: data wrong for %s", dmr.DataTypeName[dataType])
+			}
+		}
+	}
+
+	if _, err := ParsePacket(make([]byte, PacketSize-1)); err == nil {
+		t.Fatal("decode of truncated packet did not fail")
+	}
+	if _, err := NewPacket(testDMRPacket(dmr.Idle, dmr.CallTypeGroup), 1234); err == nil {
+		t.Fatal("encode of idle burst did not fail")
+	}
+}
@@ -0,0 +1,129 @@
+package ipsc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sort"
+	"time"
+)
+
+// PeerListEntrySize is the size of a single peer in a peer list reply.
+const PeerListEntrySize = 11
+
+// Peer is a snapshot of the state of a peer in the IPSC network.
+type Peer struct {
+	RadioID   uint32
+	Addr      *net.UDPAddr
+	Mode      byte
+	Flags     []byte
+	Connected bool
+
+	KeepAliveSent     int
+	KeepAliveReceived int
+	KeepAliveMissed   int
+	LastSeen          time.Time
+}
+
+type ipscPeer struct {
+	radioID uint32
+	addr    *net.UDPAddr
+	mode    byte
+	flags   []byte
+	status  ipscPeerStatus
+}
+
+func (p *ipscPeer) Peer() Peer {
+	var flags = make([]byte, len(p.flags))
+	copy(flags, p.flags)
+	return Peer{
+		RadioID:           p.radioID,
+		Addr:              p.addr,
+		Mode:              p.mode,
+		Flags:             flags,
+		Connected:         p.status.connected,
+		KeepAliveSent:     p.status.keepAliveSent,
+		KeepAliveReceived: p.status.keepAliveReceived,
+		KeepAliveMissed:   p.status.keepAliveMissed,
+		LastSeen:          p.status.keepAliveRXTime,
+	}
+}
+
+// Peers returns a snapshot of the current peer table, ordered by radio ID.
+func (c *IPSC) Peers() []Peer {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var peers = make([]Peer, 0, len(c.peers))
+	for _, peer := range c.peers {
+		peers = append(peers, peer.Peer())
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i].RadioID < peers[j].RadioID })
+	return peers
+}
+
+// Peer returns a snapshot of the peer with the given radio ID.
+func (c *IPSC) Peer(radioID uint32) (Peer, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	peer, ok := c.peers[radioID]
+	if !ok {
+		return Peer{}, false
+	}
+	return peer.Peer(), true
+}
+
+// parsePeerList decodes the peer list in a peer list reply, the data should
+// start at the peer list length field.
+//
+// Each peer is encoded as:
+//
+//	0-3  radio ID
+//	4-7  IPv4 address
+//	8-9  UDP port
+//	10   mode
+func parsePeerList(data []byte) ([]*ipscPeer, error) {
+	if len(data) < 2 {
+		return nil, fmt.Errorf("ipsc: peer list too short (%d bytes)", len(data))
+	}
+	size := int(binary.BigEndian.Uint16(data[:2]))
+	data = data[2:]
+	if size%PeerListEntrySize != 0 || size > len(data) {
+		return nil, fmt.Errorf("ipsc: invalid peer list length %d", size)
+	}
+
+	var peers = make([]*ipscPeer, 0, size/PeerListEntrySize)
+	for i := 0; i < size; i += PeerListEntrySize {
+		entry := data[i : i+PeerListEntrySize]
+		peers = append(peers, &ipscPeer{
+			radioID: binary.BigEndian.Uint32(entry[0:4]),
+			addr: &net.UDPAddr{
+				IP:   net.IPv4(entry[4], entry[5], entry[6], entry[7]),
+				Port: int(binary.BigEndian.Uint16(entry[8:10])),
+			},
+			mode:  entry[10],
+			flags: make([]byte, 4),
+		})
+	}
+	return peers, nil
+}
+
+// buildPeerList encodes a peer list, including the peer list length field.
+func buildPeerList(peers []*ipscPeer) []byte {
+	var data = make([]byte, 2, 2+len(peers)*PeerListEntrySize)
+	for _, peer := range peers {
+		var entry = make([]byte, PeerListEntrySize)
+		binary.BigEndian.PutUint32(entry[0:4], peer.radioID)
+		if peer.addr != nil {
+			if ip := peer.addr.IP.To4(); ip != nil {
+				copy(entry[4:8], ip)
+			}
+			binary.BigEndian.PutUint16(entry[8:10], uint16(peer.addr.Port))
+		}
+		entry[10] = peer.mode
+		data = append(data, entry...)
+	}
+	binary.BigEndian.PutUint16(data[:2], uint16(len(data)-2))
+	return data
+}
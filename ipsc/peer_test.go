@@ -0,0 +1,187 @@
+package ipsc
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestPeerList(t *testing.T) {
+	var peers = []*ipscPeer{
+		{radioID: 2042214, addr: &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 50000}, mode: 0x6a},
+		{radioID: 2043044, addr: &net.UDPAddr{IP: net.IPv4(192, 0, 2, 2), Port: 62030}, mode: 0x65},
+	}
+
+	data := buildPeerList(peers)
+	if len(data) != 2+len(peers)*PeerListEntrySize {
+		t.Fatalf("encode failed: expected %d bytes, got %d", 2+len(peers)*PeerListEntrySize, len(data))
+	}
+
+	parsed, err := parsePeerList(data)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if len(parsed) != len(peers) {
+		t.Fatalf("decode failed: expected %d peers, got %d", len(peers), len(parsed))
+	}
+	for i, peer := range parsed {
+		if peer.radioID != peers[i].radioID {
+			t.Fatalf("decode failed: expected radio ID %d, got %d", peers[i].radioID, peer.radioID)
+		}
+		if peer.addr.String() != peers[i].addr.String() {
+			t.Fatalf("decode failed: expected address %s, got %s", peers[i].addr, peer.addr)
+		}
+		if peer.mode != peers[i].mode {
+			t.Fatalf("decode failed: expected mode %#02x, got %#02x", peers[i].mode, peer.mode)
+		}
+	}
+
+	if _, err := parsePeerList(data[:len(data)-1]); err == nil {
+		t.Fatal("decode of truncated peer list did not fail")
+	}
+}
+
+func testPeerConn(t *testing.T) *net.UDPConn {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func testPeerRecv(t *testing.T, c *IPSC, conn *net.UDPConn) []byte {
+	var data = make([]byte, 512)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := conn.ReadFromUDP(data)
+	if err != nil {
+		t.Fatalf("expected a reply: %v", err)
+	}
+	if !c.authenticate(data[:n]) {
+		t.Fatal("reply failed authentication")
+	}
+	return c.payload(data[:n])
+}
+
+func TestPeerKeepAlive(t *testing.T) {
+	c := testIPSC(t, &Network{RadioID: 1, MaxMissed: 2})
+	defer c.conn.Close()
+
+	conn := testPeerConn(t)
+	defer conn.Close()
+	addr := conn.LocalAddr().(*net.UDPAddr)
+	c.peers[2] = &ipscPeer{radioID: 2, addr: addr, flags: make([]byte, 4)}
+
+	request := func(packetType byte) []byte {
+		r := append([]byte{packetType, 0, 0, 0, 2}, c.local.tsFlags...)
+		return c.hashedPacket(c.authKey, append(r, []byte{LinkTypeIPSC, Version17, LinkTypeIPSC, Version16}...))
+	}
+
+	// Not connected, so we register
+	packets := c.peerPackets()
+	if p := packets[addr]; p == nil || p[0] != PeerRegistrationRequest {
+		t.Fatalf("expected registration request, got %v", packets)
+	}
+
+	// The peer registers with us
+	c.handle(addr, request(PeerRegistrationRequest))
+	if reply := testPeerRecv(t, c, conn); reply[0] != PeerRegistrationReply {
+		t.Fatalf("expected registration reply, got %#02x", reply[0])
+	}
+
+	// The peer accepts our registration
+	c.handle(addr, request(PeerRegistrationReply))
+	if peer, _ := c.Peer(2); !peer.Connected {
+		t.Fatal("peer not connected after registration reply")
+	}
+
+	// Keep-alive requests are answered
+	c.handle(addr, request(PeerAliveRequest))
+	if reply := testPeerRecv(t, c, conn); reply[0] != PeerAliveReply {
+		t.Fatalf("expected keep-alive reply, got %#02x", reply[0])
+	}
+
+	// Keep-alive replies reset the outstanding counter
+	for i := 0; i < c.Network.MaxMissed; i++ {
+		if p := c.peerPackets()[addr]; p[0] != PeerAliveRequest {
+			t.Fatalf("expected keep-alive request, got %#02x", p[0])
+		}
+	}
+	c.handle(addr, request(PeerAliveReply))
+	peer, _ := c.Peer(2)
+	if peer.KeepAliveReceived != 1 || c.peers[2].status.keepAliveOutstanding != 0 {
+		t.Fatalf("keep-alive reply not accounted: %+v", peer)
+	}
+
+	// After MaxMissed unanswered keep-alives, the peer is considered lost
+	for i := 0; i <= c.Network.MaxMissed; i++ {
+		if p := c.peerPackets()[addr]; p[0] != PeerAliveRequest {
+			t.Fatalf("expected keep-alive request, got %#02x", p[0])
+		}
+	}
+	if p := c.peerPackets()[addr]; p[0] != PeerRegistrationRequest {
+		t.Fatalf("expected registration request after missed keep-alives, got %#02x", p[0])
+	}
+	if peer, _ := c.Peer(2); peer.Connected || peer.KeepAliveMissed != c.Network.MaxMissed*2 {
+		t.Fatalf("peer not lost after missed keep-alives: %+v", peer)
+	}
+
+	// Packets from peers we don't know about are ignored
+	c.handle(addr, c.hashedPacket(c.authKey, []byte{PeerRegistrationRequest, 0, 0, 0, 3}))
+	conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, _, err := conn.ReadFromUDP(make([]byte, 512)); err == nil {
+		t.Fatal("unexpected reply to unknown peer")
+	}
+}
+
+func TestHandlePeerList(t *testing.T) {
+	c := testIPSC(t, &Network{RadioID: 1})
+	defer c.conn.Close()
+
+	var (
+		addr2 = &net.UDPAddr{IP: net.IPv4(192, 0, 2, 2), Port: 50000}
+		addr3 = &net.UDPAddr{IP: net.IPv4(192, 0, 2, 3), Port: 50000}
+		addr4 = &net.UDPAddr{IP: net.IPv4(192, 0, 2, 4), Port: 50000}
+	)
+	reply := func(peers ...*ipscPeer) []byte {
+		return append([]byte{PeerListReply, 0, 0, 0, 100}, buildPeerList(peers)...)
+	}
+
+	// New peers are added, we are skipped
+	if err := c.handlePeerList(reply(
+		&ipscPeer{radioID: 1, addr: c.local.addr},
+		&ipscPeer{radioID: 2, addr: addr2, mode: 0x6a},
+		&ipscPeer{radioID: 3, addr: addr3, mode: 0x6a},
+	)); err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if peers := c.Peers(); len(peers) != 2 || peers[0].RadioID != 2 || peers[1].RadioID != 3 {
+		t.Fatalf("expected peers 2 and 3, got %+v", peers)
+	}
+	if !c.master.status.peerList {
+		t.Fatal("peer list not marked as received")
+	}
+	c.peers[2].status.connected = true
+	c.peers[3].status.connected = true
+
+	// Peer 2 left, peer 3 moved and peer 4 joined
+	if err := c.handlePeerList(reply(
+		&ipscPeer{radioID: 3, addr: addr4, mode: 0x65},
+		&ipscPeer{radioID: 4, addr: addr4, mode: 0x6a},
+	)); err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if _, ok := c.Peer(2); ok {
+		t.Fatal("peer 2 was not removed")
+	}
+	peer, ok := c.Peer(3)
+	if !ok || peer.Addr.String() != addr4.String() || peer.Mode != 0x65 || peer.Connected {
+		t.Fatalf("peer 3 was not moved: %+v", peer)
+	}
+	if _, ok := c.Peer(4); !ok {
+		t.Fatal("peer 4 was not added")
+	}
+
+	if err := c.handlePeerList([]byte{PeerListReply, 0, 0, 0, 100, 0}); err == nil {
+		t.Fatal("decode of truncated peer list did not fail")
+	}
+}
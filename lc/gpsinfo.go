@@ -2,6 +2,7 @@ package lc
 
 import (
 	"fmt"
+	"math"
 
 	dmr "github.com/pd0mz/go-dmr"
 )
@@ -64,6 +65,27 @@ func (g *GpsInfoPDU) Bytes() []byte {
 	}
 }
 
+// NewGpsInfoPDU builds the GPS info from the latitude and longitude in
+// degrees, positive is north and east respectively.
+func NewGpsInfoPDU(lat, lon float64, positionError uint8) *GpsInfoPDU {
+	return &GpsInfoPDU{
+		PositionError: positionError,
+		Latitude:      uint32(int32(math.Floor(lat*(1<<24)/180+0.5))) & 0xffffff,
+		Longitude:     uint32(int32(math.Floor(lon*(1<<25)/360+0.5))) & 0x1ffffff,
+	}
+}
+
+// Coordinates returns the latitude and longitude in degrees, positive is north
+// and east respectively.
+func (g *GpsInfoPDU) Coordinates() (float64, float64) {
+	var (
+		// Two's complement, 24 bits latitude and 25 bits longitude
+		lat = int32(g.Latitude<<8) >> 8
+		lon = int32(g.Longitude<<7) >> 7
+	)
+	return float64(lat) * 180 / (1 << 24), float64(lon) * 360 / (1 << 25)
+}
+
 func (g *GpsInfoPDU) String() string {
 	return fmt.Sprintf("GpsInfo: [ error: %s lon: %d lat: %d ]",
 		PositionErrorName[g.PositionError], g.Longitude, g.Latitude)
@@ -6,6 +6,7 @@ import (
 
 	"github.com/pd0mz/go-dmr"
 	"github.com/pd0mz/go-dmr/fec"
+	"github.com/pd0mz/go-dmr/vbptc"
 )
 
 // Full Link Control Opcode
@@ -60,6 +61,36 @@ func (lc *LC) Bytes() []byte {
 	return append(lcHeader, innerPdu...)
 }
 
+// FullBytes packs the Link Control message with the Reed-Solomon (12,9) check
+// data, the inverse of ParseFullLC. The CRC mask is not applied.
+func (lc *LC) FullBytes() []byte {
+	data := lc.Bytes()
+	return append(data, fec.RS_12_9_CalcChecksum(data)...)
+}
+
+// EmbeddedFragments packs the Link Control message to the four 32-bit embedded
+// signalling fragments carried in voice bursts B to E.
+func (lc *LC) EmbeddedFragments() ([][]byte, error) {
+	eslc, err := dmr.NewEmbeddedSignallingLC(lc.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	var v = vbptc.New(8)
+	if err = v.SetData(eslc.Interleave()); err != nil {
+		return nil, err
+	}
+
+	var fragments = make([][]byte, 4)
+	for i := range fragments {
+		fragments[i] = make([]byte, dmr.EMBSignallingLCFragmentBits)
+		if err = v.GetBurst(fragments[i]); err != nil {
+			return nil, err
+		}
+	}
+	return fragments, nil
+}
+
 func (lc *LC) String() string {
 	var (
 		header = fmt.Sprintf("opcode %d, call type %s, feature set id %d",
@@ -163,7 +194,7 @@ func ParseFullLC(data []byte) (*LC, error) {
 	if err := fec.RS_12_9_CalcSyndrome(data, syndrome); err != nil {
 		return nil, err
 	}
-	if !fec.RS_12_9_CheckSyndrome(syndrome) {
+	if fec.RS_12_9_CheckSyndrome(syndrome) {
 		if _, err := fec.RS_12_9_Correct(data, syndrome); err != nil {
 			return nil, err
 		}
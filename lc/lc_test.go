@@ -0,0 +1,89 @@
+package lc
+
+import (
+	"testing"
+
+	"github.com/pd0mz/go-dmr"
+	"github.com/pd0mz/go-dmr/vbptc"
+)
+
+func TestFullLC(t *testing.T) {
+	want := &LC{
+		Opcode: GroupVoiceChannelUser,
+		VoiceChannelUser: &VoiceChannelUserPDU{
+			DstID: 9,
+			SrcID: 2042214,
+		},
+	}
+	data := want.FullBytes()
+	if len(data) != 12 {
+		t.Fatalf("expected 12 bytes, got %d", len(data))
+	}
+
+	// A single corrupted octet is corrected
+	for i := 0; i < len(data); i++ {
+		test := make([]byte, len(data))
+		copy(test, data)
+		test[i] ^= 0x5a
+
+		got, err := ParseFullLC(test)
+		if err != nil {
+			t.Fatalf("decode failed: %v", err)
+		}
+		if got.Opcode != want.Opcode || got.VoiceChannelUser == nil ||
+			got.VoiceChannelUser.DstID != want.VoiceChannelUser.DstID ||
+			got.VoiceChannelUser.SrcID != want.VoiceChannelUser.SrcID {
+			t.Fatalf("octet %d corrupted: expected %s, got %s", i, want, got)
+		}
+	}
+}
+
+func TestEmbeddedFragments(t *testing.T) {
+	want := &LC{
+		Opcode: UnitToUnitVoiceChannelUser,
+		VoiceChannelUser: &VoiceChannelUserPDU{
+			DstID: 2042215,
+			SrcID: 2042214,
+		},
+	}
+	fragments, err := want.EmbeddedFragments()
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	if len(fragments) != 4 {
+		t.Fatalf("expected 4 fragments, got %d", len(fragments))
+	}
+
+	// A single bit error is repaired
+	fragments[2][3] ^= 1
+
+	var v = vbptc.New(8)
+	for _, fragment := range fragments {
+		if err = v.AddBurst(fragment); err != nil {
+			t.Fatalf("decode failed: %v", err)
+		}
+	}
+	if err = v.CheckAndRepair(); err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	var bits = make([]byte, 77)
+	if err = v.GetData(bits); err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	eslc, err := dmr.DeinterleaveEmbeddedSignallingLC(bits)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if !eslc.Check() {
+		t.Fatal("decode failed: checksum error")
+	}
+	got, err := ParseLC(dmr.BitsToBytes(eslc.Bits))
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if got.Opcode != want.Opcode || got.VoiceChannelUser == nil ||
+		got.VoiceChannelUser.DstID != want.VoiceChannelUser.DstID ||
+		got.VoiceChannelUser.SrcID != want.VoiceChannelUser.SrcID {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+}
@@ -2,6 +2,7 @@ package lc
 
 import (
 	"fmt"
+	"unicode/utf16"
 
 	dmr "github.com/pd0mz/go-dmr"
 )
@@ -40,7 +41,7 @@ func movebit(src []byte, srcByte int, srcBit int, dst []byte, dstByte int, dstBi
 	if bit >= 1 {
 		dst[dstByte] |= 1 << uint8(dstBit)
 	} else {
-		dst[dstByte] &= 0 << uint8(dstBit)
+		dst[dstByte] &^= 1 << uint8(dstBit)
 	}
 }
 
@@ -61,7 +62,7 @@ func ParseTalkerAliasHeaderPDU(data []byte) (*TalkerAliasHeaderPDU, error) {
 			movebit(data, i/8, (7 - (i % 8)), out, (i-7)/7, 6-(i%7))
 		}
 	} else {
-		out = data[1:6]
+		out = data[1:7]
 	}
 
 	return &TalkerAliasHeaderPDU{
@@ -79,10 +80,13 @@ func (t *TalkerAliasHeaderPDU) Bytes() []byte {
 	)
 
 	if t.DataFormat == Format7Bit {
-		out = make([]byte, 6)
+		// The first alias bit is the last bit of the first octet
+		var packed = make([]byte, 7)
 		for i := 7; i < 56; i++ {
-			movebit(t.Data, (i-7)/7, 6-(i%7), out, (i/8)-1, (7 - (i % 8)))
+			movebit(t.Data, (i-7)/7, 6-(i%7), packed, i/8, (7 - (i % 8)))
 		}
+		bit49 = packed[0]
+		out = packed[1:]
 	} else {
 		out = t.Data
 	}
@@ -115,7 +119,7 @@ func ParseTalkerAliasBlockPDU(data []byte) (*TalkerAliasBlockPDU, error) {
 	}
 
 	return &TalkerAliasBlockPDU{
-		Data: data[0:6],
+		Data: data[0:7],
 	}, nil
 }
 
@@ -132,3 +136,121 @@ func (t *TalkerAliasBlockPDU) DataAsString() string {
 func (t *TalkerAliasBlockPDU) String() string {
 	return fmt.Sprintf("TalkerAliasBlock: [ data: \"%s\" ]", t.DataAsString())
 }
+
+// talkerAliasBits is the number of bits per character for each data format.
+var talkerAliasBits = map[uint8]int{
+	Format7Bit:    7,
+	FormatISO8Bit: 8,
+	FormatUTF8:    8,
+	FormatUTF16BE: 16,
+}
+
+// TalkerAliasBlocks returns the number of blocks following the header.
+func (t *TalkerAliasHeaderPDU) TalkerAliasBlocks() int {
+	var (
+		bits   = int(t.Length) * talkerAliasBits[t.DataFormat]
+		header = 48
+	)
+	if t.DataFormat == Format7Bit {
+		header = 49
+	}
+	if bits <= header {
+		return 0
+	}
+	return (bits - header + 55) / 56
+}
+
+// TalkerAlias assembles the talker alias from the header and blocks, it
+// returns false if any of the required blocks is missing.
+func TalkerAlias(header *TalkerAliasHeaderPDU, blocks [3]*TalkerAliasBlockPDU) (string, bool) {
+	if header == nil {
+		return "", false
+	}
+
+	var data = append([]byte{}, header.Data...)
+	for i := 0; i < header.TalkerAliasBlocks(); i++ {
+		if i >= len(blocks) || blocks[i] == nil {
+			return "", false
+		}
+		if header.DataFormat == Format7Bit {
+			// 56 bits are 8 characters
+			var out = make([]byte, 8)
+			for j := 0; j < 56; j++ {
+				movebit(blocks[i].Data, j/8, 7-(j%8), out, j/7, 6-(j%7))
+			}
+			data = append(data, out...)
+		} else {
+			data = append(data, blocks[i].Data...)
+		}
+	}
+
+	var runes []rune
+	switch header.DataFormat {
+	case Format7Bit, FormatISO8Bit:
+		for _, b := range data {
+			runes = append(runes, rune(b))
+		}
+	case FormatUTF8:
+		runes = []rune(string(data))
+	case FormatUTF16BE:
+		var units = make([]uint16, len(data)/2)
+		for i := range units {
+			units[i] = uint16(data[i*2])<<8 | uint16(data[i*2+1])
+		}
+		runes = utf16.Decode(units)
+	}
+	if len(runes) > int(header.Length) {
+		runes = runes[:header.Length]
+	}
+	return string(runes), true
+}
+
+// TalkerAliasLC builds the talker alias header and block Link Control messages
+// for the alias. Aliases that don't fit ISO 8 bit are sent as UTF-16BE, the
+// alias is truncated to what fits in the header and three blocks.
+func TalkerAliasLC(alias string) []*LC {
+	var (
+		runes  = []rune(alias)
+		format = FormatISO8Bit
+		data   []byte
+	)
+	for _, r := range runes {
+		if r > 0xff {
+			format = FormatUTF16BE
+			break
+		}
+	}
+
+	switch format {
+	case FormatISO8Bit:
+		if len(runes) > 27 {
+			runes = runes[:27]
+		}
+		for _, r := range runes {
+			data = append(data, byte(r))
+		}
+	case FormatUTF16BE:
+		for len(utf16.Encode(runes)) > 13 {
+			runes = runes[:len(runes)-1]
+		}
+		for _, u := range utf16.Encode(runes) {
+			data = append(data, byte(u>>8), byte(u))
+		}
+	}
+	data = append(data, make([]byte, 6+7*3-len(data))...)
+
+	var (
+		header = &TalkerAliasHeaderPDU{
+			DataFormat: format,
+			Length:     uint8(len(runes)),
+			Data:       data[:6],
+		}
+		lcs = []*LC{{Opcode: TalkerAliasHeader, TalkerAliasHeader: header}}
+	)
+	for i := 0; i < header.TalkerAliasBlocks(); i++ {
+		lc := &LC{Opcode: TalkerAliasBlk1 + uint8(i)}
+		lc.TalkerAliasBlocks[i] = &TalkerAliasBlockPDU{Data: data[6+i*7 : 6+i*7+7]}
+		lcs = append(lcs, lc)
+	}
+	return lcs
+}
@@ -0,0 +1,113 @@
+package lc
+
+import (
+	"math"
+	"testing"
+)
+
+func TestTalkerAlias(t *testing.T) {
+	var tests = []struct {
+		Format uint8
+		Alias  string
+		Data   []byte
+	}{
+		{FormatISO8Bit, "PD0MZ Wijnand", []byte("PD0MZ Wijnand")},
+		{FormatUTF16BE, "PD0MZ", []byte{0, 'P', 0, 'D', 0, '0', 0, 'M', 0, 'Z'}},
+	}
+
+	for _, test := range tests {
+		var (
+			length = uint8(len([]rune(test.Alias)))
+			data   = make([]byte, 6+7*3)
+			blocks [3]*TalkerAliasBlockPDU
+		)
+		copy(data, test.Data)
+
+		header, err := ParseTalkerAliasHeaderPDU(append([]byte{test.Format<<6 | length<<1}, data[:6]...))
+		if err != nil {
+			t.Fatalf("decode failed: %v", err)
+		}
+		if _, ok := TalkerAlias(header, blocks); ok {
+			t.Fatalf("decode failed: expected missing blocks for %q", test.Alias)
+		}
+		for i := 0; i < header.TalkerAliasBlocks(); i++ {
+			if blocks[i], err = ParseTalkerAliasBlockPDU(data[6+i*7 : 6+i*7+7]); err != nil {
+				t.Fatalf("decode failed: %v", err)
+			}
+		}
+
+		alias, ok := TalkerAlias(header, blocks)
+		if !ok || alias != test.Alias {
+			t.Fatalf("decode failed: expected %q, got %q", test.Alias, alias)
+		}
+	}
+}
+
+func TestTalkerAlias7Bit(t *testing.T) {
+	header := &TalkerAliasHeaderPDU{
+		DataFormat: Format7Bit,
+		Length:     7,
+		Data:       []byte("PD0MZ W"),
+	}
+	test, err := ParseTalkerAliasHeaderPDU(header.Bytes())
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+
+	alias, ok := TalkerAlias(test, [3]*TalkerAliasBlockPDU{})
+	if !ok || alias != "PD0MZ W" {
+		t.Fatalf("decode failed: expected %q, got %q", "PD0MZ W", alias)
+	}
+}
+
+func TestTalkerAliasLC(t *testing.T) {
+	var tests = []struct {
+		Alias, Want string
+	}{
+		{"PD0MZ", "PD0MZ"},
+		{"PD0MZ Wijnand Modderman-Lenstra", "PD0MZ Wijnand Modderman-Len"},
+		{"PD0MZ \u263a", "PD0MZ \u263a"},
+	}
+
+	for _, test := range tests {
+		var (
+			header *TalkerAliasHeaderPDU
+			blocks [3]*TalkerAliasBlockPDU
+		)
+		for _, lc := range TalkerAliasLC(test.Alias) {
+			parsed, err := ParseLC(lc.Bytes())
+			if err != nil {
+				t.Fatalf("decode failed: %v", err)
+			}
+			if parsed.TalkerAliasHeader != nil {
+				header = parsed.TalkerAliasHeader
+			}
+			for i, block := range parsed.TalkerAliasBlocks {
+				if block != nil {
+					blocks[i] = block
+				}
+			}
+		}
+
+		alias, ok := TalkerAlias(header, blocks)
+		if !ok || alias != test.Want {
+			t.Fatalf("decode failed: expected %q, got %q", test.Want, alias)
+		}
+	}
+}
+
+func TestGpsInfoCoordinates(t *testing.T) {
+	g := &GpsInfoPDU{
+		Latitude:  0xffffff, // -1 LSB
+		Longitude: 0x0400000,
+	}
+	lat, lon := g.Coordinates()
+	if lat >= 0 || lat < -0.0001 || lon != 45 {
+		t.Fatalf("decode failed: got %f,%f", lat, lon)
+	}
+
+	lat, lon = NewGpsInfoPDU(52.3676, -4.9041, ErrorLT20m).Coordinates()
+	if math.Abs(lat-52.3676) > 0.0001 || math.Abs(lon+4.9041) > 0.0001 {
+		t.Fatalf("encode failed: got %f,%f", lat, lon)
+	}
+}
@@ -0,0 +1,516 @@
+// Package lrrp implements the Motorola Location Request/Response Protocol.
+//
+// LRRP messages are carried over UDP, the first octet is the message type
+// followed by the length of the remainder (as uintvar) and a sequence of
+// tokens. The meaning of a token depends on whether the message is a request
+// or a report.
+package lrrp
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Port is the UDP port of the location service.
+const Port = 4001
+
+// Message types
+const (
+	ImmediateLocationRequestNCDT      uint8 = 0x04
+	ImmediateLocationRequest          uint8 = 0x05
+	ImmediateLocationResponse         uint8 = 0x07
+	TriggeredLocationStartRequestNCDT uint8 = 0x08
+	TriggeredLocationStartRequest     uint8 = 0x09
+	TriggeredLocationStartResponse    uint8 = 0x0b
+	TriggeredLocationData             uint8 = 0x0d
+	TriggeredLocationStopRequest      uint8 = 0x0f
+	TriggeredLocationStopResponse     uint8 = 0x11
+)
+
+var MessageTypeName = map[uint8]string{
+	ImmediateLocationRequestNCDT:      "immediate location request (NCDT)",
+	ImmediateLocationRequest:          "immediate location request",
+	ImmediateLocationResponse:         "immediate location response",
+	TriggeredLocationStartRequestNCDT: "triggered location start request (NCDT)",
+	TriggeredLocationStartRequest:     "triggered location start request",
+	TriggeredLocationStartResponse:    "triggered location start response",
+	TriggeredLocationData:             "triggered location data",
+	TriggeredLocationStopRequest:      "triggered location stop request",
+	TriggeredLocationStopResponse:     "triggered location stop response",
+}
+
+// Request tokens
+const (
+	tokenRequestID        uint8 = 0x22 // Length prefixed request ID, requests and reports
+	tokenPeriodicTrigger  uint8 = 0x34 // Interval in seconds (uintvar)
+	tokenRequestedInfo    uint8 = 0x51 // Requested fields (1 octet)
+	tokenRequestedSpeed   uint8 = 0x62 // Request horizontal speed
+	tokenRequestedHeading uint8 = 0x57 // Request direction
+)
+
+// Report tokens
+const (
+	tokenTimestamp  uint8 = 0x34 // Year (14 bits), month, day, hour, minute, second
+	tokenResult     uint8 = 0x37 // Result code (1 octet)
+	tokenResultLong uint8 = 0x38 // Result code (2 octets)
+	tokenPoint2D    uint8 = 0x66 // Latitude, longitude
+	tokenCircle2D   uint8 = 0x51 // Latitude, longitude, radius (ufloatvar)
+	tokenPoint3D    uint8 = 0x69 // Latitude, longitude, altitude (intvar)
+	tokenCircle3D   uint8 = 0x54 // Latitude, longitude, radius (ufloatvar), altitude (intvar)
+	tokenSpeed      uint8 = 0x6c // Horizontal speed in km/h (ufloatvar)
+	tokenDirection  uint8 = 0x56 // Direction in units of 2 degrees (1 octet)
+)
+
+// Requested information
+const (
+	RequestPosition uint8 = 0x40
+	RequestAltitude uint8 = 0x20
+)
+
+// Result codes
+const (
+	ResultSuccess            uint16 = 0x0000
+	ResultReportingWillStop  uint16 = 0x0010
+	ResultInsufficientGPS    uint16 = 0x0200
+	ResultBadGPSGeometry     uint16 = 0x0201
+	ResultPositionUnreliable uint16 = 0x0202
+)
+
+var ResultName = map[uint16]string{
+	ResultSuccess:            "success",
+	ResultReportingWillStop:  "reporting will stop",
+	ResultInsufficientGPS:    "insufficient GPS satellites",
+	ResultBadGPSGeometry:     "bad GPS geometry",
+	ResultPositionUnreliable: "position unreliable",
+}
+
+// Position is a reported location.
+type Position struct {
+	Latitude    float64 // Degrees, positive is north
+	Longitude   float64 // Degrees, positive is east
+	Radius      float64 // Accuracy in meters, 0 if not reported
+	Altitude    int     // Meters, only if HasAltitude is set
+	HasAltitude bool
+}
+
+func (p *Position) String() string {
+	var s = fmt.Sprintf("%.6f,%.6f", p.Latitude, p.Longitude)
+	if p.HasAltitude {
+		s += fmt.Sprintf(", altitude %dm", p.Altitude)
+	}
+	if p.Radius > 0 {
+		s += fmt.Sprintf(", radius %.1fm", p.Radius)
+	}
+	return s
+}
+
+// Message is a location request or report.
+type Message struct {
+	Type      uint8
+	RequestID []byte
+
+	// Requests
+	Interval       time.Duration // Periodic trigger interval, triggered start requests only
+	RequestedInfo  uint8         // Requested information
+	RequestSpeed   bool
+	RequestHeading bool
+
+	// Responses and reports
+	Result       uint16
+	HasResult    bool
+	Time         time.Time // Zero if no timestamp is reported
+	Position     *Position // Nil if no position is reported
+	Speed        float64   // Horizontal speed in km/h, only if HasSpeed is set
+	HasSpeed     bool
+	Direction    uint16 // Degrees, only if HasDirection is set
+	HasDirection bool
+}
+
+// IsRequest returns true if the message type is a request.
+func (m *Message) IsRequest() bool {
+	return isRequest(m.Type)
+}
+
+func (m *Message) String() string {
+	var s = fmt.Sprintf("%s (%#02x), request %x", MessageTypeName[m.Type], m.Type, m.RequestID)
+	if m.IsRequest() {
+		if m.Interval > 0 {
+			s += fmt.Sprintf(", interval %s", m.Interval)
+		}
+		return s
+	}
+	if m.HasResult {
+		s += fmt.Sprintf(", result %s (%#04x)", ResultName[m.Result], m.Result)
+	}
+	if !m.Time.IsZero() {
+		s += fmt.Sprintf(", time %s", m.Time.Format(time.RFC3339))
+	}
+	if m.Position != nil {
+		s += ", position " + m.Position.String()
+	}
+	if m.HasSpeed {
+		s += fmt.Sprintf(", speed %.1fkm/h", m.Speed)
+	}
+	if m.HasDirection {
+		s += fmt.Sprintf(", direction %d", m.Direction)
+	}
+	return s
+}
+
+func isRequest(t uint8) bool {
+	switch t {
+	case ImmediateLocationRequestNCDT, ImmediateLocationRequest,
+		TriggeredLocationStartRequestNCDT, TriggeredLocationStartRequest,
+		TriggeredLocationStopRequest:
+		return true
+	default:
+		return false
+	}
+}
+
+// Parse parses a location message from the UDP payload.
+func Parse(data []byte) (*Message, error) {
+	if len(data) < 2 {
+		return nil, fmt.Errorf("lrrp: expected at least 2 bytes, got %d", len(data))
+	}
+
+	m := &Message{Type: data[0]}
+	if _, ok := MessageTypeName[m.Type]; !ok {
+		return nil, fmt.Errorf("lrrp: unknown message type %#02x", m.Type)
+	}
+
+	size, n, err := readUintvar(data[1:])
+	if err != nil {
+		return nil, err
+	}
+	data = data[1+n:]
+	if int(size) > len(data) {
+		return nil, fmt.Errorf("lrrp: length %d exceeds %d bytes", size, len(data))
+	}
+	data = data[:size]
+
+	r := &reader{data: data}
+	for r.more() && r.err == nil {
+		token := r.byte()
+		if token == tokenRequestID {
+			m.RequestID = r.bytes(int(r.byte()))
+			continue
+		}
+		if m.IsRequest() {
+			m.parseRequestToken(token, r)
+		} else {
+			m.parseReportToken(token, r)
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	return m, nil
+}
+
+func (m *Message) parseRequestToken(token uint8, r *reader) {
+	switch token {
+	case tokenPeriodicTrigger:
+		m.Interval = time.Duration(r.uintvar()) * time.Second
+	case tokenRequestedInfo:
+		m.RequestedInfo = r.byte()
+	case tokenRequestedSpeed:
+		m.RequestSpeed = true
+	case tokenRequestedHeading:
+		m.RequestHeading = true
+	default:
+		r.fail(fmt.Errorf("lrrp: unsupported request token %#02x", token))
+	}
+}
+
+func (m *Message) parseReportToken(token uint8, r *reader) {
+	switch token {
+	case tokenTimestamp:
+		m.Time = r.timestamp()
+	case tokenResult:
+		m.Result = uint16(r.byte())
+		m.HasResult = true
+	case tokenResultLong:
+		m.Result = uint16(r.byte())<<8 | uint16(r.byte())
+		m.HasResult = true
+	case tokenPoint2D:
+		m.Position = r.position()
+	case tokenCircle2D:
+		m.Position = r.position()
+		m.Position.Radius = r.ufloatvar()
+	case tokenPoint3D:
+		m.Position = r.position()
+		m.Position.Altitude = r.intvar()
+		m.Position.HasAltitude = true
+	case tokenCircle3D:
+		m.Position = r.position()
+		m.Position.Radius = r.ufloatvar()
+		m.Position.Altitude = r.intvar()
+		m.Position.HasAltitude = true
+	case tokenSpeed:
+		m.Speed = r.ufloatvar()
+		m.HasSpeed = true
+	case tokenDirection:
+		m.Direction = uint16(r.byte()) * 2
+		m.HasDirection = true
+	default:
+		r.fail(fmt.Errorf("lrrp: unsupported report token %#02x", token))
+	}
+}
+
+// Bytes packs the message as UDP payload.
+func (m *Message) Bytes() ([]byte, error) {
+	if len(m.RequestID) > 0xff {
+		return nil, fmt.Errorf("lrrp: request ID of %d bytes too long", len(m.RequestID))
+	}
+
+	var data []byte
+	if m.RequestID != nil {
+		data = append(data, tokenRequestID, uint8(len(m.RequestID)))
+		data = append(data, m.RequestID...)
+	}
+
+	if m.IsRequest() {
+		if m.RequestedInfo != 0 {
+			data = append(data, tokenRequestedInfo, m.RequestedInfo)
+		}
+		if m.RequestSpeed {
+			data = append(data, tokenRequestedSpeed)
+		}
+		if m.RequestHeading {
+			data = append(data, tokenRequestedHeading)
+		}
+		if m.Interval > 0 {
+			data = append(data, tokenPeriodicTrigger)
+			data = appendUintvar(data, uint32(m.Interval/time.Second))
+		}
+	} else {
+		if m.HasResult {
+			if m.Result > 0xff {
+				data = append(data, tokenResultLong, uint8(m.Result>>8), uint8(m.Result))
+			} else {
+				data = append(data, tokenResult, uint8(m.Result))
+			}
+		}
+		if !m.Time.IsZero() {
+			data = append(data, tokenTimestamp)
+			data = appendTimestamp(data, m.Time)
+		}
+		if p := m.Position; p != nil {
+			switch {
+			case p.HasAltitude && p.Radius > 0:
+				data = appendPosition(append(data, tokenCircle3D), p)
+				data = appendIntvar(appendUfloatvar(data, p.Radius), p.Altitude)
+			case p.HasAltitude:
+				data = appendIntvar(appendPosition(append(data, tokenPoint3D), p), p.Altitude)
+			case p.Radius > 0:
+				data = appendUfloatvar(appendPosition(append(data, tokenCircle2D), p), p.Radius)
+			default:
+				data = appendPosition(append(data, tokenPoint2D), p)
+			}
+		}
+		if m.HasSpeed {
+			data = appendUfloatvar(append(data, tokenSpeed), m.Speed)
+		}
+		if m.HasDirection {
+			data = append(data, tokenDirection, uint8((m.Direction%360)/2))
+		}
+	}
+
+	var out = appendUintvar([]byte{m.Type}, uint32(len(data)))
+	return append(out, data...), nil
+}
+
+// Latitude and longitude are encoded as 32 bit fractions of 90 and 180 degrees.
+func encodeLatitude(lat float64) uint32 {
+	return uint32(int32(math.Round(lat / 90 * (1 << 31))))
+}
+
+func encodeLongitude(lon float64) uint32 {
+	return uint32(int32(math.Round(lon / 180 * (1 << 31))))
+}
+
+func appendPosition(data []byte, p *Position) []byte {
+	lat, lon := encodeLatitude(p.Latitude), encodeLongitude(p.Longitude)
+	return append(data,
+		uint8(lat>>24), uint8(lat>>16), uint8(lat>>8), uint8(lat),
+		uint8(lon>>24), uint8(lon>>16), uint8(lon>>8), uint8(lon))
+}
+
+// Timestamps are encoded in 40 bits, as year (14 bits), month (4 bits), day
+// (5 bits), hour (5 bits), minute (6 bits) and second (6 bits) in UTC.
+func appendTimestamp(data []byte, t time.Time) []byte {
+	t = t.UTC()
+	var v = uint64(t.Year())<<26 | uint64(t.Month())<<22 | uint64(t.Day())<<17 |
+		uint64(t.Hour())<<12 | uint64(t.Minute())<<6 | uint64(t.Second())
+	return append(data, uint8(v>>32), uint8(v>>24), uint8(v>>16), uint8(v>>8), uint8(v))
+}
+
+// uintvar encodes 7 bits per octet, most significant first, the high bit is
+// set on all but the last octet.
+func appendUintvar(data []byte, v uint32) []byte {
+	var tmp [5]byte
+	i := len(tmp) - 1
+	tmp[i] = uint8(v & 0x7f)
+	for v >>= 7; v > 0; v >>= 7 {
+		i--
+		tmp[i] = uint8(v&0x7f) | 0x80
+	}
+	return append(data, tmp[i:]...)
+}
+
+// intvar encodes the sign in bit 6 of the first octet, followed by the
+// magnitude as uintvar.
+func appendIntvar(data []byte, v int) []byte {
+	var sign uint8
+	if v < 0 {
+		sign, v = 0x40, -v
+	}
+	o := len(data)
+	data = appendUintvar(data, uint32(v))
+	if data[o]&0x40 != 0 {
+		// Magnitude needs the sign bit, prepend an octet
+		data = append(data[:o], append([]byte{0x80}, data[o:]...)...)
+	}
+	data[o] |= sign
+	return data
+}
+
+// ufloatvar encodes the integer part as uintvar, followed by the fraction in
+// units of 1/128.
+func appendUfloatvar(data []byte, v float64) []byte {
+	var (
+		i = math.Floor(v)
+		f = math.Round((v - i) * 128)
+	)
+	if f >= 128 {
+		i, f = i+1, 0
+	}
+	data = appendUintvar(data, uint32(i))
+	return append(data, uint8(f))
+}
+
+func readUintvar(data []byte) (uint32, int, error) {
+	var v uint32
+	for i, b := range data {
+		if i == 5 {
+			break
+		}
+		v = v<<7 | uint32(b&0x7f)
+		if b&0x80 == 0 {
+			return v, i + 1, nil
+		}
+	}
+	return 0, 0, errors.New("lrrp: invalid uintvar")
+}
+
+// reader reads tokens, the first error is kept and stops further reading.
+type reader struct {
+	data []byte
+	o    int
+	err  error
+}
+
+func (r *reader) more() bool {
+	return r.o < len(r.data)
+}
+
+func (r *reader) fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+func (r *reader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if r.o+n > len(r.data) {
+		r.fail(errors.New("lrrp: message truncated"))
+		return nil
+	}
+	b := make([]byte, n)
+	copy(b, r.data[r.o:])
+	r.o += n
+	return b
+}
+
+func (r *reader) byte() uint8 {
+	if b := r.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *reader) uint32() uint32 {
+	if b := r.bytes(4); b != nil {
+		return uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
+	}
+	return 0
+}
+
+func (r *reader) uintvar() uint32 {
+	if r.err != nil {
+		return 0
+	}
+	v, n, err := readUintvar(r.data[r.o:])
+	if err != nil {
+		r.fail(err)
+		return 0
+	}
+	r.o += n
+	return v
+}
+
+func (r *reader) intvar() int {
+	var (
+		v        uint32
+		negative bool
+	)
+	for i := 0; i < 5; i++ {
+		b := r.byte()
+		if r.err != nil {
+			return 0
+		}
+		if i == 0 {
+			negative = b&0x40 != 0
+			b &^= 0x40
+		}
+		v = v<<7 | uint32(b&0x7f)
+		if b&0x80 == 0 {
+			if negative {
+				return -int(v)
+			}
+			return int(v)
+		}
+	}
+	r.fail(errors.New("lrrp: invalid intvar"))
+	return 0
+}
+
+func (r *reader) ufloatvar() float64 {
+	i := r.uintvar()
+	f := r.byte()
+	return float64(i) + float64(f&0x7f)/128
+}
+
+func (r *reader) position() *Position {
+	return &Position{
+		Latitude:  float64(int32(r.uint32())) * 90 / (1 << 31),
+		Longitude: float64(int32(r.uint32())) * 180 / (1 << 31),
+	}
+}
+
+func (r *reader) timestamp() time.Time {
+	b := r.bytes(5)
+	if b == nil {
+		return time.Time{}
+	}
+	v := uint64(b[0])<<32 | uint64(b[1])<<24 | uint64(b[2])<<16 | uint64(b[3])<<8 | uint64(b[4])
+	return time.Date(
+		int(v>>26)&0x3fff, time.Month(v>>22)&0x0f, int(v>>17)&0x1f,
+		int(v>>12)&0x1f, int(v>>6)&0x3f, int(v)&0x3f, 0, time.UTC)
+}
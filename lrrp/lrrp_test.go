@@ -0,0 +1,118 @@
+package lrrp
+
+import (
+	"bytes"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestRequest(t *testing.T) {
+	want := &Message{
+		Type:          TriggeredLocationStartRequest,
+		RequestID:     []byte{0x24, 0x68, 0xac, 0xe0},
+		Interval:      time.Second * 300,
+		RequestedInfo: RequestPosition | RequestAltitude,
+		RequestSpeed:  true,
+	}
+
+	data, err := want.Bytes()
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	if int(data[1]) != len(data)-2 {
+		t.Fatalf("encode failed: expected length %d, got %d", len(data)-2, data[1])
+	}
+
+	test, err := Parse(data)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if !bytes.Equal(test.RequestID, want.RequestID) || test.Interval != want.Interval ||
+		test.RequestedInfo != want.RequestedInfo || test.RequestSpeed != want.RequestSpeed || test.RequestHeading {
+		t.Fatalf("decode failed: expected %s, got %s", want, test)
+	}
+}
+
+func TestReport(t *testing.T) {
+	var tests = []*Message{
+		{
+			Type:      ImmediateLocationResponse,
+			RequestID: []byte{0x01},
+			Result:    ResultSuccess,
+			HasResult: true,
+			Time:      time.Date(2016, 3, 20, 13, 37, 42, 0, time.UTC),
+			Position: &Position{
+				Latitude:    52.379189,
+				Longitude:   4.899431,
+				Radius:      12.5,
+				Altitude:    -4,
+				HasAltitude: true,
+			},
+			Speed:        42.25,
+			HasSpeed:     true,
+			Direction:    270,
+			HasDirection: true,
+		},
+		{
+			Type:      TriggeredLocationData,
+			RequestID: []byte{0x24, 0x68, 0xac, 0xe0},
+			Position: &Position{
+				Latitude:  -33.856784,
+				Longitude: 151.215297,
+			},
+		},
+		{
+			Type:      TriggeredLocationStopResponse,
+			Result:    ResultInsufficientGPS,
+			HasResult: true,
+		},
+	}
+
+	for _, want := range tests {
+		data, err := want.Bytes()
+		if err != nil {
+			t.Fatalf("encode failed: %v", err)
+		}
+		test, err := Parse(data)
+		if err != nil {
+			t.Fatalf("decode failed: %v", err)
+		}
+		t.Log(test)
+
+		if test.Type != want.Type || !bytes.Equal(test.RequestID, want.RequestID) ||
+			test.HasResult != want.HasResult || test.Result != want.Result || !test.Time.Equal(want.Time) ||
+			test.HasSpeed != want.HasSpeed || test.Speed != want.Speed ||
+			test.HasDirection != want.HasDirection || test.Direction != want.Direction {
+			t.Fatalf("decode failed: expected %s, got %s", want, test)
+		}
+		if want.Position == nil {
+			if test.Position != nil {
+				t.Fatalf("decode failed: expected no position, got %s", test.Position)
+			}
+			continue
+		}
+		if test.Position == nil {
+			t.Fatal("decode failed: no position")
+		}
+		if math.Abs(test.Position.Latitude-want.Position.Latitude) > 1e-6 ||
+			math.Abs(test.Position.Longitude-want.Position.Longitude) > 1e-6 ||
+			test.Position.Radius != want.Position.Radius ||
+			test.Position.HasAltitude != want.Position.HasAltitude || test.Position.Altitude != want.Position.Altitude {
+			t.Fatalf("decode failed: expected %s, got %s", want.Position, test.Position)
+		}
+	}
+}
+
+func TestIntvar(t *testing.T) {
+	for _, want := range []int{0, 1, -1, 63, -63, 64, -64, 8848, -10994} {
+		data := appendIntvar(nil, want)
+		r := &reader{data: data}
+		if test := r.intvar(); r.err != nil || test != want {
+			t.Fatalf("decode failed: expected %d, got %d (%v)", want, test, r.err)
+		}
+		if r.more() {
+			t.Fatalf("decode failed: %d trailing bytes", len(data)-r.o)
+		}
+	}
+}
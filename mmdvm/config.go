@@ -0,0 +1,85 @@
+package mmdvm
+
+// Configuration flags
+const (
+	FlagRXInvert  byte = 0x01
+	FlagTXInvert  byte = 0x02
+	FlagPTTInvert byte = 0x04
+	FlagDebug     byte = 0x10
+	FlagSimplex   byte = 0x80
+)
+
+// Mode flags
+const (
+	EnableDStar byte = 0x01
+	EnableDMR   byte = 0x02
+	EnableYSF   byte = 0x04
+	EnableP25   byte = 0x08
+)
+
+// Config is the modem configuration.
+type Config struct {
+	RXInvert  bool
+	TXInvert  bool
+	PTTInvert bool
+	Debug     bool
+	Duplex    bool
+
+	// TXDelay is the transmitter delay in milliseconds
+	TXDelay uint16
+
+	// RXLevel and TXLevel are in percent
+	RXLevel uint8
+	TXLevel uint8
+
+	ColorCode uint8
+
+	// DMRDelay is the slot delay in symbols
+	DMRDelay uint8
+
+	// OscillatorOffset is the oscillator offset, 128 is no offset
+	OscillatorOffset uint8
+}
+
+// Bytes packs the configuration for the SET_CONFIG command.
+func (c *Config) Bytes() []byte {
+	var data = make([]byte, 13)
+	if c.RXInvert {
+		data[0] |= FlagRXInvert
+	}
+	if c.TXInvert {
+		data[0] |= FlagTXInvert
+	}
+	if c.PTTInvert {
+		data[0] |= FlagPTTInvert
+	}
+	if c.Debug {
+		data[0] |= FlagDebug
+	}
+	if !c.Duplex {
+		data[0] |= FlagSimplex
+	}
+	data[1] = EnableDMR
+	data[2] = uint8(c.TXDelay / 10)
+	data[3] = ModeIdle
+	data[4] = percent(c.RXLevel)
+	data[5] = 0 // CW ID level
+	data[6] = c.ColorCode
+	data[7] = c.DMRDelay
+	data[8] = c.OscillatorOffset
+	if data[8] == 0 {
+		data[8] = 128
+	}
+	data[9] = 0 // D-STAR level
+	data[10] = percent(c.TXLevel)
+	data[11] = 0 // YSF level
+	data[12] = 0 // P25 level
+	return data
+}
+
+func percent(level uint8) uint8 {
+	if level > 100 {
+		level = 100
+	}
+	return uint8(uint16(level) * 255 / 100)
+}
@@ -0,0 +1,512 @@
+// Package mmdvm implements the MMDVM modem host protocol
+package mmdvm
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/op/go-logging"
+	"github.com/pd0mz/go-dmr"
+)
+
+var log = logging.MustGetLogger("dmr/mmdvm")
+
+// Frame start marker
+const FrameStart byte = 0xe0
+
+// Commands, see "MMDVM Specification 20151208.pdf".
+const (
+	GetVersion byte = 0x00
+	GetStatus  byte = 0x01
+	SetConfig  byte = 0x02
+	SetMode    byte = 0x03
+	SetFreq    byte = 0x04
+
+	DMRData1   byte = 0x18
+	DMRLost1   byte = 0x19
+	DMRData2   byte = 0x1a
+	DMRLost2   byte = 0x1b
+	DMRShortLC byte = 0x1c
+	DMRStart   byte = 0x1d
+	DMRAbort   byte = 0x1e
+
+	ACK    byte = 0x70
+	NAK    byte = 0x7f
+	Debug1 byte = 0xf1
+	Debug2 byte = 0xf2
+	Debug3 byte = 0xf3
+	Debug4 byte = 0xf4
+	Debug5 byte = 0xf5
+)
+
+// Modem states
+const (
+	ModeIdle    byte = 0x00
+	ModeDStar   byte = 0x01
+	ModeDMR     byte = 0x02
+	ModeYSF     byte = 0x03
+	ModeP25     byte = 0x04
+	ModeCW      byte = 0x62
+	ModeLockout byte = 0x63
+	ModeError   byte = 0x64
+)
+
+// DMR data frame control byte
+const (
+	DMRSyncData  byte = 0x40
+	DMRSyncAudio byte = 0x20
+	DMRTypeMask  byte = 0x0f
+)
+
+// DMRFrameSize is the size of a DMR burst in a data frame.
+const DMRFrameSize = 33
+
+var nakReason = map[byte]string{
+	1: "invalid command",
+	2: "wrong mode",
+	3: "command too long",
+	4: "data incorrect",
+	5: "not enough buffer space",
+}
+
+var (
+	// Timeout is the time we wait for the modem to reply to a command
+	Timeout = time.Second
+	// StatusInterval is the interval at which we poll the modem status
+	StatusInterval = time.Millisecond * 250
+)
+
+// Frame is a single message exchanged with the modem.
+type Frame struct {
+	Command byte
+	Data    []byte
+}
+
+// Bytes packs the frame.
+func (f Frame) Bytes() []byte {
+	var b = make([]byte, 3+len(f.Data))
+	b[0] = FrameStart
+	b[1] = byte(len(b))
+	b[2] = f.Command
+	copy(b[3:], f.Data)
+	return b
+}
+
+// ReadFrame reads a single frame from r, any data before the frame start
+// marker is discarded.
+func ReadFrame(r *bufio.Reader) (*Frame, error) {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if b == FrameStart {
+			break
+		}
+	}
+
+	size, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if size < 3 {
+		return nil, fmt.Errorf("mmdvm: invalid frame length %d", size)
+	}
+
+	var data = make([]byte, size-2)
+	if _, err = io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return &Frame{Command: data[0], Data: data[1:]}, nil
+}
+
+// Modem implements the MMDVM host protocol.
+type Modem struct {
+	Config      *Config
+	Status      *Status
+	Protocol    byte
+	Description string
+
+	port    io.ReadWriteCloser
+	pf      dmr.PacketFunc
+	closed  bool
+	mutex   *sync.Mutex // Mutex for manipulating modem state
+	command *sync.Mutex // Mutex for commands awaiting a reply
+	write   *sync.Mutex // Mutex for writing to the port
+	reply   chan *Frame
+	stop    chan bool
+	done    chan bool
+
+	// Receive state per timeslot
+	rx [2]struct {
+		streamID uint32
+		sequence uint8
+		active   bool
+	}
+	streamID uint32
+	tx       bool
+}
+
+// New creates a new MMDVM modem on the given serial port.
+func New(port io.ReadWriteCloser, config *Config) (*Modem, error) {
+	if port == nil {
+		return nil, errors.New("mmdvm: port can't be nil")
+	}
+	if config == nil {
+		return nil, errors.New("mmdvm: Config can't be nil")
+	}
+	if config.ColorCode > 15 {
+		return nil, fmt.Errorf("mmdvm: invalid color code %d", config.ColorCode)
+	}
+
+	return &Modem{
+		Config:  config,
+		Status:  &Status{},
+		port:    port,
+		mutex:   &sync.Mutex{},
+		command: &sync.Mutex{},
+		write:   &sync.Mutex{},
+		reply:   make(chan *Frame, 1),
+	}, nil
+}
+
+// Active returns true if the modem is active.
+func (m *Modem) Active() bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return !m.closed
+}
+
+// Close stops transmitting and closes the port.
+func (m *Modem) Close() error {
+	m.mutex.Lock()
+	if m.closed {
+		m.mutex.Unlock()
+		return nil
+	}
+	m.closed = true
+	var (
+		stop, done = m.stop, m.done
+		tx         = m.tx
+	)
+	m.stop, m.done = nil, nil
+	m.tx = false
+	m.mutex.Unlock()
+
+	log.Info("closing")
+
+	// Stop polling before we turn off the transmitter and close the port
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+	if tx {
+		m.writeFrame(Frame{Command: DMRStart, Data: []byte{0x00}})
+	}
+	return m.port.Close()
+}
+
+// ListenAndServe initialises the modem and handles incoming frames.
+func (m *Modem) ListenAndServe() error {
+	var errs = make(chan error, 1)
+	go func() {
+		errs <- m.readLoop()
+	}()
+
+	if err := m.setup(); err != nil {
+		m.Close()
+		<-errs
+		return err
+	}
+
+	m.mutex.Lock()
+	if !m.closed {
+		m.stop, m.done = make(chan bool), make(chan bool)
+		go m.poll(m.stop, m.done)
+	}
+	m.mutex.Unlock()
+
+	return <-errs
+}
+
+// setup retrieves the modem version and sends the configuration.
+func (m *Modem) setup() error {
+	f, err := m.request(Frame{Command: GetVersion})
+	if err != nil {
+		return err
+	}
+	if f.Command != GetVersion || len(f.Data) < 1 {
+		return fmt.Errorf("mmdvm: unexpected reply %#02x to version request", f.Command)
+	}
+	m.Protocol = f.Data[0]
+	m.Description = string(f.Data[1:])
+	log.Infof("modem protocol %d: %s\n", m.Protocol, m.Description)
+
+	if err = m.SetConfig(m.Config); err != nil {
+		return err
+	}
+	return m.SetMode(ModeDMR)
+}
+
+func (m *Modem) poll(stop <-chan bool, done chan<- bool) {
+	defer close(done)
+	for {
+		select {
+		case <-time.After(StatusInterval):
+		case <-stop:
+			return
+		}
+
+		if err := m.writeFrame(Frame{Command: GetStatus}); err != nil {
+			log.Errorf("error requesting status: %v\n", err)
+		}
+	}
+}
+
+func (m *Modem) readLoop() error {
+	var r = bufio.NewReader(m.port)
+	for m.Active() {
+		f, err := ReadFrame(r)
+		if err != nil {
+			if !m.Active() {
+				break
+			}
+			return err
+		}
+
+		if err = m.handle(f); err != nil {
+			log.Errorf("error handling frame %#02x: %v\n", f.Command, err)
+		}
+	}
+
+	log.Info("listener closed")
+	return nil
+}
+
+func (m *Modem) handle(f *Frame) error {
+	switch f.Command {
+	case DMRData1, DMRData2:
+		return m.handleData(f)
+
+	case DMRLost1, DMRLost2:
+		var ts uint8
+		if f.Command == DMRLost2 {
+			ts = 1
+		}
+		log.Debugf("TS%d: signal lost\n", ts+1)
+		m.mutex.Lock()
+		m.rx[ts].active = false
+		m.mutex.Unlock()
+
+	case GetStatus:
+		s, err := ParseStatus(f.Data)
+		if err != nil {
+			return err
+		}
+		m.mutex.Lock()
+		m.Status = s
+		m.mutex.Unlock()
+
+	case GetVersion, ACK, NAK:
+		select {
+		case m.reply <- f:
+		default:
+			log.Warningf("unsolicited reply %#02x\n", f.Command)
+		}
+
+	case Debug1, Debug2, Debug3, Debug4, Debug5:
+		log.Debugf("modem: %s\n", string(f.Data))
+
+	default:
+		log.Debugf("unhandled frame %#02x\n", f.Command)
+	}
+
+	return nil
+}
+
+func (m *Modem) handleData(f *Frame) error {
+	if len(f.Data) < 1+DMRFrameSize {
+		return fmt.Errorf("mmdvm: expected %d DMR data bytes, got %d", 1+DMRFrameSize, len(f.Data))
+	}
+
+	var (
+		control = f.Data[0]
+		p       = &dmr.Packet{}
+	)
+	if f.Command == DMRData2 {
+		p.Timeslot = 1
+	}
+	switch {
+	case control&DMRSyncData > 0:
+		p.DataType = dmr.ParseDataType(control & DMRTypeMask)
+	case control&DMRSyncAudio > 0:
+		p.DataType = dmr.VoiceBurstA
+	default:
+		n := control & DMRTypeMask
+		if n > 5 {
+			return fmt.Errorf("mmdvm: invalid voice sequence %d", n)
+		}
+		p.DataType = dmr.VoiceBurstA + n
+	}
+	p.SetData(f.Data[1 : 1+DMRFrameSize])
+
+	// Verify the data type against the slot type in the burst
+	if err := p.UpdateDataType(); err != nil {
+		log.Debugf("TS%d: %v\n", p.Timeslot+1, err)
+	}
+
+	// Keep track of transmissions, so the stream ID changes per transmission
+	m.mutex.Lock()
+	rx := &m.rx[p.Timeslot]
+	if !rx.active {
+		m.streamID++
+		rx.streamID = m.streamID
+		rx.sequence = 0
+		rx.active = true
+	} else {
+		rx.sequence++
+	}
+	p.StreamID = rx.streamID
+	p.Sequence = rx.sequence
+	if p.DataType == dmr.TerminatorWithLC {
+		rx.active = false
+	}
+	m.mutex.Unlock()
+
+	if m.pf == nil {
+		return errors.New("mmdvm: no PacketFunc defined to handle DMR packet")
+	}
+	return m.pf(m, p)
+}
+
+// Send a DMR packet to the modem for transmission.
+func (m *Modem) Send(p *dmr.Packet) error {
+	if !m.Active() {
+		return errors.New("mmdvm: not active")
+	}
+	if len(p.Data) < DMRFrameSize {
+		return fmt.Errorf("mmdvm: expected %d DMR data bytes, got %d", DMRFrameSize, len(p.Data))
+	}
+
+	m.mutex.Lock()
+	var start = m.Config.Duplex && !m.tx
+	m.mutex.Unlock()
+	if start {
+		if err := m.Start(true); err != nil {
+			return err
+		}
+	}
+
+	var f = Frame{Command: DMRData1, Data: make([]byte, 1+DMRFrameSize)}
+	if p.Timeslot == 1 || !m.Config.Duplex {
+		f.Command = DMRData2
+	}
+	switch p.DataType {
+	case dmr.VoiceBurstA:
+		f.Data[0] = DMRSyncAudio
+	case dmr.VoiceBurstB, dmr.VoiceBurstC, dmr.VoiceBurstD, dmr.VoiceBurstE, dmr.VoiceBurstF:
+		f.Data[0] = p.DataType - dmr.VoiceBurstA
+	default:
+		f.Data[0] = DMRSyncData | (p.DataType & DMRTypeMask)
+	}
+	copy(f.Data[1:], p.Data[:DMRFrameSize])
+
+	return m.writeFrame(f)
+}
+
+// Start enables or disables the transmitter in duplex mode.
+func (m *Modem) Start(tx bool) error {
+	var on byte
+	if tx {
+		on = 0x01
+	}
+	if err := m.writeFrame(Frame{Command: DMRStart, Data: []byte{on}}); err != nil {
+		return err
+	}
+	m.mutex.Lock()
+	m.tx = tx
+	m.mutex.Unlock()
+	return nil
+}
+
+// ShortLC sends the short LC to be transmitted in the CACH in duplex mode.
+func (m *Modem) ShortLC(lc []byte) error {
+	if len(lc) != 9 {
+		return fmt.Errorf("mmdvm: expected 9 short LC bytes, got %d", len(lc))
+	}
+	return m.writeFrame(Frame{Command: DMRShortLC, Data: lc})
+}
+
+// Abort stops the transmission on the timeslot.
+func (m *Modem) Abort(ts uint8) error {
+	return m.writeFrame(Frame{Command: DMRAbort, Data: []byte{ts + 1}})
+}
+
+// SetConfig sends the modem configuration.
+func (m *Modem) SetConfig(config *Config) error {
+	return m.acknowledged(Frame{Command: SetConfig, Data: config.Bytes()})
+}
+
+// SetMode changes the modem state.
+func (m *Modem) SetMode(mode byte) error {
+	return m.acknowledged(Frame{Command: SetMode, Data: []byte{mode}})
+}
+
+func (m *Modem) GetPacketFunc() dmr.PacketFunc {
+	return m.pf
+}
+
+func (m *Modem) SetPacketFunc(f dmr.PacketFunc) {
+	m.pf = f
+}
+
+// acknowledged sends a command and waits for the modem to ACK it.
+func (m *Modem) acknowledged(f Frame) error {
+	r, err := m.request(f)
+	if err != nil {
+		return err
+	}
+	switch r.Command {
+	case ACK:
+		return nil
+	case NAK:
+		var reason byte
+		if len(r.Data) > 1 {
+			reason = r.Data[1]
+		}
+		return fmt.Errorf("mmdvm: command %#02x refused: %s (%d)", f.Command, nakReason[reason], reason)
+	default:
+		return fmt.Errorf("mmdvm: unexpected reply %#02x to command %#02x", r.Command, f.Command)
+	}
+}
+
+// request sends a command and waits for the reply.
+func (m *Modem) request(f Frame) (*Frame, error) {
+	m.command.Lock()
+	defer m.command.Unlock()
+
+	if err := m.writeFrame(f); err != nil {
+		return nil, err
+	}
+	select {
+	case r := <-m.reply:
+		return r, nil
+	case <-time.After(Timeout):
+		return nil, fmt.Errorf("mmdvm: timeout waiting for reply to command %#02x", f.Command)
+	}
+}
+
+func (m *Modem) writeFrame(f Frame) error {
+	m.write.Lock()
+	defer m.write.Unlock()
+
+	_, err := m.port.Write(f.Bytes())
+	return err
+}
+
+// Interface compliance check
+var _ dmr.Repeater = (*Modem)(nil)
@@ -0,0 +1,252 @@
+//go:build linux
+// +build linux
+
+package mmdvm
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/pd0mz/go-dmr"
+)
+
+// openPTY opens a pseudo-terminal pair in raw mode, the master side acts as
+// the modem and the slave side is used as serial port.
+func openPTY() (*os.File, *os.File, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var n, unlock uint32
+	if err = ioctl(master.Fd(), syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock))); err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+	if err = ioctl(master.Fd(), syscall.TIOCGPTN, uintptr(unsafe.Pointer(&n))); err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+
+	slave, err := os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|syscall.O_NOCTTY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+
+	var t syscall.Termios
+	if err = ioctl(slave.Fd(), syscall.TCGETS, uintptr(unsafe.Pointer(&t))); err != nil {
+		master.Close()
+		slave.Close()
+		return nil, nil, err
+	}
+	t.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	t.Oflag &^= syscall.OPOST
+	t.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	t.Cflag &^= syscall.CSIZE | syscall.PARENB
+	t.Cflag |= syscall.CS8
+	if err = ioctl(slave.Fd(), syscall.TCSETS, uintptr(unsafe.Pointer(&t))); err != nil {
+		master.Close()
+		slave.Close()
+		return nil, nil, err
+	}
+
+	return master, slave, nil
+}
+
+func ioctl(fd, request, arg uintptr) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, request, arg); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// testPolled waits for the first status poll, which starts after the setup
+// has completed.
+func testPolled(t *testing.T, m *Modem, status *Status) {
+	for i := 0; i < 100; i++ {
+		m.mutex.Lock()
+		polled := m.Status != status
+		m.mutex.Unlock()
+		if polled {
+			return
+		}
+		time.Sleep(time.Millisecond * 20)
+	}
+	t.Fatal("timeout waiting for status poll")
+}
+
+// testModem is a stand-in modem that answers the host commands.
+func testModem(t *testing.T, port *os.File, frames chan<- *Frame) {
+	var r = bufio.NewReader(port)
+	for {
+		f, err := ReadFrame(r)
+		if err != nil {
+			return
+		}
+
+		var reply *Frame
+		switch f.Command {
+		case GetVersion:
+			reply = &Frame{Command: GetVersion, Data: append([]byte{0x01}, "MMDVM test"...)}
+		case GetStatus:
+			reply = &Frame{Command: GetStatus, Data: []byte{EnableDMR, ModeDMR, 0x00, 0x00, 0x0a, 0x0a}}
+		case SetConfig, SetMode:
+			reply = &Frame{Command: ACK, Data: []byte{f.Command}}
+		default:
+			frames <- f
+		}
+		if reply != nil {
+			if _, err = port.Write(reply.Bytes()); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}
+}
+
+func TestModem(t *testing.T) {
+	master, slave, err := openPTY()
+	if err != nil {
+		t.Skipf("no pseudo-terminal available: %v", err)
+	}
+	defer master.Close()
+
+	var frames = make(chan *Frame, 16)
+	go testModem(t, master, frames)
+
+	m, err := New(slave, &Config{ColorCode: 1, Duplex: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	var packets = make(chan *dmr.Packet, 16)
+	m.SetPacketFunc(func(_ dmr.Repeater, p *dmr.Packet) error {
+		packets <- p
+		return nil
+	})
+	var status = m.Status
+	go m.ListenAndServe()
+
+	// Incoming voice burst B on TS2
+	var data = make([]byte, DMRFrameSize)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	if _, err = master.Write(Frame{Command: DMRData2, Data: append([]byte{0x01}, data...)}.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case p := <-packets:
+		if p.Timeslot != 1 {
+			t.Fatalf("expected TS2, got TS%d", p.Timeslot+1)
+		}
+		if p.DataType != dmr.VoiceBurstB {
+			t.Fatalf("expected %s, got %s", dmr.DataTypeName[dmr.VoiceBurstB], dmr.DataTypeName[p.DataType])
+		}
+		if string(p.Data) != string(data) {
+			t.Fatalf("data mismatch, expected %v, got %v", data, p.Data)
+		}
+	case <-time.After(time.Second * 2):
+		t.Fatal("timeout waiting for packet")
+	}
+
+	// Outgoing voice LC on TS1, preceded by DMR_START
+	if err = m.Send(&dmr.Packet{Timeslot: 0, DataType: dmr.VoiceLC, Data: data}); err != nil {
+		t.Fatal(err)
+	}
+	for _, expect := range []byte{DMRStart, DMRData1} {
+		select {
+		case f := <-frames:
+			if f.Command != expect {
+				t.Fatalf("expected command %#02x, got %#02x", expect, f.Command)
+			}
+			if f.Command == DMRData1 {
+				if f.Data[0] != DMRSyncData|dmr.VoiceLC {
+					t.Fatalf("expected control %#02x, got %#02x", DMRSyncData|dmr.VoiceLC, f.Data[0])
+				}
+				if string(f.Data[1:]) != string(data) {
+					t.Fatalf("data mismatch, expected %v, got %v", data, f.Data[1:])
+				}
+			}
+		case <-time.After(time.Second * 2):
+			t.Fatalf("timeout waiting for command %#02x", expect)
+		}
+	}
+
+	testPolled(t, m, status)
+	if m.Description != "MMDVM test" {
+		t.Fatalf("expected description %q, got %q", "MMDVM test", m.Description)
+	}
+}
+
+func TestModemClose(t *testing.T) {
+	master, slave, err := openPTY()
+	if err != nil {
+		t.Skipf("no pseudo-terminal available: %v", err)
+	}
+	defer master.Close()
+
+	var frames = make(chan *Frame, 16)
+	go testModem(t, master, frames)
+
+	m, err := New(slave, &Config{ColorCode: 1, Duplex: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.SetPacketFunc(func(_ dmr.Repeater, _ *dmr.Packet) error { return nil })
+
+	var (
+		errs   = make(chan error, 1)
+		status = m.Status
+	)
+	go func() {
+		errs <- m.ListenAndServe()
+	}()
+
+	testPolled(t, m, status)
+	if err = m.Send(&dmr.Packet{Timeslot: 0, DataType: dmr.VoiceLC, Data: make([]byte, DMRFrameSize)}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err = <-errs:
+		if err != nil {
+			t.Fatalf("ListenAndServe failed: %v", err)
+		}
+	case <-time.After(time.Second * 2):
+		t.Fatal("timeout waiting for ListenAndServe to return")
+	}
+
+	// Expect the transmitter to be started and stopped again
+	var last *Frame
+	for {
+		select {
+		case f := <-frames:
+			if f.Command == DMRStart {
+				last = f
+			}
+			continue
+		case <-time.After(time.Millisecond * 200):
+		}
+		break
+	}
+	if last == nil || len(last.Data) != 1 || last.Data[0] != 0x00 {
+		t.Fatalf("expected transmitter to be stopped, got %+v", last)
+	}
+	if m.Active() {
+		t.Fatal("modem still active after Close")
+	}
+	if err = m.Send(&dmr.Packet{Data: make([]byte, DMRFrameSize)}); err == nil {
+		t.Fatal("Send after Close did not fail")
+	}
+}
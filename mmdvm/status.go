@@ -0,0 +1,55 @@
+package mmdvm
+
+import "fmt"
+
+// Status flags
+const (
+	StatusTX          byte = 0x01
+	StatusADCOverflow byte = 0x02
+	StatusRXOverflow  byte = 0x04
+	StatusTXOverflow  byte = 0x08
+	StatusLockout     byte = 0x10
+	StatusDACOverflow byte = 0x20
+)
+
+// Status is the modem status as returned by GET_STATUS.
+type Status struct {
+	Modes byte
+	Mode  byte
+	Flags byte
+
+	// Free buffer space per mode
+	DStarSpace uint8
+	DMRSpace1  uint8
+	DMRSpace2  uint8
+	YSFSpace   uint8
+	P25Space   uint8
+}
+
+// ParseStatus parses a GET_STATUS reply.
+func ParseStatus(data []byte) (*Status, error) {
+	if len(data) < 6 {
+		return nil, fmt.Errorf("mmdvm: expected at least 6 status bytes, got %d", len(data))
+	}
+
+	s := &Status{
+		Modes:      data[0],
+		Mode:       data[1],
+		Flags:      data[2],
+		DStarSpace: data[3],
+		DMRSpace1:  data[4],
+		DMRSpace2:  data[5],
+	}
+	if len(data) > 6 {
+		s.YSFSpace = data[6]
+	}
+	if len(data) > 7 {
+		s.P25Space = data[7]
+	}
+	return s, nil
+}
+
+// TX returns true if the modem is transmitting.
+func (s *Status) TX() bool {
+	return s.Flags&StatusTX > 0
+}
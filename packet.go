@@ -12,6 +12,7 @@ const (
 	Rate12Data                                 // Payload for rate 1/2 packet data
 	Rate34Data                                 // Payload for rate 3⁄4 packet data
 	Idle                                       // Fills channel when no info to transmit
+	Rate1Data                                  // Payload for rate 1 (uncoded) packet data
 	VoiceBurstA                                // Burst A marks the start of a superframe and always contains a voice SYNC pattern
 	VoiceBurstB                                // Bursts B to F carry embedded signalling in place of the SYNC pattern
 	VoiceBurstC                                // Bursts B to F carry embedded signalling in place of the SYNC pattern
@@ -33,6 +34,7 @@ var DataTypeName = map[uint8]string{
 	Rate12Data:      "rate ½ packet data",
 	Rate34Data:      "rate ¾ packet data",
 	Idle:            "idle",
+	Rate1Data:       "rate 1 packet data",
 	VoiceBurstA:     "voice (burst A)",
 	VoiceBurstB:     "voice (burst B)",
 	VoiceBurstC:     "voice (burst C)",
@@ -115,8 +117,13 @@ func (p *Packet) SlotType() []byte {
 
 // SlotTypeBits returns the SloT Type bits
 func (p *Packet) SlotTypeBits() []byte {
-	var o = InfoHalfBits + SlotTypeHalfBits + SyncBits
-	return append(p.Bits[InfoHalfBits:InfoHalfBits+SlotTypeHalfBits], p.Bits[o:o+SlotTypeHalfBits]...)
+	var (
+		b = make([]byte, SlotTypeBits)
+		o = InfoHalfBits + SlotTypeHalfBits + SyncBits
+	)
+	copy(b[:SlotTypeHalfBits], p.Bits[InfoHalfBits:InfoHalfBits+SlotTypeHalfBits])
+	copy(b[SlotTypeHalfBits:], p.Bits[o:o+SlotTypeHalfBits])
+	return b
 }
 
 // VoiceBits returns the bits containing voice data
@@ -0,0 +1,116 @@
+package dmr
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/pd0mz/go-dmr/vbptc"
+)
+
+// Reverse channel commands.
+const (
+	RCIncreasePower uint8 = iota
+	RCDecreasePower
+	RCHighestPower
+	RCLowestPower
+	RCCeaseTransmission
+	RCCeaseTransmissionRequest
+)
+
+// RCCommandName is a map of reverse channel command to string.
+var RCCommandName = map[uint8]string{
+	RCIncreasePower:            "increase power",
+	RCDecreasePower:            "decrease power",
+	RCHighestPower:             "highest power",
+	RCLowestPower:              "lowest power",
+	RCCeaseTransmission:        "cease transmission",
+	RCCeaseTransmissionRequest: "cease transmission request",
+}
+
+// rcCRCMask is applied to the 7-bit CRC of the reverse channel.
+const rcCRCMask uint8 = 0x7a
+
+// ReverseChannel is a reverse channel (RC) message, carried in a single
+// embedded signalling fragment.
+// ref: ETSI TS 102 361-1 7.1.5
+type ReverseChannel struct {
+	Command uint8
+}
+
+func (rc *ReverseChannel) String() string {
+	if name, ok := RCCommandName[rc.Command]; ok {
+		return fmt.Sprintf("reverse channel %s", name)
+	}
+	return fmt.Sprintf("reverse channel command %d", rc.Command)
+}
+
+// Bits packs the reverse channel to the 32 embedded signalling fragment bits.
+func (rc *ReverseChannel) Bits() []byte {
+	var (
+		crc  uint8
+		info = make([]byte, 11)
+	)
+	crc7(&crc, rc.Command, 4)
+	crc7end(&crc)
+	crc ^= rcCRCMask
+
+	for i := 0; i < 4; i++ {
+		info[i] = (rc.Command >> uint(3-i)) & 1
+	}
+	for i := 0; i < 7; i++ {
+		info[4+i] = (crc >> uint(6-i)) & 1
+	}
+
+	// Can't fail, info is always 11 bits
+	bits, _ := vbptc.EncodeSingleBurst(info)
+	return bits
+}
+
+// NullEmbeddedMessage returns the 32 embedded signalling fragment bits of the
+// null embedded message, sent in voice burst F if there is no reverse channel.
+func NullEmbeddedMessage() []byte {
+	return make([]byte, EMBSignallingLCFragmentBits)
+}
+
+// ParseReverseChannel parses a single embedded signalling fragment, it returns
+// nil if the fragment contains the null embedded message.
+func ParseReverseChannel(bits []byte) (*ReverseChannel, error) {
+	if bits == nil {
+		return nil, errors.New("dmr/rc: bits can't be nil")
+	}
+	if len(bits) != EMBSignallingLCFragmentBits {
+		return nil, fmt.Errorf("dmr/rc: expected %d bits, got %d", EMBSignallingLCFragmentBits, len(bits))
+	}
+
+	var null = true
+	for _, b := range bits {
+		if b != 0 {
+			null = false
+			break
+		}
+	}
+	if null {
+		return nil, nil
+	}
+
+	info, err := vbptc.DecodeSingleBurst(bits)
+	if err != nil {
+		return nil, err
+	}
+
+	var rc = &ReverseChannel{
+		Command: info[0]<<3 | info[1]<<2 | info[2]<<1 | info[3],
+	}
+
+	var crc, check uint8
+	for i := 0; i < 7; i++ {
+		check = check<<1 | info[4+i]
+	}
+	crc7(&crc, rc.Command, 4)
+	crc7end(&crc)
+	if crc^rcCRCMask != check {
+		return nil, errors.New("dmr/rc: checksum error")
+	}
+
+	return rc, nil
+}
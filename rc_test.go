@@ -0,0 +1,44 @@
+package dmr
+
+import "testing"
+
+func TestReverseChannel(t *testing.T) {
+	for command := range RCCommandName {
+		want := &ReverseChannel{Command: command}
+		bits := want.Bits()
+		if len(bits) != EMBSignallingLCFragmentBits {
+			t.Fatalf("encode failed: expected %d bits, got %d", EMBSignallingLCFragmentBits, len(bits))
+		}
+
+		// A single bit error in the Hamming (16,11) row is repaired
+		for i := 0; i < 16; i++ {
+			test := make([]byte, len(bits))
+			copy(test, bits)
+			test[(i*17)%32] ^= 1
+
+			got, err := ParseReverseChannel(test)
+			if err != nil {
+				t.Fatalf("bit %d flipped: decode failed: %v", i, err)
+			}
+			if got == nil || got.Command != command {
+				t.Fatalf("bit %d flipped: expected %s, got %v", i, want, got)
+			}
+		}
+
+		got, err := ParseReverseChannel(bits)
+		if err != nil {
+			t.Fatalf("decode failed: %v", err)
+		}
+		if got == nil || got.Command != command {
+			t.Fatalf("expected %s, got %v", want, got)
+		}
+	}
+
+	rc, err := ParseReverseChannel(NullEmbeddedMessage())
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if rc != nil {
+		t.Fatalf("expected null embedded message, got %s", rc)
+	}
+}
@@ -0,0 +1,87 @@
+package dmr
+
+import (
+	"fmt"
+
+	"github.com/pd0mz/go-dmr/fec"
+)
+
+// SlotType contains the color code and data type of a data burst.
+type SlotType struct {
+	ColorCode uint8
+	DataType  uint8
+}
+
+func (st *SlotType) String() string {
+	return fmt.Sprintf("color code %d, %s (%d)", st.ColorCode, DataTypeName[st.DataType], st.DataType)
+}
+
+// Bits packs the slot type, including the Golay(20, 8, 7) parity.
+func (st *SlotType) Bits() []byte {
+	var bits = make([]byte, SlotTypeBits)
+	for i := 0; i < 4; i++ {
+		bits[i] = (st.ColorCode >> uint(3-i)) & 0x01
+		bits[4+i] = (st.DataType >> uint(3-i)) & 0x01
+	}
+	copy(bits[8:], fec.Golay_20_8_Parity(bits[:8]))
+	return bits
+}
+
+// ParseDataType returns the data type for the 4 bit data type field, reserved
+// values are returned as UnknownSlotType.
+func ParseDataType(n uint8) uint8 {
+	if n > Rate1Data {
+		return UnknownSlotType
+	}
+	return n
+}
+
+// ParseSlotType parses the slot type bits, up to 3 bit errors are corrected.
+func ParseSlotType(bits []byte) (*SlotType, error) {
+	if len(bits) != SlotTypeBits {
+		return nil, fmt.Errorf("dmr/slot type: expected %d bits, got %d", SlotTypeBits, len(bits))
+	}
+
+	var corrected = make([]byte, SlotTypeBits)
+	copy(corrected, bits)
+	if _, err := fec.Golay_20_8_Correct(corrected); err != nil {
+		return nil, err
+	}
+
+	var st = &SlotType{}
+	for i := 0; i < 4; i++ {
+		st.ColorCode = st.ColorCode<<1 | corrected[i]
+		st.DataType = st.DataType<<1 | corrected[4+i]
+	}
+	st.DataType = ParseDataType(st.DataType)
+	return st, nil
+}
+
+// ParseSlotType parses the slot type of a data burst.
+func (p *Packet) ParseSlotType() (*SlotType, error) {
+	return ParseSlotType(p.SlotTypeBits())
+}
+
+// UpdateDataType derives the data type from the burst itself, for packets
+// received from air interface sources. Data bursts take the data type from
+// the slot type, bursts carrying a voice SYNC pattern are voice burst A.
+// Voice bursts B to F carry no SYNC pattern and are left untouched.
+func (p *Packet) UpdateDataType() error {
+	if len(p.Bits) != PayloadBits {
+		return fmt.Errorf("dmr: expected %d bits, got %d", PayloadBits, len(p.Bits))
+	}
+
+	switch SyncPattern(p.SyncBits()) {
+	case SyncPatternBSSourcedVoice, SyncPatternMSSourcedVoice, SyncPatternDirectVoiceTS1, SyncPatternDirectVoiceTS2:
+		p.DataType = VoiceBurstA
+
+	case SyncPatternBSSourcedData, SyncPatternMSSourcedData, SyncPatternDirectDataTS1, SyncPatternDirectDataTS2:
+		st, err := p.ParseSlotType()
+		if err != nil {
+			return err
+		}
+		p.DataType = st.DataType
+	}
+
+	return nil
+}
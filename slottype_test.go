@@ -0,0 +1,72 @@
+package dmr
+
+import "testing"
+
+func TestSlotType(t *testing.T) {
+	for cc := uint8(0); cc < 16; cc++ {
+		for dt := uint8(0); dt < 16; dt++ {
+			want := &SlotType{ColorCode: cc, DataType: dt}
+			bits := want.Bits()
+
+			// Introduce up to 3 bit errors
+			for errs := 0; errs <= 3; errs++ {
+				var test = make([]byte, SlotTypeBits)
+				copy(test, bits)
+				for i := 0; i < errs; i++ {
+					test[(int(cc)+int(dt)+i*7)%SlotTypeBits] ^= 0x01
+				}
+
+				st, err := ParseSlotType(test)
+				if err != nil {
+					t.Fatalf("decode failed with %d bit errors: %v", errs, err)
+				}
+				if st.ColorCode != want.ColorCode || st.DataType != ParseDataType(want.DataType) {
+					t.Fatalf("decode failed with %d bit errors: expected %s, got %s", errs, want, st)
+				}
+			}
+		}
+	}
+}
+
+func TestPacketUpdateDataType(t *testing.T) {
+	var (
+		st = &SlotType{ColorCode: 1, DataType: Rate12Data}
+		p  = &Packet{DataType: Idle}
+	)
+	if err := p.SetInfoBits(make([]byte, InfoBits), st.Bits(), SyncPatternBSSourcedData); err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	if err := p.UpdateDataType(); err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if p.DataType != st.DataType {
+		t.Fatalf("decode failed: expected %s, got %s", DataTypeName[st.DataType], DataTypeName[p.DataType])
+	}
+}
+
+func TestParseDataType(t *testing.T) {
+	for n := uint8(0); n < 16; n++ {
+		want := n
+		if n > Rate1Data {
+			want = UnknownSlotType
+		}
+		if dt := ParseDataType(n); dt != want {
+			t.Fatalf("data type %d: expected %s, got %s", n, DataTypeName[want], DataTypeName[dt])
+		}
+	}
+
+	// Reserved data types are not mistaken for voice bursts
+	var (
+		st = &SlotType{ColorCode: 1, DataType: 12}
+		p  = &Packet{}
+	)
+	if err := p.SetInfoBits(make([]byte, InfoBits), st.Bits(), SyncPatternBSSourcedData); err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	if err := p.UpdateDataType(); err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if p.DataType != UnknownSlotType {
+		t.Fatalf("expected %s, got %s", DataTypeName[UnknownSlotType], DataTypeName[p.DataType])
+	}
+}
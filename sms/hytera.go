@@ -0,0 +1,136 @@
+package sms
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/pd0mz/go-dmr/hdap"
+)
+
+// HyteraPort is the UDP port of the Hytera text message service.
+const HyteraPort = 5016
+
+// Hytera text message header and terminator.
+const (
+	HyteraHeader   = hdap.ServiceTMP // Text message service
+	HyteraReliable = hdap.Reliable   // Reliable delivery requested
+	HyteraEnd      = hdap.End
+)
+
+// Hytera text message opcodes.
+const (
+	HyteraPrivateMessage    uint16 = 0x00a1
+	HyteraPrivateMessageAck uint16 = 0x80a1
+	HyteraGroupMessage      uint16 = 0x00b1
+	HyteraGroupMessageAck   uint16 = 0x80b1
+)
+
+// Hytera is a Hytera text message, carried as HDAP message. The payload
+// layout is:
+//
+//	request ID (4 octets)
+//	destination IP address or group ID (4 octets)
+//	source IP address (4 octets)
+//	text (UTF-16 little endian) or result (1 octet, acknowledgements only)
+type Hytera struct {
+	Reliable  bool
+	Opcode    uint16
+	RequestID uint32
+	DstID     uint32
+	SrcID     uint32
+	Result    uint8 // Acknowledgements only, 0 is OK
+	Text      string
+}
+
+func (m *Hytera) String() string {
+	switch m.Opcode {
+	case HyteraPrivateMessageAck, HyteraGroupMessageAck:
+		return fmt.Sprintf("Hytera message ACK, request %d, %d->%d, result %d",
+			m.RequestID, m.SrcID, m.DstID, m.Result)
+	default:
+		return fmt.Sprintf("Hytera message, request %d, %d->%d, group %t, text %q",
+			m.RequestID, m.SrcID, m.DstID, m.Group(), m.Text)
+	}
+}
+
+// Group returns true if the message is sent to a group.
+func (m *Hytera) Group() bool {
+	return m.Opcode == HyteraGroupMessage || m.Opcode == HyteraGroupMessageAck
+}
+
+// Ack builds the acknowledgement for the message.
+func (m *Hytera) Ack() *Hytera {
+	return &Hytera{
+		Opcode:    m.Opcode | 0x8000,
+		RequestID: m.RequestID,
+		DstID:     m.SrcID,
+		SrcID:     m.DstID,
+	}
+}
+
+// ParseHytera parses a Hytera text message from the UDP payload.
+func ParseHytera(data []byte) (*Hytera, error) {
+	p, err := hdap.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	if p.Service != HyteraHeader {
+		return nil, fmt.Errorf("sms/hytera: unexpected header %#02x", p.Service)
+	}
+	if len(p.Payload) < 12 {
+		return nil, fmt.Errorf("sms/hytera: expected at least 12 bytes payload, got %d", len(p.Payload))
+	}
+
+	var (
+		payload = p.Payload
+		m       = &Hytera{
+			Reliable:  p.Reliable,
+			Opcode:    p.Opcode,
+			RequestID: binary.BigEndian.Uint32(payload[0:]),
+			DstID:     binary.BigEndian.Uint32(payload[4:]) & 0x00ffffff,
+			SrcID:     binary.BigEndian.Uint32(payload[8:]) & 0x00ffffff,
+		}
+	)
+
+	switch m.Opcode {
+	case HyteraPrivateMessage, HyteraGroupMessage:
+		m.Text = decodeUTF16(payload[12:])
+	case HyteraPrivateMessageAck, HyteraGroupMessageAck:
+		if len(payload) > 12 {
+			m.Result = payload[12]
+		}
+	default:
+		return nil, fmt.Errorf("sms/hytera: unsupported opcode %#04x", m.Opcode)
+	}
+
+	return m, nil
+}
+
+// Bytes packs the message as UDP payload, text is encoded as UTF-16.
+func (m *Hytera) Bytes() ([]byte, error) {
+	var payload = make([]byte, 12)
+	binary.BigEndian.PutUint32(payload[0:], m.RequestID)
+	if m.Group() {
+		binary.BigEndian.PutUint32(payload[4:], m.DstID&0x00ffffff)
+	} else {
+		binary.BigEndian.PutUint32(payload[4:], uint32(hdap.Network)<<24|m.DstID&0x00ffffff)
+	}
+	binary.BigEndian.PutUint32(payload[8:], uint32(hdap.Network)<<24|m.SrcID&0x00ffffff)
+
+	switch m.Opcode {
+	case HyteraPrivateMessage, HyteraGroupMessage:
+		payload = append(payload, encodeUTF16(m.Text)...)
+	case HyteraPrivateMessageAck, HyteraGroupMessageAck:
+		payload = append(payload, m.Result)
+	default:
+		return nil, fmt.Errorf("sms/hytera: unsupported opcode %#04x", m.Opcode)
+	}
+
+	p := &hdap.PDU{
+		Service:  HyteraHeader,
+		Reliable: m.Reliable,
+		Opcode:   m.Opcode,
+		Payload:  payload,
+	}
+	return p.Bytes()
+}
@@ -0,0 +1,151 @@
+package sms
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// MotorolaPort is the UDP port of the Motorola Text Messaging Service (TMS).
+const MotorolaPort = 4007
+
+// Motorola TMS header flags and PDU types.
+const (
+	MotorolaExtension   uint8 = 0x80 // Header extension follows
+	MotorolaNoAck       uint8 = 0x40 // No acknowledgement requested
+	MotorolaControlUser uint8 = 0x20 // User (not control) PDU
+	MotorolaPDUMask     uint8 = 0x1f
+
+	MotorolaPDUText uint8 = 0x00 // Text message
+	MotorolaPDUAck  uint8 = 0x1f // Acknowledgement
+)
+
+// Motorola TMS text encodings, as carried in the second header extension.
+const (
+	MotorolaEncodingISO8859_1 uint8 = 0x00
+	MotorolaEncodingUTF16     uint8 = 0x04
+)
+
+// motorolaPrefix is prepended to the text by Motorola radios.
+const motorolaPrefix = "\r\n"
+
+// Motorola is a Motorola TMS message. The layout is:
+//
+//	length (2 octets, big endian) of the remainder
+//	header (1 octet), extension, no ack, control/user flags and PDU type
+//	address length (1 octet) followed by the address
+//	sequence number (1 octet, if the header is extended)
+//	encoding (1 octet, if the sequence number is extended)
+//	text (UTF-16 little endian, text messages only)
+type Motorola struct {
+	PDUType        uint8
+	AckRequested   bool
+	Address        string
+	SequenceNumber uint8
+	Text           string
+}
+
+func (m *Motorola) String() string {
+	switch m.PDUType {
+	case MotorolaPDUAck:
+		return fmt.Sprintf("Motorola TMS ACK, sequence %d", m.SequenceNumber)
+	default:
+		return fmt.Sprintf("Motorola TMS text, ack %t, sequence %d, address %q, text %q",
+			m.AckRequested, m.SequenceNumber, m.Address, m.Text)
+	}
+}
+
+// Ack builds the acknowledgement for the message.
+func (m *Motorola) Ack() *Motorola {
+	return &Motorola{
+		PDUType:        MotorolaPDUAck,
+		SequenceNumber: m.SequenceNumber,
+	}
+}
+
+// ParseMotorola parses a Motorola TMS message from the UDP payload.
+func ParseMotorola(data []byte) (*Motorola, error) {
+	if len(data) < 4 {
+		return nil, fmt.Errorf("sms/motorola: expected at least 4 bytes, got %d", len(data))
+	}
+	var size = int(binary.BigEndian.Uint16(data))
+	if size < 2 || size+2 > len(data) {
+		return nil, fmt.Errorf("sms/motorola: invalid length %d for %d bytes", size, len(data)-2)
+	}
+	data = data[2 : 2+size]
+
+	var (
+		header = data[0]
+		m      = &Motorola{
+			PDUType:      header & MotorolaPDUMask,
+			AckRequested: header&MotorolaNoAck == 0 && header&MotorolaPDUMask == MotorolaPDUText,
+		}
+		o = 2 + int(data[1])
+	)
+	if o > len(data) {
+		return nil, fmt.Errorf("sms/motorola: address length %d exceeds %d bytes", data[1], len(data)-2)
+	}
+	m.Address = string(data[2:o])
+
+	var encoding = MotorolaEncodingUTF16
+	if header&MotorolaExtension > 0 {
+		if o >= len(data) {
+			return nil, errors.New("sms/motorola: missing sequence number")
+		}
+		m.SequenceNumber = data[o] & MotorolaPDUMask
+		if data[o]&MotorolaExtension > 0 {
+			if o++; o >= len(data) {
+				return nil, errors.New("sms/motorola: missing encoding")
+			}
+			encoding = data[o] & 0x0f
+			// Skip any further extensions
+			for data[o]&MotorolaExtension > 0 && o+1 < len(data) {
+				o++
+			}
+		}
+		o++
+	}
+
+	if m.PDUType != MotorolaPDUText {
+		return m, nil
+	}
+
+	switch encoding {
+	case MotorolaEncodingUTF16:
+		m.Text = decodeUTF16(data[o:])
+	case MotorolaEncodingISO8859_1:
+		m.Text = decodeLatin1(data[o:])
+	default:
+		return nil, fmt.Errorf("sms/motorola: unsupported encoding %#02x", encoding)
+	}
+	m.Text = strings.TrimPrefix(m.Text, motorolaPrefix)
+	return m, nil
+}
+
+// Bytes packs the message as UDP payload, text is encoded as UTF-16.
+func (m *Motorola) Bytes() ([]byte, error) {
+	if len(m.Address) > 0xff {
+		return nil, fmt.Errorf("sms/motorola: address of %d bytes too long", len(m.Address))
+	}
+
+	var header = MotorolaExtension | MotorolaControlUser | (m.PDUType & MotorolaPDUMask)
+	if m.PDUType == MotorolaPDUText && !m.AckRequested {
+		header |= MotorolaNoAck
+	}
+
+	var data = []byte{0x00, 0x00, header, uint8(len(m.Address))}
+	data = append(data, m.Address...)
+	if m.PDUType == MotorolaPDUText {
+		data = append(data, MotorolaExtension|(m.SequenceNumber&MotorolaPDUMask), MotorolaEncodingUTF16)
+		data = append(data, encodeUTF16(motorolaPrefix+m.Text)...)
+	} else {
+		data = append(data, m.SequenceNumber&MotorolaPDUMask)
+	}
+
+	if len(data)-2 > 0xffff {
+		return nil, fmt.Errorf("sms/motorola: message of %d bytes too long", len(data))
+	}
+	binary.BigEndian.PutUint16(data, uint16(len(data)-2))
+	return data, nil
+}
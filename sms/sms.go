@@ -0,0 +1,45 @@
+// Package sms implements the text message formats used by radios over IP based
+// packet data.
+package sms
+
+import (
+	"unicode/utf16"
+)
+
+// decodeUTF16 decodes UTF-16 little endian text, up to the first NUL.
+func decodeUTF16(data []byte) string {
+	var u = make([]uint16, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		c := uint16(data[i]) | uint16(data[i+1])<<8
+		if c == 0 {
+			break
+		}
+		u = append(u, c)
+	}
+	return string(utf16.Decode(u))
+}
+
+// encodeUTF16 encodes text as UTF-16 little endian, without terminator.
+func encodeUTF16(text string) []byte {
+	var (
+		u    = utf16.Encode([]rune(text))
+		data = make([]byte, len(u)*2)
+	)
+	for i, c := range u {
+		data[i*2] = uint8(c)
+		data[i*2+1] = uint8(c >> 8)
+	}
+	return data
+}
+
+// decodeLatin1 decodes ISO 8859-1 text, up to the first NUL.
+func decodeLatin1(data []byte) string {
+	var r = make([]rune, 0, len(data))
+	for _, c := range data {
+		if c == 0 {
+			break
+		}
+		r = append(r, rune(c))
+	}
+	return string(r)
+}
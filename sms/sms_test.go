@@ -0,0 +1,66 @@
+package sms
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestMotorola(t *testing.T) {
+	// Text message "Hi" with ACK requested, sequence number 14
+	data := []byte{0x00, 0x0c, 0xa0, 0x00, 0x8e, 0x04, 0x0d, 0x00, 0x0a, 0x00, 0x48, 0x00, 0x69, 0x00}
+	m, err := ParseMotorola(data)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if m.PDUType != MotorolaPDUText || !m.AckRequested || m.SequenceNumber != 14 || m.Text != "Hi" {
+		t.Fatalf("decode failed: got %s", m)
+	}
+
+	test, err := m.Bytes()
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	if hex.EncodeToString(test) != hex.EncodeToString(data) {
+		t.Fatalf("encode failed: expected %x, got %x", data, test)
+	}
+
+	ack, err := m.Ack().Bytes()
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	if m, err = ParseMotorola(ack); err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if m.PDUType != MotorolaPDUAck || m.SequenceNumber != 14 {
+		t.Fatalf("decode failed: got %s", m)
+	}
+}
+
+func TestHytera(t *testing.T) {
+	want := &Hytera{
+		Reliable:  true,
+		Opcode:    HyteraPrivateMessage,
+		RequestID: 1,
+		DstID:     2042214,
+		SrcID:     2043044,
+		Text:      "CQCQCQ PD0MZ",
+	}
+
+	data, err := want.Bytes()
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	test, err := ParseHytera(data)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if *test != *want {
+		t.Fatalf("decode failed: expected %s, got %s", want, test)
+	}
+
+	// Corrupt the payload
+	data[10] ^= 0x01
+	if _, err = ParseHytera(data); err == nil {
+		t.Fatal("decode failed: expected checksum error")
+	}
+}
@@ -0,0 +1,437 @@
+package terminal
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"time"
+
+	"github.com/pd0mz/go-dmr"
+	"github.com/pd0mz/go-dmr/bptc"
+)
+
+// Confirmed data delivery parameters.
+var (
+	// DataBurstInterval is the time between two bursts we send on a timeslot
+	DataBurstInterval = time.Millisecond * 60
+	// DataResponseTimeout is the time we wait for a response to confirmed data
+	DataResponseTimeout = time.Second * 5
+	// DataRetries is the number of times confirmed data is sent again if no response was received
+	DataRetries = 3
+)
+
+// maxSelectiveAckRequests caps the number of selective ACKs for a single packet.
+const maxSelectiveAckRequests = 25
+
+// dataResponse is a response to confirmed data we have sent.
+type dataResponse struct {
+	data   *dmr.ResponseData
+	bitmap []byte // Selective ACK bitmap, if any
+}
+
+// dataTransfer keeps track of confirmed data we are sending.
+type dataTransfer struct {
+	header   *dmr.DataHeader
+	blocks   []*dmr.DataBlock
+	dataType uint8
+	response chan *dataResponse
+}
+
+// SendData sends the fragment as data blocks of the given data type, preceded
+// by the data header. The number of blocks to follow in the header is filled
+// in. If the header requests a response, SendData blocks until the remote
+// acknowledged the data, failed blocks are retransmitted as requested by the
+// remote.
+func (t *Terminal) SendData(ts uint8, h *dmr.DataHeader, f *dmr.DataFragment, dataType uint8) error {
+	return t.sendData(ts, h, f, dataType, time.Time{})
+}
+
+// sendData implements SendData, if the deadline is not zero the transfer is
+// aborted when it expires.
+func (t *Terminal) sendData(ts uint8, h *dmr.DataHeader, f *dmr.DataFragment, dataType uint8, deadline time.Time) error {
+	if ts > 1 {
+		return fmt.Errorf("terminal: invalid timeslot %d", ts)
+	}
+	if h == nil || f == nil {
+		return errors.New("terminal: header and fragment can't be nil")
+	}
+
+	var confirmed = h.ResponseRequested
+	blocks, err := f.DataBlocks(dataType, confirmed)
+	if err != nil {
+		return err
+	}
+	setPadOctetCount(h, len(blocks)*int(blocks[0].Length)-4-f.Stored)
+
+	slot := t.slot[ts]
+	if !confirmed {
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			return os.ErrDeadlineExceeded
+		}
+		if err = setBlocksToFollow(h, len(blocks), 0); err != nil {
+			return err
+		}
+		return t.sendDataBlocks(ts, h, blocks, dataType)
+	}
+
+	slot.mutex.Lock()
+	if slot.tx != nil {
+		slot.mutex.Unlock()
+		return errors.New("terminal: confirmed data transfer already in progress")
+	}
+	tx := &dataTransfer{
+		header:   h,
+		blocks:   blocks,
+		dataType: dataType,
+		response: make(chan *dataResponse, 1),
+	}
+	slot.tx = tx
+	var (
+		sequence = slot.txSendSequence
+		synced   = slot.txSynced
+	)
+	slot.mutex.Unlock()
+
+	// Unless acknowledged, the next transfer starts over with a resync
+	var acknowledged bool
+	defer func() {
+		slot.txComplete(sequence, acknowledged)
+		slot.mutex.Lock()
+		slot.tx = nil
+		slot.mutex.Unlock()
+	}()
+
+	var (
+		pending   = blocks
+		retries   int
+		selective int
+	)
+	if d, ok := h.Data.(*dmr.ConfirmedData); ok {
+		// The first packet we send resynchronises the receiver's N(S)
+		d.SendSequenceNumber = sequence
+		d.Resync = !synced
+	}
+	for {
+		var timeout = DataResponseTimeout
+		if !deadline.IsZero() {
+			if timeout = time.Until(deadline); timeout <= 0 {
+				return os.ErrDeadlineExceeded
+			}
+			if timeout > DataResponseTimeout {
+				timeout = DataResponseTimeout
+			}
+		}
+
+		if err = setBlocksToFollow(h, len(pending), len(blocks)); err != nil {
+			return err
+		}
+		if err = t.sendDataBlocks(ts, h, pending, dataType); err != nil {
+			return err
+		}
+
+		select {
+		case r := <-tx.response:
+			switch r.data.ClassType {
+			case dmr.ResponseTypeACK:
+				log.Debugf("[slot %d] data %d->%d acknowledged\n", ts+1, h.SrcID, h.DstID)
+				acknowledged = true
+				return nil
+
+			case dmr.ResponseTypeSelectiveACK:
+				if selective++; selective > maxSelectiveAckRequests {
+					return errors.New("terminal: max selective ACK reached")
+				}
+				if pending = selectedBlocks(blocks, r.bitmap); len(pending) == 0 {
+					// Nothing to retransmit, treat as ACK
+					acknowledged = true
+					return nil
+				}
+				log.Debugf("[slot %d] retransmitting %d of %d blocks\n", ts+1, len(pending), len(blocks))
+
+			default:
+				return fmt.Errorf("terminal: data not acknowledged: %s", dmr.ResponseTypeName[r.data.ClassType])
+			}
+
+		case <-time.After(timeout):
+			if !deadline.IsZero() && !time.Now().Before(deadline) {
+				return os.ErrDeadlineExceeded
+			}
+			if retries++; retries > DataRetries {
+				return errors.New("terminal: timeout waiting for data response")
+			}
+			log.Debugf("[slot %d] no data response, retry %d/%d\n", ts+1, retries, DataRetries)
+			pending = blocks
+		}
+	}
+}
+
+// txComplete updates the N(S) after a confirmed data transfer, if the data
+// was not acknowledged the next transfer resynchronises the receiver.
+func (s *Slot) txComplete(sequence uint8, acknowledged bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if acknowledged {
+		s.txSendSequence = (sequence + 1) & 0x07
+	}
+	s.txSynced = acknowledged
+}
+
+// setBlocksToFollow updates the number of blocks in the data header, if sent
+// is less than total, the header is flagged as a retransmission.
+func setBlocksToFollow(h *dmr.DataHeader, sent, total int) error {
+	switch d := h.Data.(type) {
+	case *dmr.ConfirmedData:
+		d.BlocksToFollow = uint8(sent)
+		d.FullMessage = sent >= total
+	case *dmr.UnconfirmedData:
+		d.BlocksToFollow = uint8(sent)
+		d.FullMessage = true
+	case *dmr.ShortDataDefinedData:
+		d.AppendedBlocks = uint8(sent)
+		d.FullMessage = sent >= total
+	case *dmr.ShortDataRawData:
+		d.AppendedBlocks = uint8(sent)
+		d.FullMessage = sent >= total
+	case *dmr.ResponseData:
+		d.BlocksToFollow = uint8(sent)
+	default:
+		return fmt.Errorf("terminal: can't send data with header %T", h.Data)
+	}
+	return nil
+}
+
+// setPadOctetCount updates the number of pad octets in the data header.
+func setPadOctetCount(h *dmr.DataHeader, pad int) {
+	switch d := h.Data.(type) {
+	case *dmr.ConfirmedData:
+		d.PadOctetCount = uint8(pad)
+	case *dmr.UnconfirmedData:
+		d.PadOctetCount = uint8(pad)
+	}
+}
+
+// userData returns the data in the fragment, without the pad octets and CRC.
+func userData(h *dmr.DataHeader, f *dmr.DataFragment) []byte {
+	var size = f.Stored - 4
+	switch d := h.Data.(type) {
+	case *dmr.ConfirmedData:
+		size -= int(d.PadOctetCount)
+	case *dmr.UnconfirmedData:
+		size -= int(d.PadOctetCount)
+	}
+	if size < 0 {
+		size = 0
+	}
+	return f.Data[:size]
+}
+
+// retransmittedBlocks returns the number of blocks to follow, if the header
+// announces retransmission of part of a confirmed data packet.
+func retransmittedBlocks(h *dmr.DataHeader) (int, bool) {
+	if !h.ResponseRequested {
+		return 0, false
+	}
+	switch d := h.Data.(type) {
+	case *dmr.ConfirmedData:
+		return int(d.BlocksToFollow), !d.FullMessage
+	case *dmr.ShortDataDefinedData:
+		return int(d.AppendedBlocks), !d.FullMessage
+	case *dmr.ShortDataRawData:
+		return int(d.AppendedBlocks), !d.FullMessage
+	}
+	return 0, false
+}
+
+// selectiveAckBitmap builds the selective ACK bitmap, a bit is cleared for
+// every block that has to be retransmitted.
+func selectiveAckBitmap(selective []bool) []byte {
+	var bitmap = make([]byte, (len(selective)+7)/8)
+	for i := range bitmap {
+		bitmap[i] = 0xff
+	}
+	for i, retransmit := range selective {
+		if retransmit {
+			bitmap[i/8] &^= 0x80 >> uint(i%8)
+		}
+	}
+	return bitmap
+}
+
+// selectedBlocks returns the blocks to be retransmitted according to the
+// selective ACK bitmap.
+func selectedBlocks(blocks []*dmr.DataBlock, bitmap []byte) []*dmr.DataBlock {
+	var selected []*dmr.DataBlock
+	for _, block := range blocks {
+		i := int(block.Serial)
+		if i/8 < len(bitmap) && bitmap[i/8]&(0x80>>uint(i%8)) == 0 {
+			selected = append(selected, block)
+		}
+	}
+	return selected
+}
+
+// sendDataBlocks sends the data header followed by the data blocks.
+func (t *Terminal) sendDataBlocks(ts uint8, h *dmr.DataHeader, blocks []*dmr.DataBlock, dataType uint8) error {
+	header, err := h.Bytes()
+	if err != nil {
+		return err
+	}
+
+	var (
+		bits     = make([]byte, dmr.InfoBits)
+		streamID = rand.Uint32()
+		sequence uint8
+	)
+	if err = bptc.Encode(header, bits); err != nil {
+		return err
+	}
+	if err = t.sendBurst(ts, h, dmr.Data, bits, streamID, sequence); err != nil {
+		return err
+	}
+
+	for _, block := range blocks {
+		if bits, err = encodeDataBlock(block, dataType, h.ResponseRequested); err != nil {
+			return err
+		}
+		sequence++
+		time.Sleep(DataBurstInterval)
+		if err = t.sendBurst(ts, h, dataType, bits, streamID, sequence); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sendBurst sends the info bits as a data burst.
+func (t *Terminal) sendBurst(ts uint8, h *dmr.DataHeader, dataType uint8, info []byte, streamID uint32, sequence uint8) error {
+	p := &dmr.Packet{
+		Timeslot: ts,
+		Sequence: sequence,
+		SrcID:    h.SrcID,
+		DstID:    h.DstID,
+		StreamID: streamID,
+		DataType: dataType,
+		CallType: dmr.CallTypePrivate,
+	}
+	if h.DstIsGroup {
+		p.CallType = dmr.CallTypeGroup
+	}
+
+	st := &dmr.SlotType{ColorCode: t.ColorCode, DataType: dataType}
+	if err := p.SetInfoBits(info, st.Bits(), dmr.SyncPatternFor(dmr.SourceBS, false, ts)); err != nil {
+		return err
+	}
+	return t.Send(p)
+}
+
+// sendResponse sends a response header, optionally followed by the
+// selective ACK bitmap, to the originator of the data in the slot.
+func (t *Terminal) sendResponse(p *dmr.Packet, classType uint8, bitmap []byte) {
+	slot := t.slot[p.Timeslot]
+
+	// Responses to confirmed data carry the N(S) of the data as status
+	var status uint8
+	if d, ok := slot.data.header.Data.(*dmr.ConfirmedData); ok {
+		status = d.SendSequenceNumber
+	}
+
+	h := &dmr.DataHeader{
+		PacketFormat:       dmr.PacketFormatResponse,
+		ServiceAccessPoint: slot.data.header.ServiceAccessPoint,
+		DstID:              slot.data.header.SrcID,
+		SrcID:              t.ID,
+		Data: &dmr.ResponseData{
+			ClassType: classType,
+			Status:    status,
+		},
+	}
+	t.debugf(p, "sending %s response", dmr.ResponseTypeName[classType])
+
+	// We're called from the packet handler, send asynchronously
+	go func(ts uint8) {
+		var err error
+		if bitmap == nil {
+			err = t.sendDataBlocks(ts, h, nil, dmr.Rate12Data)
+		} else {
+			err = t.SendData(ts, h, &dmr.DataFragment{Data: bitmap}, dmr.Rate12Data)
+		}
+		if err != nil {
+			log.Errorf("[slot %d] error sending %s response: %v\n", ts+1, dmr.ResponseTypeName[classType], err)
+		}
+	}(p.Timeslot)
+}
+
+// sendSelectiveAck requests retransmission of the failed blocks.
+func (t *Terminal) sendSelectiveAck(p *dmr.Packet, selective []bool) error {
+	slot := t.slot[p.Timeslot]
+	slot.selectiveAckRequestsSent++
+	slot.data.retransmit = true
+	t.sendResponse(p, dmr.ResponseTypeSelectiveACK, selectiveAckBitmap(selective))
+	return nil
+}
+
+// handleResponse handles a response header addressed to us.
+func (t *Terminal) handleResponse(p *dmr.Packet, h *dmr.DataHeader, d *dmr.ResponseData) error {
+	slot := t.slot[p.Timeslot]
+
+	slot.mutex.Lock()
+	tx := slot.tx
+	slot.mutex.Unlock()
+	if tx == nil {
+		t.debugf(p, "ignored %s response, no data transfer in progress", dmr.ResponseTypeName[d.ClassType])
+		return nil
+	}
+	if h.SrcID != tx.header.DstID {
+		t.debugf(p, "ignored response from %d, expected %d", h.SrcID, tx.header.DstID)
+		return nil
+	}
+
+	if d.BlocksToFollow > 0 {
+		// Selective ACK, the bitmap follows in the data blocks
+		if err := t.dataCallStart(p); err != nil {
+			return err
+		}
+		slot.data.header = h
+		slot.data.packetHeaderValid = true
+		slot.data.blocksReceived = 0
+		slot.data.blocksExpected = int(d.BlocksToFollow)
+		slot.data.blocks = make([]*dmr.DataBlock, d.BlocksToFollow)
+		slot.fullMessageBlocks = int(d.BlocksToFollow)
+		return nil
+	}
+
+	t.deliverResponse(slot, &dataResponse{data: d})
+	return nil
+}
+
+// handleSelectiveAck passes the selective ACK bitmap to the data transfer.
+func (t *Terminal) handleSelectiveAck(p *dmr.Packet, f *dmr.DataFragment) error {
+	slot := t.slot[p.Timeslot]
+
+	d, ok := slot.data.header.Data.(*dmr.ResponseData)
+	if !ok {
+		return t.dataCallEnd(p)
+	}
+
+	var bitmap = make([]byte, f.Stored-4)
+	copy(bitmap, f.Data)
+	t.deliverResponse(slot, &dataResponse{data: d, bitmap: bitmap})
+	return t.dataCallEnd(p)
+}
+
+func (t *Terminal) deliverResponse(slot *Slot, r *dataResponse) {
+	slot.mutex.Lock()
+	defer slot.mutex.Unlock()
+
+	if slot.tx == nil {
+		return
+	}
+	select {
+	case slot.tx.response <- r:
+	default:
+		log.Warning("dropped data response, previous response not handled")
+	}
+}
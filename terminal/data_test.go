@@ -0,0 +1,412 @@
+package terminal
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pd0mz/go-dmr"
+	"github.com/pd0mz/go-dmr/bptc"
+)
+
+// testDataHeader decodes the data header in the packet.
+func testDataHeader(t *testing.T, p *dmr.Packet) *dmr.DataHeader {
+	var data = make([]byte, 12)
+	if err := bptc.Decode(p.InfoBits(), data); err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	h, err := dmr.ParseDataHeader(data, false)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	return h
+}
+
+// testResponses returns the class types of the responses in the packets.
+func testResponses(t *testing.T, packets []*dmr.Packet) []uint8 {
+	var responses []uint8
+	for _, p := range packets {
+		if p.DataType != dmr.Data {
+			continue
+		}
+		if d, ok := testDataHeader(t, p).Data.(*dmr.ResponseData); ok {
+			responses = append(responses, d.ClassType)
+		}
+	}
+	return responses
+}
+
+func TestRate12Data(t *testing.T) {
+	defer func(d time.Duration) { DataBurstInterval = d }(DataBurstInterval)
+	DataBurstInterval = 0
+
+	var (
+		a, ra, b, _ = testTerminals()
+		events      []Event
+		messages    []*Message
+	)
+	b.SetEventFunc(func(e Event) { events = append(events, e) })
+	b.SetMessageFunc(func(m *Message) { messages = append(messages, m) })
+
+	for _, confirmed := range []bool{false, true} {
+		events, messages = nil, nil
+		opts := DefaultMessageOptions
+		opts.DataType = dmr.Rate12Data
+		opts.Confirmed = confirmed
+		if err := a.SendMessage(2, false, "CQCQCQ PD0MZ, this message spans several rate 1/2 blocks", &opts); err != nil {
+			t.Fatalf("encode failed: %v", err)
+		}
+
+		if len(messages) != 1 || messages[0].Text != "CQCQCQ PD0MZ, this message spans several rate 1/2 blocks" || messages[0].SrcID != 1 || messages[0].DstID != 2 {
+			t.Fatalf("expected message, got %+v", messages)
+		}
+		if len(events) != 3 {
+			t.Fatalf("expected 3 events, got %d: %v", len(events), events)
+		}
+		e, ok := events[2].(*CallEnded)
+		if !ok || e.Call != DataCall || e.Lost != 0 {
+			t.Fatalf("expected data call ended, got %s", events[2])
+		}
+
+		// A header followed by rate 1/2 blocks, all of them were received
+		var sent = ra.packets()
+		ra.mutex.Lock()
+		ra.sent = nil
+		ra.mutex.Unlock()
+		if sent[0].DataType != dmr.Data {
+			t.Fatalf("expected data header, got %s", dmr.DataTypeName[sent[0].DataType])
+		}
+		for _, p := range sent[1:] {
+			if p.DataType != dmr.Rate12Data {
+				t.Fatalf("expected rate 1/2 data, got %s", dmr.DataTypeName[p.DataType])
+			}
+		}
+		if e.Frames != len(sent)-1 {
+			t.Fatalf("expected %d blocks, got %d", len(sent)-1, e.Frames)
+		}
+	}
+}
+
+func TestConfirmedDataRetransmission(t *testing.T) {
+	defer func(d time.Duration) { DataBurstInterval = d }(DataBurstInterval)
+	DataBurstInterval = 0
+
+	var (
+		a, ra, b, rb = testTerminals()
+		messages     []*Message
+		corrupted    bool
+	)
+	b.SetMessageFunc(func(m *Message) { messages = append(messages, m) })
+
+	// Corrupt the second block, the first time it is sent
+	ra.filter = func(p *dmr.Packet) bool {
+		if p.DataType == dmr.Rate34Data && p.Sequence == 2 && !corrupted {
+			corrupted = true
+			for i := 0; i < dmr.InfoHalfBits; i += 5 {
+				p.Bits[i] ^= 1
+			}
+		}
+		return true
+	}
+
+	opts := DefaultMessageOptions
+	opts.DataType = dmr.Rate34Data
+	opts.Confirmed = true
+	if err := a.SendMessage(2, false, "This confirmed message spans a couple of rate 3/4 blocks", &opts); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+	if len(messages) != 1 || messages[0].Text != "This confirmed message spans a couple of rate 3/4 blocks" {
+		t.Fatalf("expected message, got %+v", messages)
+	}
+
+	// The receiver requested the damaged block, then acknowledged
+	responses := testResponses(t, rb.packets())
+	if len(responses) != 2 || responses[0] != dmr.ResponseTypeSelectiveACK || responses[1] != dmr.ResponseTypeACK {
+		t.Fatalf("expected selective ACK and ACK, got %v", responses)
+	}
+
+	// The data header and blocks, followed by the retransmission of block 1
+	var (
+		sent           = ra.packets()
+		blocks         int
+		headers        []*dmr.DataHeader
+		resent         []*dmr.Packet
+		retransmission bool
+	)
+	for _, p := range sent {
+		if p.DataType == dmr.Data {
+			h := testDataHeader(t, p)
+			headers = append(headers, h)
+			retransmission = len(headers) > 1
+			if _, ok := retransmittedBlocks(h); ok != retransmission {
+				t.Fatalf("header %d: unexpected retransmission flag in %s", len(headers), h)
+			}
+			continue
+		}
+		if retransmission {
+			resent = append(resent, p)
+		} else {
+			blocks++
+		}
+	}
+	if len(headers) != 2 || len(resent) != 1 || blocks < 3 {
+		t.Fatalf("expected 2 headers and 1 retransmitted block, got %d headers, %d blocks and %d retransmitted", len(headers), blocks, len(resent))
+	}
+	if string(resent[0].InfoBits()) != string(sent[2].InfoBits()) {
+		t.Fatal("retransmitted block differs from block 1")
+	}
+}
+
+func TestConfirmedDataSelectiveAckLimit(t *testing.T) {
+	defer func(d time.Duration) { DataBurstInterval = d }(DataBurstInterval)
+	DataBurstInterval = 0
+
+	var (
+		a, ra, _, _ = testTerminals()
+		corrupt     bool
+	)
+
+	// Corrupt all blocks once the receiver is in sync, so the receiver keeps
+	// requesting them
+	ra.filter = func(p *dmr.Packet) bool {
+		if corrupt && p.DataType == dmr.Rate34Data {
+			for i := 0; i < dmr.InfoHalfBits; i += 5 {
+				p.Bits[i] ^= 1
+			}
+		}
+		return true
+	}
+
+	opts := DefaultMessageOptions
+	opts.DataType = dmr.Rate34Data
+	opts.Confirmed = true
+	if err := a.SendMessage(2, false, "This confirmed message spans a couple of rate 3/4 blocks", &opts); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+	if !a.slot[0].txSynced || a.slot[0].txSendSequence != 1 {
+		t.Fatalf("expected synced N(S) 1, got %d (synced %t)", a.slot[0].txSendSequence, a.slot[0].txSynced)
+	}
+
+	// The sender gives up, the next transfer resynchronises the receiver
+	corrupt = true
+	if err := a.SendMessage(2, false, "This confirmed message spans a couple of rate 3/4 blocks", &opts); err == nil || !strings.Contains(err.Error(), "selective ACK") {
+		t.Fatalf("expected max selective ACK, got %v", err)
+	}
+	if a.slot[0].txSynced || a.slot[0].txSendSequence != 1 {
+		t.Fatalf("expected unsynced N(S) 1, got %d (synced %t)", a.slot[0].txSendSequence, a.slot[0].txSynced)
+	}
+}
+
+func TestConfirmedDataRetransmissionHangTime(t *testing.T) {
+	defer func(d time.Duration) { DataBurstInterval = d }(DataBurstInterval)
+	defer func(d time.Duration) { CallHangTime = d }(CallHangTime)
+	DataBurstInterval = 0
+	CallHangTime = time.Millisecond * 50
+
+	var (
+		a, ra, b, _ = testTerminals()
+		mutex       sync.Mutex
+		messages    []*Message
+		ended       int
+		headers     int
+		corrupted   bool
+	)
+	b.SetMessageFunc(func(m *Message) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		messages = append(messages, m)
+	})
+	b.SetEventFunc(func(e Event) {
+		if _, ok := e.(*CallEnded); ok {
+			mutex.Lock()
+			ended++
+			mutex.Unlock()
+		}
+	})
+
+	// Corrupt the second block, and hold the retransmission until the call
+	// hang time on the receiver has expired
+	ra.filter = func(p *dmr.Packet) bool {
+		switch {
+		case p.DataType == dmr.Data:
+			if headers++; headers == 2 {
+				time.Sleep(CallHangTime * 3)
+			}
+		case p.DataType == dmr.Rate34Data && p.Sequence == 2 && !corrupted:
+			corrupted = true
+			for i := 0; i < dmr.InfoHalfBits; i += 5 {
+				p.Bits[i] ^= 1
+			}
+		}
+		return true
+	}
+
+	opts := DefaultMessageOptions
+	opts.DataType = dmr.Rate34Data
+	opts.Confirmed = true
+	if err := a.SendMessage(2, false, "This confirmed message spans a couple of rate 3/4 blocks", &opts); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if headers != 2 {
+		t.Fatalf("expected 2 data headers, got %d", headers)
+	}
+	if ended < 2 {
+		t.Fatalf("expected call to end on hang time and after retransmission, got %d call ends", ended)
+	}
+	if len(messages) != 1 || messages[0].Text != "This confirmed message spans a couple of rate 3/4 blocks" {
+		t.Fatalf("expected message, got %+v", messages)
+	}
+}
+
+func TestConfirmedDataDuplicate(t *testing.T) {
+	defer func(d time.Duration) { DataBurstInterval = d }(DataBurstInterval)
+	defer func(d time.Duration) { DataResponseTimeout = d }(DataResponseTimeout)
+	DataBurstInterval = 0
+	DataResponseTimeout = time.Millisecond * 100
+
+	var (
+		a, ra, b, rb = testTerminals()
+		messages     []*Message
+		dropped      bool
+	)
+	b.SetMessageFunc(func(m *Message) { messages = append(messages, m) })
+
+	// Drop the first ACK, the sender sends the data again
+	rb.filter = func(p *dmr.Packet) bool {
+		if p.DataType == dmr.Data && !dropped {
+			if d, ok := testDataHeader(t, p).Data.(*dmr.ResponseData); ok && d.ClassType == dmr.ResponseTypeACK {
+				dropped = true
+				return false
+			}
+		}
+		return true
+	}
+
+	send := func(text string) error {
+		data, err := dmr.BuildMessageData(text, dmr.DDFormatUTF16, true)
+		if err != nil {
+			t.Fatalf("encode failed: %v", err)
+		}
+		h := &dmr.DataHeader{
+			PacketFormat:       dmr.PacketFormatConfirmedData,
+			ResponseRequested:  true,
+			ServiceAccessPoint: dmr.ServiceAccessPointShortData,
+			DstID:              2,
+			SrcID:              1,
+			Data:               &dmr.ConfirmedData{},
+		}
+		return a.SendData(0, h, &dmr.DataFragment{Data: append([]byte{0x00, 0x00}, data...)}, dmr.Rate12Data)
+	}
+	if err := send("CQCQCQ PD0MZ"); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+	if len(messages) != 1 {
+		t.Fatalf("expected the message to be delivered once, got %d", len(messages))
+	}
+	if responses := testResponses(t, rb.packets()); len(responses) != 2 || responses[0] != dmr.ResponseTypeACK || responses[1] != dmr.ResponseTypeACK {
+		t.Fatalf("expected 2 ACKs, got %v", responses)
+	}
+
+	// Both transmissions have the same N(S)
+	var sequences []uint8
+	for _, p := range ra.packets() {
+		if p.DataType == dmr.Data {
+			sequences = append(sequences, testDataHeader(t, p).Data.(*dmr.ConfirmedData).SendSequenceNumber)
+		}
+	}
+	if len(sequences) != 2 || sequences[0] != sequences[1] {
+		t.Fatalf("expected the data to be sent twice with the same N(S), got %v", sequences)
+	}
+
+	// The next message is delivered
+	if err := send("QRZ?"); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+	if len(messages) != 2 || messages[1].Text != "QRZ?" {
+		t.Fatalf("expected the next message to be delivered, got %+v", messages)
+	}
+}
+
+func TestCompressedData(t *testing.T) {
+	defer func(d time.Duration) { DataBurstInterval = d }(DataBurstInterval)
+	DataBurstInterval = 0
+
+	a, ra, b, _ := testTerminals()
+	c, err := b.ListenPacket(4001, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	var buf = make([]byte, 512)
+	for _, confirmed := range []bool{false, true} {
+		// Payload sizes that leave a varying number of pad octets in the last block
+		for size := 1; size <= 24; size++ {
+			var payload = make([]byte, size)
+			for i := range payload {
+				payload[i] = byte(i + 1)
+			}
+			d := &dmr.UDPDatagram{
+				SrcIP:   dmr.IPv4Address(dmr.RadioNetwork, 1),
+				DstIP:   dmr.IPv4Address(dmr.RadioNetwork, 2),
+				SrcPort: 4001,
+				DstPort: 4001,
+				Data:    payload,
+			}
+			data, err := d.CompressedBytes(1, 2)
+			if err != nil {
+				t.Fatalf("encode failed: %v", err)
+			}
+
+			h := &dmr.DataHeader{
+				PacketFormat:       dmr.PacketFormatUnconfirmedData,
+				ServiceAccessPoint: dmr.ServiceAccessPointUDPIPHeaderCompression,
+				DstID:              2,
+				SrcID:              1,
+				Data:               &dmr.UnconfirmedData{},
+			}
+			if confirmed {
+				h.PacketFormat = dmr.PacketFormatConfirmedData
+				h.ResponseRequested = true
+				h.Data = &dmr.ConfirmedData{}
+			}
+			if err = a.SendData(0, h, &dmr.DataFragment{Data: data}, dmr.Rate12Data); err != nil {
+				t.Fatalf("send failed: %v", err)
+			}
+
+			c.SetReadDeadline(time.Now().Add(time.Second))
+			n, addr, err := c.ReadFrom(buf)
+			if err != nil {
+				t.Fatalf("%d bytes: read failed: %v", size, err)
+			}
+			if string(buf[:n]) != string(payload) {
+				t.Fatalf("%d bytes: expected %v, got %v", size, payload, buf[:n])
+			}
+			if ua := addr.(*net.UDPAddr); !ua.IP.Equal(d.SrcIP) || ua.Port != 4001 {
+				t.Fatalf("%d bytes: unexpected source %s", size, addr)
+			}
+		}
+	}
+
+	// At least some of the packets were padded
+	var padded bool
+	for _, p := range ra.packets() {
+		if p.DataType != dmr.Data {
+			continue
+		}
+		switch d := testDataHeader(t, p).Data.(type) {
+		case *dmr.UnconfirmedData:
+			padded = padded || d.PadOctetCount > 0
+		case *dmr.ConfirmedData:
+			padded = padded || d.PadOctetCount > 0
+		}
+	}
+	if !padded {
+		t.Fatal("expected pad octets in the last block")
+	}
+}
@@ -0,0 +1,174 @@
+package terminal
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pd0mz/go-dmr"
+	"github.com/pd0mz/go-dmr/lc"
+)
+
+// Call types of call events.
+const (
+	VoiceCall uint8 = iota
+	DataCall
+)
+
+var CallName = map[uint8]string{
+	VoiceCall: "voice",
+	DataCall:  "data",
+}
+
+// EventHeader contains the fields common to all events.
+type EventHeader struct {
+	Time     time.Time
+	Timeslot uint8
+	SrcID    uint32
+	DstID    uint32
+}
+
+// Header returns the event header.
+func (h *EventHeader) Header() *EventHeader {
+	return h
+}
+
+func (h *EventHeader) String() string {
+	return fmt.Sprintf("[slot %d][%d->%d]", h.Timeslot+1, h.SrcID, h.DstID)
+}
+
+// Event is a call or signalling event, use a type switch to handle the events
+// of interest.
+type Event interface {
+	Header() *EventHeader
+	String() string
+}
+
+// EventFunc is called for every event, it is called from the packet handler
+// so it should not block.
+type EventFunc func(Event)
+
+func (t *Terminal) SetEventFunc(f EventFunc) {
+	t.ef = f
+}
+
+// CallStarted is emitted when a voice or data call starts, late entry is set
+// if the voice call started without a voice LC header.
+type CallStarted struct {
+	EventHeader
+	Call      uint8
+	Group     bool
+	LateEntry bool
+}
+
+func (e *CallStarted) String() string {
+	return fmt.Sprintf("%s %s call started, group %t, late entry %t",
+		e.EventHeader.String(), CallName[e.Call], e.Group, e.LateEntry)
+}
+
+// CallEnded is emitted when a voice or data call ends. Frames is the number
+// of voice frames or data blocks received, lost the number of voice frames
+// or data blocks missed.
+type CallEnded struct {
+	EventHeader
+	Call     uint8
+	Group    bool
+	Duration time.Duration
+	Frames   int
+	Lost     int
+}
+
+func (e *CallEnded) String() string {
+	return fmt.Sprintf("%s %s call ended, group %t, duration %s, %d frames, %d lost",
+		e.EventHeader.String(), CallName[e.Call], e.Group, e.Duration, e.Frames, e.Lost)
+}
+
+// VoiceLCReceived is emitted for every voice LC header.
+type VoiceLCReceived struct {
+	EventHeader
+	LC *lc.LC
+}
+
+func (e *VoiceLCReceived) String() string {
+	return fmt.Sprintf("%s voice LC: %s", e.EventHeader.String(), e.LC)
+}
+
+// EmbeddedLCReceived is emitted for every LC embedded in voice bursts.
+type EmbeddedLCReceived struct {
+	EventHeader
+	LC *lc.LC
+}
+
+func (e *EmbeddedLCReceived) String() string {
+	return fmt.Sprintf("%s embedded LC: %s", e.EventHeader.String(), e.LC)
+}
+
+// TalkerAliasReceived is emitted when the talker alias of a voice call is
+// complete.
+type TalkerAliasReceived struct {
+	EventHeader
+	Alias string
+}
+
+func (e *TalkerAliasReceived) String() string {
+	return fmt.Sprintf("%s talker alias %q", e.EventHeader.String(), e.Alias)
+}
+
+// GPSReceived is emitted for GPS information embedded in voice calls and for
+// location reports.
+type GPSReceived struct {
+	EventHeader
+	Latitude  float64
+	Longitude float64
+	Info      *lc.GpsInfoPDU // Embedded GPS information only
+	Location  *Location      // Location reports only
+}
+
+func (e *GPSReceived) String() string {
+	return fmt.Sprintf("%s position %f,%f", e.EventHeader.String(), e.Latitude, e.Longitude)
+}
+
+// ReverseChannelReceived is emitted for every reverse channel command embedded
+// in voice bursts.
+type ReverseChannelReceived struct {
+	EventHeader
+	ReverseChannel *dmr.ReverseChannel
+}
+
+func (e *ReverseChannelReceived) String() string {
+	return fmt.Sprintf("%s %s", e.EventHeader.String(), e.ReverseChannel)
+}
+
+// MessageReceived is emitted for every text message.
+type MessageReceived struct {
+	EventHeader
+	Message *Message
+}
+
+func (e *MessageReceived) String() string {
+	return fmt.Sprintf("%s message %q", e.EventHeader.String(), e.Message.Text)
+}
+
+// ControlBlockReceived is emitted for every control signalling block.
+type ControlBlockReceived struct {
+	EventHeader
+	ControlBlock *dmr.ControlBlock
+}
+
+func (e *ControlBlockReceived) String() string {
+	return fmt.Sprintf("%s control block: %s", e.EventHeader.String(), e.ControlBlock)
+}
+
+// event passes an event to the event callback, the header is filled from the
+// packet.
+func (t *Terminal) event(p *dmr.Packet, e Event) {
+	if t.ef == nil {
+		return
+	}
+
+	h := e.Header()
+	h.Time = time.Now()
+	h.Timeslot = p.Timeslot
+	h.SrcID = p.SrcID
+	h.DstID = p.DstID
+	t.ef(e)
+}
@@ -0,0 +1,115 @@
+package terminal
+
+import (
+	"time"
+
+	"github.com/pd0mz/go-dmr"
+	"github.com/pd0mz/go-dmr/hdap"
+	"github.com/pd0mz/go-dmr/lrrp"
+)
+
+// Location is a received location report, either LRRP or Hytera.
+type Location struct {
+	Timeslot  uint8
+	SrcID     uint32
+	Time      time.Time // Zero if no timestamp is reported
+	Latitude  float64
+	Longitude float64
+	Report    *lrrp.Message  // LRRP reports only
+	Hytera    *hdap.Location // Hytera location protocol reports only
+}
+
+// LocationFunc is called for every location report received.
+type LocationFunc func(*Location)
+
+func (t *Terminal) SetLocationFunc(f LocationFunc) {
+	t.lf = f
+}
+
+// handleLocation handles location messages, reports with a position are
+// passed to the location callback.
+func (t *Terminal) handleLocation(p *dmr.Packet, d *dmr.UDPDatagram) error {
+	m, err := lrrp.Parse(d.Data)
+	if err != nil {
+		return err
+	}
+	t.debugf(p, m.String())
+
+	if m.IsRequest() || m.Position == nil {
+		return nil
+	}
+
+	t.infof(p, "location %s", m.Position)
+	t.location(p, &Location{
+		Time:      m.Time,
+		Latitude:  m.Position.Latitude,
+		Longitude: m.Position.Longitude,
+		Report:    m,
+	})
+	return nil
+}
+
+// handleHyteraLocation handles Hytera location protocol messages, reports
+// with a valid position are passed to the location callback.
+func (t *Terminal) handleHyteraLocation(p *dmr.Packet, d *dmr.UDPDatagram) error {
+	l, err := hdap.ParseLocation(d.Data)
+	if err != nil {
+		return err
+	}
+	t.debugf(p, l.String())
+
+	if l.GPS == nil || !l.GPS.Valid {
+		return nil
+	}
+
+	t.infof(p, "location %f,%f", l.GPS.Latitude, l.GPS.Longitude)
+	t.location(p, &Location{
+		Time:      l.GPS.Time,
+		Latitude:  l.GPS.Latitude,
+		Longitude: l.GPS.Longitude,
+		Hytera:    l,
+	})
+	return nil
+}
+
+// location passes a received location report to the location callback.
+func (t *Terminal) location(p *dmr.Packet, l *Location) {
+	l.Timeslot = p.Timeslot
+	l.SrcID = t.slot[p.Timeslot].data.header.SrcID
+	if t.lf != nil {
+		t.lf(l)
+	}
+	t.event(p, &GPSReceived{Latitude: l.Latitude, Longitude: l.Longitude, Location: l})
+}
+
+// handleRegistration handles Hytera radio registrations, registrations and
+// online checks addressed to us are answered.
+func (t *Terminal) handleRegistration(p *dmr.Packet, d *dmr.UDPDatagram) error {
+	r, err := hdap.ParseRegistration(d.Data)
+	if err != nil {
+		return err
+	}
+	t.debugf(p, r.String())
+
+	switch r.Opcode {
+	case hdap.RRSRegistration:
+		t.infof(p, "radio %d online", r.RadioID)
+	case hdap.RRSDeregistration:
+		t.infof(p, "radio %d offline", r.RadioID)
+		return nil
+	case hdap.RRSOnlineCheck:
+		break
+	default:
+		return nil
+	}
+
+	if h := t.slot[p.Timeslot].data.header; h.DstIsGroup || h.DstID != t.ID {
+		return nil
+	}
+	data, err := r.Answer().Bytes()
+	if err != nil {
+		return err
+	}
+	t.replyDatagram(p, d, data)
+	return nil
+}
@@ -0,0 +1,192 @@
+package terminal
+
+import (
+	"math"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pd0mz/go-dmr"
+	"github.com/pd0mz/go-dmr/hdap"
+	"github.com/pd0mz/go-dmr/lrrp"
+)
+
+// testSendDatagram sends the payload from and to the port as IP based packet
+// data, and returns the reply to the sender, if any.
+func testSendDatagram(t *testing.T, a *Terminal, port uint16, dst net.IP, data []byte) []byte {
+	c, err := a.ListenPacket(port, &PacketConnOptions{Timeslot: 1, DataType: dmr.Rate12Data})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, err = c.WriteTo(data, &net.UDPAddr{IP: dst, Port: int(port)}); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+
+	var buf = make([]byte, 512)
+	c.SetReadDeadline(time.Now().Add(time.Millisecond * 100))
+	n, addr, err := c.ReadFrom(buf)
+	if err != nil {
+		return nil
+	}
+	if ua := addr.(*net.UDPAddr); ua.Port != int(port) {
+		t.Fatalf("reply from unexpected port %d", ua.Port)
+	}
+	return buf[:n]
+}
+
+func TestLocation(t *testing.T) {
+	defer func(d time.Duration) { DataBurstInterval = d }(DataBurstInterval)
+	DataBurstInterval = 0
+
+	var (
+		a, _, b, _ = testTerminals()
+		locations  []*Location
+		events     []*GPSReceived
+		now        = time.Now().UTC().Truncate(time.Second)
+	)
+	b.SetLocationFunc(func(l *Location) { locations = append(locations, l) })
+	b.SetEventFunc(func(e Event) {
+		if g, ok := e.(*GPSReceived); ok {
+			events = append(events, g)
+		}
+	})
+
+	// Requests don't carry a position
+	data, err := (&lrrp.Message{Type: lrrp.ImmediateLocationRequest, RequestID: []byte{1}, RequestedInfo: lrrp.RequestPosition}).Bytes()
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	testSendDatagram(t, a, lrrp.Port, dmr.IPv4Address(dmr.RadioNetwork, 2), data)
+
+	report := &lrrp.Message{
+		Type:      lrrp.TriggeredLocationData,
+		RequestID: []byte{2},
+		Time:      now,
+		Position:  &lrrp.Position{Latitude: 52.3676, Longitude: 4.9041},
+	}
+	if data, err = report.Bytes(); err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	testSendDatagram(t, a, lrrp.Port, dmr.IPv4Address(dmr.RadioNetwork, 2), data)
+
+	if len(locations) != 1 || len(events) != 1 {
+		t.Fatalf("expected 1 location and GPS event, got %d and %d", len(locations), len(events))
+	}
+	l := locations[0]
+	if l.SrcID != 1 || l.Timeslot != 1 || !l.Time.Equal(now) || l.Report == nil || l.Hytera != nil {
+		t.Fatalf("unexpected location %+v", l)
+	}
+	if math.Abs(l.Latitude-52.3676) > 1e-5 || math.Abs(l.Longitude-4.9041) > 1e-5 {
+		t.Fatalf("expected position 52.3676,4.9041, got %f,%f", l.Latitude, l.Longitude)
+	}
+	if e := events[0]; e.Location != l || e.Latitude != l.Latitude || e.Longitude != l.Longitude || e.Timeslot != 1 {
+		t.Fatalf("unexpected GPS event %s", e)
+	}
+}
+
+func TestHyteraLocation(t *testing.T) {
+	defer func(d time.Duration) { DataBurstInterval = d }(DataBurstInterval)
+	DataBurstInterval = 0
+
+	var (
+		a, _, b, _ = testTerminals()
+		locations  []*Location
+		events     []*GPSReceived
+		now        = time.Now().UTC().Truncate(time.Second)
+		dst        = dmr.IPv4Address(dmr.RadioNetwork, 2)
+	)
+	b.SetLocationFunc(func(l *Location) { locations = append(locations, l) })
+	b.SetEventFunc(func(e Event) {
+		if g, ok := e.(*GPSReceived); ok {
+			events = append(events, g)
+		}
+	})
+
+	// Requests and reports without a valid fix are ignored
+	for _, l := range []*hdap.Location{
+		{Opcode: hdap.LPImmediateRequest, RequestID: 1, RadioID: 1},
+		{Opcode: hdap.LPTriggeredReport, RequestID: 1, RadioID: 1, GPS: &hdap.GPS{Time: now}},
+	} {
+		data, err := l.Bytes()
+		if err != nil {
+			t.Fatalf("encode failed: %v", err)
+		}
+		testSendDatagram(t, a, hdap.LPPort, dst, data)
+	}
+	if len(locations) != 0 || len(events) != 0 {
+		t.Fatalf("unexpected locations %+v", locations)
+	}
+
+	report := &hdap.Location{
+		Opcode:    hdap.LPTriggeredReport,
+		RequestID: 2,
+		RadioID:   1,
+		GPS:       &hdap.GPS{Time: now, Valid: true, Latitude: 52.3676, Longitude: 4.9041},
+	}
+	data, err := report.Bytes()
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	testSendDatagram(t, a, hdap.LPPort, dst, data)
+
+	if len(locations) != 1 || len(events) != 1 {
+		t.Fatalf("expected 1 location and GPS event, got %d and %d", len(locations), len(events))
+	}
+	l := locations[0]
+	if l.SrcID != 1 || l.Timeslot != 1 || !l.Time.Equal(now) || l.Hytera == nil || l.Report != nil {
+		t.Fatalf("unexpected location %+v", l)
+	}
+	if l.Hytera.Opcode != hdap.LPTriggeredReport || l.Hytera.RequestID != 2 {
+		t.Fatalf("unexpected Hytera location %s", l.Hytera)
+	}
+	if math.Abs(l.Latitude-52.3676) > 1e-4 || math.Abs(l.Longitude-4.9041) > 1e-4 {
+		t.Fatalf("expected position 52.3676,4.9041, got %f,%f", l.Latitude, l.Longitude)
+	}
+	if e := events[0]; e.Location != l || e.Timeslot != 1 {
+		t.Fatalf("unexpected GPS event %s", e)
+	}
+}
+
+func TestRegistration(t *testing.T) {
+	defer func(d time.Duration) { DataBurstInterval = d }(DataBurstInterval)
+	DataBurstInterval = 0
+
+	a, _, b, _ := testTerminals()
+	b.SetTalkGroups([]uint32{9})
+
+	var tests = []struct {
+		Opcode uint16
+		DstIP  net.IP
+		Answer uint16
+	}{
+		{hdap.RRSRegistration, dmr.IPv4Address(dmr.RadioNetwork, 2), hdap.RRSRegistrationAnswer},
+		{hdap.RRSOnlineCheck, dmr.IPv4Address(dmr.RadioNetwork, 2), hdap.RRSOnlineCheckAnswer},
+		{hdap.RRSDeregistration, dmr.IPv4Address(dmr.RadioNetwork, 2), 0},
+		{hdap.RRSRegistration, dmr.IPv4Address(dmr.GroupNetwork, 9), 0},
+		{hdap.RRSOnlineCheck, dmr.IPv4Address(dmr.GroupNetwork, 9), 0},
+	}
+	for _, test := range tests {
+		data, err := (&hdap.Registration{Opcode: test.Opcode, RadioID: 1}).Bytes()
+		if err != nil {
+			t.Fatalf("encode failed: %v", err)
+		}
+		reply := testSendDatagram(t, a, hdap.RRSPort, test.DstIP, data)
+		if test.Answer == 0 {
+			if reply != nil {
+				t.Fatalf("%s to %s: unexpected answer", hdap.RRSOpcodeName[test.Opcode], test.DstIP)
+			}
+			continue
+		}
+		if reply == nil {
+			t.Fatalf("%s to %s: expected answer", hdap.RRSOpcodeName[test.Opcode], test.DstIP)
+		}
+		r, err := hdap.ParseRegistration(reply)
+		if err != nil {
+			t.Fatalf("decode failed: %v", err)
+		}
+		if r.Opcode != test.Answer || r.RadioID != 1 || r.Result != hdap.RRSResultSuccess {
+			t.Fatalf("%s to %s: unexpected answer %s", hdap.RRSOpcodeName[test.Opcode], test.DstIP, r)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package terminal
+
+import (
+	"fmt"
+
+	"github.com/pd0mz/go-dmr"
+	"github.com/pd0mz/go-dmr/hdap"
+	"github.com/pd0mz/go-dmr/lrrp"
+	"github.com/pd0mz/go-dmr/sms"
+)
+
+// Message is a received text message.
+type Message struct {
+	Timeslot uint8
+	SrcID    uint32
+	DstID    uint32
+	Group    bool
+	Text     string
+}
+
+// MessageFunc is called for every text message received.
+type MessageFunc func(*Message)
+
+// MessageOptions control how a text message is sent.
+type MessageOptions struct {
+	Timeslot  uint8 // Timeslot to send on, 0 for TS1
+	DDFormat  uint8 // Text encoding
+	DataType  uint8 // One of dmr.Rate1Data, dmr.Rate12Data or dmr.Rate34Data
+	Confirmed bool  // Request a response and wait for the ACK
+	Hytera    bool  // Add the 2 byte pre-padding Hytera radios expect
+}
+
+// DefaultMessageOptions are used if no options are passed to SendMessage.
+var DefaultMessageOptions = MessageOptions{
+	Timeslot: 0,
+	DDFormat: dmr.DDFormatUTF16,
+	DataType: dmr.Rate12Data,
+}
+
+// SendMessage sends a text message as defined short data. If the options
+// request confirmed delivery, SendMessage blocks until the message is
+// acknowledged.
+func (t *Terminal) SendMessage(dst uint32, group bool, text string, opts *MessageOptions) error {
+	if opts == nil {
+		opts = &DefaultMessageOptions
+	}
+	switch opts.DataType {
+	case dmr.Rate1Data, dmr.Rate12Data, dmr.Rate34Data:
+		break
+	default:
+		return fmt.Errorf("terminal: can't send messages as %s", dmr.DataTypeName[opts.DataType])
+	}
+	if opts.Confirmed && group {
+		return fmt.Errorf("terminal: confirmed messages can't be sent to group %d", dst)
+	}
+
+	message, err := dmr.BuildMessageData(text, opts.DDFormat, true)
+	if err != nil {
+		return err
+	}
+
+	var data = message
+	if opts.Hytera {
+		// Hytera has a 2 byte pre-padding
+		data = append([]byte{0x00, 0x00}, message...)
+	}
+	if len(data) > dmr.MaxPacketFragmentSize {
+		return fmt.Errorf("terminal: message of %d bytes exceeds the maximum of %d", len(data), dmr.MaxPacketFragmentSize)
+	}
+
+	var f = &dmr.DataFragment{Data: data}
+	blocks, err := f.DataBlocks(opts.DataType, opts.Confirmed)
+	if err != nil {
+		return err
+	}
+	if len(blocks) > 0x3f {
+		return fmt.Errorf("terminal: message needs %d blocks, the maximum is %d", len(blocks), 0x3f)
+	}
+
+	// Number of padding bits in the last block, before the CRC
+	var padding = len(blocks)*int(blocks[0].Length) - 4 - f.Stored
+	sdd := &dmr.ShortDataDefinedData{
+		DDFormat:    opts.DDFormat,
+		FullMessage: true,
+		BitPadding:  uint8(padding * 8),
+	}
+
+	h := &dmr.DataHeader{
+		PacketFormat:       dmr.PacketFormatShortDataDefined,
+		DstIsGroup:         group,
+		ResponseRequested:  opts.Confirmed,
+		ServiceAccessPoint: dmr.ServiceAccessPointShortData,
+		DstID:              dst,
+		SrcID:              t.ID,
+		Data:               sdd,
+	}
+
+	log.Infof("[slot %d] sending message to %d: %q\n", opts.Timeslot+1, dst, text)
+	return t.SendData(opts.Timeslot, h, f, opts.DataType)
+}
+
+// handleIPData handles IP based packet data, text messages, location reports
+// and radio registrations are decoded.
+func (t *Terminal) handleIPData(p *dmr.Packet, data []byte) error {
+	d, err := dmr.ParseUDPDatagram(data)
+	if err != nil {
+		return err
+	}
+	return t.handleUDPDatagram(p, d)
+}
+
+// handleCompressedIPData handles UDP/IP header compressed data.
+func (t *Terminal) handleCompressedIPData(p *dmr.Packet, data []byte) error {
+	h := t.slot[p.Timeslot].data.header
+	d, err := dmr.DecompressUDPDatagram(data, h.SrcID, h.DstID)
+	if err != nil {
+		return err
+	}
+	return t.handleUDPDatagram(p, d)
+}
+
+func (t *Terminal) handleUDPDatagram(p *dmr.Packet, d *dmr.UDPDatagram) error {
+	t.debugf(p, d.String())
+
+	// Only accept datagrams sent to our address, or to a group we monitor
+	id, group, err := dmrID(d.DstIP)
+	if err != nil || (!group && id != t.ID) || (group && !t.accept[id]) {
+		t.debugf(p, "ignored datagram for %s, not sent to me", d.DstIP)
+		return nil
+	}
+
+	// Datagrams for ports we listen on are not decoded
+	if c := t.packetConn(d.DstPort); c != nil {
+		c.deliver(d)
+		return nil
+	}
+
+	switch d.DstPort {
+	case sms.MotorolaPort:
+		m, err := sms.ParseMotorola(d.Data)
+		if err != nil {
+			return err
+		}
+		t.debugf(p, m.String())
+		if m.PDUType == sms.MotorolaPDUText {
+			t.infof(p, "message %q", m.Text)
+			t.message(p, m.Text)
+			if h := t.slot[p.Timeslot].data.header; m.AckRequested && !h.DstIsGroup && h.DstID == t.ID {
+				ack, err := m.Ack().Bytes()
+				if err != nil {
+					return err
+				}
+				t.replyDatagram(p, d, ack)
+			}
+		}
+
+	case sms.HyteraPort:
+		m, err := sms.ParseHytera(d.Data)
+		if err != nil {
+			return err
+		}
+		t.debugf(p, m.String())
+		switch m.Opcode {
+		case sms.HyteraPrivateMessage, sms.HyteraGroupMessage:
+			t.infof(p, "message %q", m.Text)
+			t.message(p, m.Text)
+			if m.Reliable && !m.Group() && m.DstID == t.ID {
+				ack, err := m.Ack().Bytes()
+				if err != nil {
+					return err
+				}
+				t.replyDatagram(p, d, ack)
+			}
+		}
+
+	case hdap.RRSPort:
+		return t.handleRegistration(p, d)
+
+	case hdap.LPPort:
+		return t.handleHyteraLocation(p, d)
+
+	case lrrp.Port:
+		return t.handleLocation(p, d)
+
+	default:
+		t.warningf(p, "UDP port %d not implemented", d.DstPort)
+	}
+
+	return nil
+}
+
+// message passes a received text message to the message callback.
+func (t *Terminal) message(p *dmr.Packet, text string) {
+	h := t.slot[p.Timeslot].data.header
+	m := &Message{
+		Timeslot: p.Timeslot,
+		SrcID:    h.SrcID,
+		DstID:    h.DstID,
+		Group:    h.DstIsGroup,
+		Text:     text,
+	}
+	if t.mf != nil {
+		t.mf(m)
+	}
+	t.event(p, &MessageReceived{Message: m})
+}
@@ -0,0 +1,215 @@
+package terminal
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pd0mz/go-dmr"
+	"github.com/pd0mz/go-dmr/bptc"
+	"github.com/pd0mz/go-dmr/sms"
+)
+
+// testHeaders returns the number of data headers in the packets.
+func testHeaders(packets []*dmr.Packet) int {
+	var n int
+	for _, p := range packets {
+		if p.DataType == dmr.Data {
+			n++
+		}
+	}
+	return n
+}
+
+func TestSendMessageConfirmed(t *testing.T) {
+	defer func(d time.Duration) { DataBurstInterval = d }(DataBurstInterval)
+	defer func(d time.Duration) { DataResponseTimeout = d }(DataResponseTimeout)
+	defer func(n int) { DataRetries = n }(DataRetries)
+	DataBurstInterval = 0
+	DataResponseTimeout = time.Millisecond * 50
+	DataRetries = 2
+
+	var opts = DefaultMessageOptions
+	opts.Confirmed = true
+
+	// Acknowledged by the remote
+	a, ra, _, rb := testTerminals()
+	if err := a.SendMessage(2, false, "CQCQCQ PD0MZ", &opts); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+	if sent, responses := testHeaders(ra.packets()), testHeaders(rb.packets()); sent != 1 || responses != 1 {
+		t.Fatalf("expected 1 message and 1 response, got %d and %d", sent, responses)
+	}
+	if err := a.SendMessage(9, true, "CQCQCQ PD0MZ", &opts); err == nil {
+		t.Fatal("expected confirmed group message to fail")
+	}
+
+	// No response, the message is sent again until we give up
+	a, ra, _, rb = testTerminals()
+	rb.filter = func(p *dmr.Packet) bool { return false }
+	if err := a.SendMessage(2, false, "CQCQCQ PD0MZ", &opts); err == nil || !strings.Contains(err.Error(), "timeout") {
+		t.Fatalf("expected timeout, got %v", err)
+	}
+	if sent := testHeaders(ra.packets()); sent != DataRetries+1 {
+		t.Fatalf("expected %d transmissions, got %d", DataRetries+1, sent)
+	}
+
+	// Refused by the remote
+	a, _, c, rc := testTerminals()
+	rc.pf = func(_ dmr.Repeater, p *dmr.Packet) error {
+		if p.DataType != dmr.Data {
+			return nil
+		}
+		h := &dmr.DataHeader{
+			PacketFormat:       dmr.PacketFormatResponse,
+			ServiceAccessPoint: dmr.ServiceAccessPointShortData,
+			DstID:              1,
+			SrcID:              2,
+			Data:               &dmr.ResponseData{ClassType: dmr.ResponseTypeUndeliverable},
+		}
+		go c.sendDataBlocks(p.Timeslot, h, nil, dmr.Rate12Data)
+		return nil
+	}
+	if err := a.SendMessage(2, false, "CQCQCQ PD0MZ", &opts); err == nil || !strings.Contains(err.Error(), "undeliverable") {
+		t.Fatalf("expected undeliverable response, got %v", err)
+	}
+}
+
+func TestSendMessage(t *testing.T) {
+	defer func(d time.Duration) { DataBurstInterval = d }(DataBurstInterval)
+	DataBurstInterval = 0
+
+	a, ra, _, rb := testTerminals()
+	for _, dataType := range []uint8{dmr.Rate1Data, dmr.Rate12Data, dmr.Rate34Data} {
+		ra.sent, rb.sent = nil, nil
+		opts := DefaultMessageOptions
+		opts.DataType = dataType
+		if err := a.SendMessage(9, true, "CQCQCQ PD0MZ", &opts); err != nil {
+			t.Fatalf("%s: send failed: %v", dmr.DataTypeName[dataType], err)
+		}
+		sent := ra.packets()
+		if testHeaders(sent) != 1 || len(sent) < 2 || testHeaders(rb.packets()) != 0 {
+			t.Fatalf("%s: expected 1 header and no response, got %d packets", dmr.DataTypeName[dataType], len(sent))
+		}
+		for _, p := range sent[1:] {
+			if p.DataType != dataType {
+				t.Fatalf("expected %s blocks, got %s", dmr.DataTypeName[dataType], dmr.DataTypeName[p.DataType])
+			}
+		}
+	}
+
+	opts := DefaultMessageOptions
+	opts.DataType = dmr.VoiceLC
+	if err := a.SendMessage(2, false, "CQCQCQ PD0MZ", &opts); err == nil {
+		t.Fatal("expected voice LC data type to fail")
+	}
+}
+
+func TestSendMessageHytera(t *testing.T) {
+	defer func(d time.Duration) { DataBurstInterval = d }(DataBurstInterval)
+	DataBurstInterval = 0
+
+	var (
+		a, ra, b, _ = testTerminals()
+		messages    []*Message
+	)
+	b.SetMessageFunc(func(m *Message) { messages = append(messages, m) })
+
+	for _, hytera := range []bool{false, true} {
+		ra.sent, messages = nil, nil
+		opts := DefaultMessageOptions
+		opts.Hytera = hytera
+		if err := a.SendMessage(2, false, "CQCQCQ PD0MZ", &opts); err != nil {
+			t.Fatalf("send failed: %v", err)
+		}
+		if len(messages) != 1 || messages[0].Text != "CQCQCQ PD0MZ" {
+			t.Fatalf("hytera %t: expected message, got %+v", hytera, messages)
+		}
+
+		// Only the Hytera format starts with the pre-padding
+		var (
+			sent = ra.packets()
+			data = make([]byte, 12)
+		)
+		if err := bptc.Decode(sent[1].InfoBits(), data); err != nil {
+			t.Fatalf("decode failed: %v", err)
+		}
+		if padded := data[0] == 0x00 && data[1] == 0x00; padded != hytera {
+			t.Fatalf("hytera %t: unexpected first block % x", hytera, data)
+		}
+	}
+}
+
+func TestIPMessages(t *testing.T) {
+	defer func(d time.Duration) { DataBurstInterval = d }(DataBurstInterval)
+	DataBurstInterval = 0
+
+	var (
+		a, _, b, _ = testTerminals()
+		events     []Event
+	)
+	b.SetTalkGroups([]uint32{9})
+	b.SetEventFunc(func(e Event) {
+		if _, ok := e.(*MessageReceived); ok {
+			events = append(events, e)
+		}
+	})
+
+	var (
+		dst   = dmr.IPv4Address(dmr.RadioNetwork, 2)
+		group = dmr.IPv4Address(dmr.GroupNetwork, 9)
+	)
+
+	// Motorola TMS, acknowledged if requested
+	data, err := (&sms.Motorola{AckRequested: true, SequenceNumber: 3, Text: "Motorola"}).Bytes()
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	reply := testSendDatagram(t, a, sms.MotorolaPort, dst, data)
+	if reply == nil {
+		t.Fatal("expected Motorola ACK")
+	}
+	ack, err := sms.ParseMotorola(reply)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if ack.PDUType != sms.MotorolaPDUAck || ack.SequenceNumber != 3 {
+		t.Fatalf("expected Motorola ACK for sequence 3, got %s", ack)
+	}
+	if data, err = (&sms.Motorola{Text: "Motorola"}).Bytes(); err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	if reply = testSendDatagram(t, a, sms.MotorolaPort, dst, data); reply != nil {
+		t.Fatal("unexpected Motorola ACK")
+	}
+
+	// Hytera, reliable private messages are acknowledged
+	if data, err = (&sms.Hytera{Reliable: true, Opcode: sms.HyteraPrivateMessage, RequestID: 7, DstID: 2, SrcID: 1, Text: "Hytera"}).Bytes(); err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	if reply = testSendDatagram(t, a, sms.HyteraPort, dst, data); reply == nil {
+		t.Fatal("expected Hytera ACK")
+	}
+	hack, err := sms.ParseHytera(reply)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if hack.Opcode != sms.HyteraPrivateMessageAck || hack.RequestID != 7 || hack.DstID != 1 || hack.SrcID != 2 {
+		t.Fatalf("expected Hytera ACK for request 7, got %s", hack)
+	}
+	if data, err = (&sms.Hytera{Reliable: true, Opcode: sms.HyteraGroupMessage, RequestID: 8, DstID: 9, SrcID: 1, Text: "Hytera"}).Bytes(); err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	if reply = testSendDatagram(t, a, sms.HyteraPort, group, data); reply != nil {
+		t.Fatal("unexpected Hytera ACK for group message")
+	}
+
+	if len(events) != 4 {
+		t.Fatalf("expected 4 messages, got %d: %v", len(events), events)
+	}
+	for i, text := range []string{"Motorola", "Motorola", "Hytera", "Hytera"} {
+		if m := events[i].(*MessageReceived).Message; m.Text != text || m.SrcID != 1 || m.Group != (i == 3) {
+			t.Fatalf("message %d: unexpected %+v", i, m)
+		}
+	}
+}
@@ -0,0 +1,322 @@
+package terminal
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pd0mz/go-dmr"
+)
+
+// PacketConnQueueSize is the number of received datagrams queued per PacketConn.
+var PacketConnQueueSize = 64
+
+// PacketConnOptions control how datagrams are sent.
+type PacketConnOptions struct {
+	Timeslot  uint8 // Timeslot to send on, 0 for TS1
+	DataType  uint8 // One of dmr.Rate1Data, dmr.Rate12Data or dmr.Rate34Data
+	Confirmed bool  // Use confirmed data for datagrams to radios
+	Compress  bool  // Use UDP/IP header compression
+}
+
+// DefaultPacketConnOptions are used if no options are passed to ListenPacket.
+var DefaultPacketConnOptions = PacketConnOptions{
+	Timeslot: 0,
+	DataType: dmr.Rate12Data,
+}
+
+// PacketConn sends and receives UDP datagrams as DMR IP based packet data.
+// Radios are addressed by their DMR ID in the radio network (12.x.x.x) or the
+// interface network (13.x.x.x), groups by their ID in the group network
+// (225.x.x.x).
+type PacketConn struct {
+	t       *Terminal
+	opts    PacketConnOptions
+	port    uint16
+	packets chan *dmr.UDPDatagram
+	done    chan struct{}
+	wake    chan struct{}
+
+	mutex         sync.Mutex
+	id            uint16
+	readDeadline  time.Time
+	writeDeadline time.Time
+}
+
+var _ net.PacketConn = (*PacketConn)(nil)
+
+// ListenPacket returns a PacketConn that sends and receives UDP datagrams on
+// the port.
+func (t *Terminal) ListenPacket(port uint16, opts *PacketConnOptions) (*PacketConn, error) {
+	if opts == nil {
+		opts = &DefaultPacketConnOptions
+	}
+	if opts.Timeslot > 1 {
+		return nil, fmt.Errorf("terminal: invalid timeslot %d", opts.Timeslot)
+	}
+	switch opts.DataType {
+	case dmr.Rate1Data, dmr.Rate12Data, dmr.Rate34Data:
+		break
+	default:
+		return nil, fmt.Errorf("terminal: can't send datagrams as %s", dmr.DataTypeName[opts.DataType])
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.conns == nil {
+		t.conns = make(map[uint16]*PacketConn)
+	}
+	if _, ok := t.conns[port]; ok {
+		return nil, fmt.Errorf("terminal: port %d already in use", port)
+	}
+
+	c := &PacketConn{
+		t:       t,
+		opts:    *opts,
+		port:    port,
+		packets: make(chan *dmr.UDPDatagram, PacketConnQueueSize),
+		done:    make(chan struct{}),
+		wake:    make(chan struct{}, 1),
+	}
+	t.conns[port] = c
+	return c, nil
+}
+
+// packetConn returns the PacketConn listening on the port, if any.
+func (t *Terminal) packetConn(port uint16) *PacketConn {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.conns[port]
+}
+
+// LocalAddr returns the address of the terminal in the radio network.
+func (c *PacketConn) LocalAddr() net.Addr {
+	return &net.UDPAddr{
+		IP:   dmr.IPv4Address(dmr.RadioNetwork, c.t.ID),
+		Port: int(c.port),
+	}
+}
+
+// ReadFrom reads a datagram, it returns the payload size and source address.
+func (c *PacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	for {
+		c.mutex.Lock()
+		deadline := c.readDeadline
+		c.mutex.Unlock()
+
+		var (
+			timer   *time.Timer
+			timeout <-chan time.Time
+		)
+		if !deadline.IsZero() {
+			d := time.Until(deadline)
+			if d <= 0 {
+				return 0, nil, c.opError("read", nil, os.ErrDeadlineExceeded)
+			}
+			timer = time.NewTimer(d)
+			timeout = timer.C
+		}
+
+		var (
+			d   *dmr.UDPDatagram
+			err error
+		)
+		select {
+		case d = <-c.packets:
+		case <-c.done:
+			err = net.ErrClosed
+		case <-timeout:
+			err = os.ErrDeadlineExceeded
+		case <-c.wake:
+			// Deadline changed, start over
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+
+		switch {
+		case err != nil:
+			return 0, nil, c.opError("read", nil, err)
+		case d != nil:
+			return copy(b, d.Data), &net.UDPAddr{IP: d.SrcIP, Port: int(d.SrcPort)}, nil
+		}
+	}
+}
+
+// WriteTo sends the payload to the address as a single datagram, it blocks
+// until the datagram has been sent, or acknowledged for confirmed data.
+func (c *PacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	select {
+	case <-c.done:
+		return 0, c.opError("write", addr, net.ErrClosed)
+	default:
+	}
+
+	c.mutex.Lock()
+	deadline := c.writeDeadline
+	c.id++
+	id := c.id
+	c.mutex.Unlock()
+	if !deadline.IsZero() && !time.Now().Before(deadline) {
+		return 0, c.opError("write", addr, os.ErrDeadlineExceeded)
+	}
+
+	ua, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return 0, c.opError("write", addr, fmt.Errorf("terminal: unsupported address type %T", addr))
+	}
+	dstID, group, err := dmrID(ua.IP)
+	if err != nil {
+		return 0, c.opError("write", addr, err)
+	}
+
+	d := &dmr.UDPDatagram{
+		ID:      id,
+		SrcIP:   dmr.IPv4Address(dmr.RadioNetwork, c.t.ID),
+		DstIP:   ua.IP.To4(),
+		SrcPort: c.port,
+		DstPort: uint16(ua.Port),
+		Data:    b,
+	}
+
+	if err = c.t.sendDatagram(d, dstID, group, &c.opts, deadline); err != nil {
+		return 0, c.opError("write", addr, err)
+	}
+	return len(b), nil
+}
+
+// Close stops listening on the port, blocked reads and writes return errors.
+func (c *PacketConn) Close() error {
+	c.t.mutex.Lock()
+	defer c.t.mutex.Unlock()
+
+	select {
+	case <-c.done:
+		return c.opError("close", nil, net.ErrClosed)
+	default:
+	}
+	close(c.done)
+	delete(c.t.conns, c.port)
+	return nil
+}
+
+func (c *PacketConn) SetDeadline(t time.Time) error {
+	c.SetReadDeadline(t)
+	return c.SetWriteDeadline(t)
+}
+
+func (c *PacketConn) SetReadDeadline(t time.Time) error {
+	c.mutex.Lock()
+	c.readDeadline = t
+	c.mutex.Unlock()
+
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (c *PacketConn) SetWriteDeadline(t time.Time) error {
+	c.mutex.Lock()
+	c.writeDeadline = t
+	c.mutex.Unlock()
+	return nil
+}
+
+// sendDatagram sends a datagram as IP based packet data, if the deadline is
+// not zero the transfer is aborted when it expires.
+func (t *Terminal) sendDatagram(d *dmr.UDPDatagram, dstID uint32, group bool, opts *PacketConnOptions, deadline time.Time) error {
+	h := &dmr.DataHeader{
+		PacketFormat:       dmr.PacketFormatUnconfirmedData,
+		DstIsGroup:         group,
+		ServiceAccessPoint: dmr.ServiceAccessPointIPBasedPacketData,
+		DstID:              dstID,
+		SrcID:              t.ID,
+		Data:               &dmr.UnconfirmedData{},
+	}
+	if opts.Confirmed && !group {
+		h.PacketFormat = dmr.PacketFormatConfirmedData
+		h.ResponseRequested = true
+		h.Data = &dmr.ConfirmedData{}
+	}
+
+	var (
+		data []byte
+		err  error
+	)
+	if opts.Compress {
+		h.ServiceAccessPoint = dmr.ServiceAccessPointUDPIPHeaderCompression
+		data, err = d.CompressedBytes(h.SrcID, h.DstID)
+	} else {
+		data, err = d.Bytes()
+	}
+	if err != nil {
+		return err
+	}
+	if len(data) > dmr.MaxPacketFragmentSize {
+		return fmt.Errorf("terminal: datagram of %d bytes exceeds the maximum of %d", len(data), dmr.MaxPacketFragmentSize)
+	}
+
+	return t.sendData(opts.Timeslot, h, &dmr.DataFragment{Data: data}, opts.DataType, deadline)
+}
+
+// replyDatagram answers a received datagram on the same timeslot, with the
+// same header compression. The reply is sent in the background, as it can't
+// be sent from the packet handler.
+func (t *Terminal) replyDatagram(p *dmr.Packet, d *dmr.UDPDatagram, data []byte) {
+	var (
+		h = t.slot[p.Timeslot].data.header
+		r = &dmr.UDPDatagram{
+			SrcIP:   dmr.IPv4Address(dmr.RadioNetwork, t.ID),
+			DstIP:   d.SrcIP,
+			SrcPort: d.DstPort,
+			DstPort: d.SrcPort,
+			Data:    data,
+		}
+		opts = PacketConnOptions{
+			Timeslot: p.Timeslot,
+			DataType: dmr.Rate12Data,
+			Compress: h.ServiceAccessPoint == dmr.ServiceAccessPointUDPIPHeaderCompression,
+		}
+		dstID = h.SrcID
+	)
+	go func() {
+		if err := t.sendDatagram(r, dstID, false, &opts, time.Time{}); err != nil {
+			t.errorf(p, "reply to %s failed: %v", d.SrcIP, err)
+		}
+	}()
+}
+
+// deliver queues a received datagram.
+func (c *PacketConn) deliver(d *dmr.UDPDatagram) {
+	select {
+	case c.packets <- d:
+	default:
+		log.Warningf("dropped datagram for port %d, queue full\n", c.port)
+	}
+}
+
+func (c *PacketConn) opError(op string, addr net.Addr, err error) error {
+	return &net.OpError{Op: op, Net: "dmr", Source: c.LocalAddr(), Addr: addr, Err: err}
+}
+
+// dmrID returns the DMR ID of an IPv4 address, and if it's a group.
+func dmrID(ip net.IP) (uint32, bool, error) {
+	network, id, err := dmr.IPv4ID(ip)
+	if err != nil {
+		return 0, false, err
+	}
+	switch network {
+	case dmr.RadioNetwork, dmr.InterfaceNetwork:
+		return id, false, nil
+	case dmr.GroupNetwork:
+		return id, true, nil
+	default:
+		return 0, false, errors.New("terminal: no route to " + ip.String())
+	}
+}
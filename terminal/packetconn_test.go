@@ -0,0 +1,126 @@
+package terminal
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pd0mz/go-dmr"
+)
+
+func testTimeout(err error) bool {
+	ne, ok := err.(net.Error)
+	return ok && ne.Timeout()
+}
+
+func TestPacketConn(t *testing.T) {
+	defer func(d time.Duration) { DataBurstInterval = d }(DataBurstInterval)
+	DataBurstInterval = 0
+
+	a, _, b, _ := testTerminals()
+	b.SetTalkGroups([]uint32{9})
+
+	var (
+		payload = []byte("location report that is long enough for a couple of blocks")
+		buf     = make([]byte, 512)
+	)
+	for _, opts := range []PacketConnOptions{
+		{DataType: dmr.Rate12Data},
+		{DataType: dmr.Rate34Data, Confirmed: true},
+		{DataType: dmr.Rate1Data, Compress: true},
+		{DataType: dmr.Rate12Data, Compress: true, Confirmed: true},
+	} {
+		ca, err := a.ListenPacket(4001, &opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cb, err := b.ListenPacket(4001, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Datagrams for us and for a monitored group are received, others
+		// aren't. Confirmed data for another radio is never acknowledged.
+		var dsts = []net.IP{
+			dmr.IPv4Address(dmr.RadioNetwork, 2),
+			dmr.IPv4Address(dmr.InterfaceNetwork, 2),
+			dmr.IPv4Address(dmr.GroupNetwork, 9),
+			dmr.IPv4Address(dmr.GroupNetwork, 10),
+		}
+		if !opts.Confirmed {
+			dsts = append(dsts, dmr.IPv4Address(dmr.RadioNetwork, 3))
+		}
+		for _, dst := range dsts {
+			if _, err = ca.WriteTo(payload, &net.UDPAddr{IP: dst, Port: 4001}); err != nil {
+				t.Fatalf("%+v: write to %s failed: %v", opts, dst, err)
+			}
+		}
+		for i := 0; i < 3; i++ {
+			cb.SetReadDeadline(time.Now().Add(time.Second))
+			n, addr, err := cb.ReadFrom(buf)
+			if err != nil {
+				t.Fatalf("%+v: read failed: %v", opts, err)
+			}
+			if string(buf[:n]) != string(payload) {
+				t.Fatalf("%+v: expected %q, got %q", opts, payload, buf[:n])
+			}
+			if ua := addr.(*net.UDPAddr); !ua.IP.Equal(ca.LocalAddr().(*net.UDPAddr).IP) || ua.Port != 4001 {
+				t.Fatalf("%+v: unexpected source %s", opts, addr)
+			}
+		}
+
+		// Read deadline
+		cb.SetReadDeadline(time.Now().Add(time.Millisecond * 10))
+		if _, _, err = cb.ReadFrom(buf); !testTimeout(err) {
+			t.Fatalf("%+v: expected read timeout, got %v", opts, err)
+		}
+
+		// Close unblocks a pending read
+		cb.SetReadDeadline(time.Time{})
+		go func() {
+			time.Sleep(time.Millisecond * 10)
+			cb.Close()
+		}()
+		if _, _, err = cb.ReadFrom(buf); err == nil || testTimeout(err) {
+			t.Fatalf("%+v: expected read on closed connection to fail, got %v", opts, err)
+		}
+		if _, err = cb.WriteTo(payload, ca.LocalAddr()); err == nil {
+			t.Fatalf("%+v: expected write on closed connection to fail", opts)
+		}
+		ca.Close()
+	}
+}
+
+func TestPacketConnWriteDeadline(t *testing.T) {
+	defer func(d time.Duration) { DataBurstInterval = d }(DataBurstInterval)
+	DataBurstInterval = 0
+
+	a, ra, _, _ := testTerminals()
+	ra.filter = func(*dmr.Packet) bool { return false }
+
+	c, err := a.ListenPacket(4001, &PacketConnOptions{DataType: dmr.Rate12Data, Confirmed: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	var dst = &net.UDPAddr{IP: dmr.IPv4Address(dmr.RadioNetwork, 2), Port: 4001}
+
+	// The deadline expires while waiting for the response
+	c.SetWriteDeadline(time.Now().Add(time.Millisecond * 100))
+	start := time.Now()
+	if _, err = c.WriteTo([]byte("hello"), dst); !testTimeout(err) {
+		t.Fatalf("expected write timeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > DataResponseTimeout/2 {
+		t.Fatalf("write deadline ignored, write took %s", elapsed)
+	}
+
+	// The deadline has expired before sending
+	sent := len(ra.packets())
+	if _, err = c.WriteTo([]byte("hello"), dst); !testTimeout(err) {
+		t.Fatalf("expected write timeout, got %v", err)
+	}
+	if len(ra.packets()) != sent {
+		t.Fatal("data sent after the write deadline expired")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/op/go-logging"
@@ -25,10 +26,20 @@ const (
 
 const VoiceFrameDuration = time.Millisecond * 60
 
+// CallHangTime is the time without packets after which the call on a slot is
+// ended, if it wasn't ended by a terminator.
+var CallHangTime = time.Second * 3
+
 type Slot struct {
-	call struct {
-		start time.Time
-		end   time.Time
+	state    uint8
+	hang     *time.Timer
+	hangTime time.Duration // Hang time the timer was started with
+	call     struct {
+		start  time.Time
+		end    time.Time
+		group  bool
+		frames int // Voice frames or data blocks received
+		lost   int // Voice frames or data blocks missed
 	}
 	dstID, srcID uint32
 	dataType     uint8
@@ -38,10 +49,21 @@ type Slot struct {
 		blocksExpected    int
 		blocksReceived    int
 		header            *dmr.DataHeader
+		retransmit        bool   // Expecting retransmitted blocks
+		duplicate         bool   // Data was delivered before, only acknowledge
+		delivered         bool   // Confirmed data was delivered
+		srcID             uint32 // Source of the last delivered confirmed data
+		sendSequence      uint8  // N(S) of the last delivered confirmed data
+		resync            bool   // Last delivered confirmed data resynchronised the N(S)
 	}
 	voice struct {
 		lastFrame uint8
 		streamID  uint32
+		alias     struct {
+			header *lc.TalkerAliasHeaderPDU
+			blocks [3]*lc.TalkerAliasBlockPDU
+			alias  string // Last talker alias reported
+		}
 	}
 	selectiveAckRequestsSent int
 	rxSequence               int
@@ -50,6 +72,12 @@ type Slot struct {
 	last                     struct {
 		packetReceived time.Time
 	}
+
+	// Confirmed data we are sending
+	mutex          sync.Mutex // Guards the fields below
+	tx             *dataTransfer
+	txSendSequence uint8
+	txSynced       bool
 }
 
 func NewSlot() *Slot {
@@ -72,11 +100,17 @@ type Terminal struct {
 	Repeater      dmr.Repeater
 	TalkGroup     []uint32
 	SoftwareDelay bool
+	ColorCode     uint8
 
 	accept map[uint32]bool
 	slot   []*Slot
-	state  uint8
 	vff    VoiceFrameFunc
+	mf     MessageFunc
+	lf     LocationFunc
+	ef     EventFunc
+	rx     sync.Mutex // Serializes packet handling and hang timers
+	mutex  sync.Mutex
+	conns  map[uint16]*PacketConn
 }
 
 func New(id uint32, call string, r dmr.Repeater) *Terminal {
@@ -105,6 +139,10 @@ func (t *Terminal) SetVoiceFrameFunc(f VoiceFrameFunc) {
 	t.vff = f
 }
 
+func (t *Terminal) SetMessageFunc(f MessageFunc) {
+	t.mf = f
+}
+
 func (t *Terminal) Send(p *dmr.Packet) error {
 	return t.Repeater.Send(p)
 }
@@ -178,13 +216,27 @@ func (t *Terminal) dataBlock(p *dmr.Packet, db *dmr.DataBlock) error {
 	if slot.data.header.ResponseRequested {
 		// Only confirmed data blocks have serial numbers stored in them.
 		if int(db.Serial) < len(slot.data.blocks) {
-			slot.data.blocks[db.Serial] = db
+			if !db.OK && slot.data.blocks[db.Serial] != nil && slot.data.blocks[db.Serial].OK {
+				// Damaged retransmission, don't replace a good block
+				t.debugf(p, "data block %d already received", db.Serial)
+			} else {
+				slot.data.blocks[db.Serial] = db
+			}
+		} else if !db.OK {
+			// The serial of a damaged block can't be trusted, the block is
+			// missing and will be retransmitted
+			t.debugf(p, "damaged data block with serial %d", db.Serial)
 		} else {
 			t.warningf(p, "data block %d out of bounds (%d >= %d)", db.Serial, db.Serial, len(slot.data.blocks))
 			return nil
 		}
 	} else {
-		slot.data.blocks[slot.data.blocksReceived] = db
+		if slot.data.blocksReceived < len(slot.data.blocks) {
+			slot.data.blocks[slot.data.blocksReceived] = db
+		} else {
+			t.warningf(p, "data block %d out of bounds (%d >= %d)", slot.data.blocksReceived, slot.data.blocksReceived, len(slot.data.blocks))
+			return nil
+		}
 	}
 
 	slot.data.blocksReceived++
@@ -216,35 +268,59 @@ func (t *Terminal) dataBlockAssemble(p *dmr.Packet) error {
 		case responseOk:
 			t.debugf(p, "found erroneous blocks, not sending out ACK for response")
 			return nil
-		case slot.selectiveAckRequestsSent > 25:
+		case !slot.data.header.ResponseRequested:
+			t.warningf(p, "found erroneous blocks in unconfirmed data, dropping")
+			return t.dataCallEnd(p)
+		case slot.selectiveAckRequestsSent >= maxSelectiveAckRequests:
 			t.warningf(p, "found erroneous blocks, max selective ACK reached")
-			return nil
+			t.sendResponse(p, dmr.ResponseTypePacketCRCFailed, nil)
+			return t.dataCallEnd(p)
 		default:
-			//t.sendSelectiveAck()
-			return nil
+			t.debugf(p, "found erroneous blocks, sending selective ACK")
+			return t.sendSelectiveAck(p, selective[:slot.fullMessageBlocks])
 		}
 	}
 
 	fragment, err := dmr.CombineDataBlocks(slot.data.blocks)
 	if err != nil {
+		if slot.data.header.ResponseRequested {
+			t.sendResponse(p, dmr.ResponseTypePacketCRCFailed, nil)
+		}
+		t.dataCallEnd(p)
 		return err
 	}
 
 	if fragment.Stored > 0 {
 		// Response with data blocks? That must be a selective ACK
 		if _, ok := slot.data.header.Data.(*dmr.ResponseData); ok {
-			// FIXME(pd0mz): deal with this shit
-			return nil
+			return t.handleSelectiveAck(p, fragment)
 		}
 
-		if err := t.dataBlockComplete(p, fragment); err != nil {
-			return err
-		}
-
-		// If we are not waiting for an ack, then the data session ended
 		if !slot.data.header.ResponseRequested {
+			if err := t.dataBlockComplete(p, fragment); err != nil {
+				return err
+			}
 			return t.dataCallEnd(p)
 		}
+
+		// Confirmed data, our previous ACK may have been lost, so duplicates
+		// are acknowledged again but not delivered
+		if slot.data.duplicate {
+			t.debugf(p, "duplicate data with N(S) %d, not delivered", slot.data.sendSequence)
+		} else if err := t.dataBlockComplete(p, fragment); err != nil {
+			t.sendResponse(p, dmr.ResponseTypeUndeliverable, nil)
+			t.dataCallEnd(p)
+			return err
+		}
+		if d, ok := slot.data.header.Data.(*dmr.ConfirmedData); ok {
+			slot.data.delivered = true
+			slot.data.srcID = slot.data.header.SrcID
+			slot.data.sendSequence = d.SendSequenceNumber
+			slot.data.resync = d.Resync
+		}
+		slot.data.retransmit = false
+		t.sendResponse(p, dmr.ResponseTypeACK, nil)
+		return t.dataCallEnd(p)
 	}
 	return nil
 }
@@ -260,8 +336,13 @@ func (t *Terminal) dataBlockComplete(p *dmr.Packet, f *dmr.DataFragment) error {
 
 	switch slot.data.header.ServiceAccessPoint {
 	case dmr.ServiceAccessPointShortData:
-		data = f.Data[2:]       // Hytera has a 2 byte pre-padding
-		size = f.Stored - 2 - 4 // Leave out the CRC
+		if f.Stored > 4 {
+			data = f.Data[:f.Stored-4] // Leave out the CRC
+		}
+		if len(data) >= 2 && data[0] == 0x00 && data[1] == 0x00 {
+			data = data[2:] // Hytera has a 2 byte pre-padding
+		}
+		size = len(data)
 
 		if sdd, ok := slot.data.header.Data.(*dmr.ShortDataDefinedData); ok {
 			ddformat = sdd.DDFormat
@@ -269,6 +350,12 @@ func (t *Terminal) dataBlockComplete(p *dmr.Packet, f *dmr.DataFragment) error {
 		t.debugf(p, "bytes %d, format %s (%d)", size, dmr.DDFormatName[ddformat], ddformat)
 		break
 
+	case dmr.ServiceAccessPointIPBasedPacketData:
+		return t.handleIPData(p, f.Data[:f.Stored])
+
+	case dmr.ServiceAccessPointUDPIPHeaderCompression:
+		return t.handleCompressedIPData(p, userData(slot.data.header, f))
+
 	default:
 		t.warningf(p, "service accesspoint not implemented")
 	}
@@ -285,11 +372,12 @@ func (t *Terminal) dataBlockComplete(p *dmr.Packet, f *dmr.DataFragment) error {
 	}
 
 	t.infof(p, "message %q", message)
+	t.message(p, message)
 	return nil
 }
 
 func (t *Terminal) callEnd(p *dmr.Packet) error {
-	switch t.state {
+	switch t.slot[p.Timeslot].state {
 	case dataCallActive:
 		return t.dataCallEnd(p)
 	case voiceCallActive:
@@ -301,13 +389,22 @@ func (t *Terminal) callEnd(p *dmr.Packet) error {
 func (t *Terminal) dataCallEnd(p *dmr.Packet) error {
 	slot := t.slot[p.Timeslot]
 
-	if t.state != dataCallActive {
+	if slot.state != dataCallActive {
 		return nil
 	}
 
+	if slot.data.blocksReceived < slot.data.blocksExpected {
+		slot.call.lost += slot.data.blocksExpected - slot.data.blocksReceived
+	}
+
 	slot.data.packetHeaderValid = false
-	t.state = idle
+	slot.state = idle
+	slot.call.end = time.Now()
+	if slot.hang != nil {
+		slot.hang.Stop()
+	}
 	t.debugf(p, "data call ended")
+	t.callEnded(p, DataCall)
 	return nil
 }
 
@@ -315,7 +412,7 @@ func (t *Terminal) dataCallStart(p *dmr.Packet) error {
 	slot := t.slot[p.Timeslot]
 
 	if slot.dstID != p.DstID || slot.srcID != p.SrcID || slot.dataType != p.DataType {
-		if t.state == dataCallActive {
+		if slot.state == dataCallActive {
 			if err := t.dataCallEnd(p); err != nil {
 				return err
 			}
@@ -325,27 +422,51 @@ func (t *Terminal) dataCallStart(p *dmr.Packet) error {
 	slot.data.packetHeaderValid = false
 	slot.call.start = time.Now()
 	slot.call.end = time.Time{}
+	slot.call.group = p.CallType == dmr.CallTypeGroup
+	slot.call.frames = 0
+	slot.call.lost = 0
 	slot.dstID = p.DstID
 	slot.srcID = p.SrcID
-	t.state = dataCallActive
+	slot.state = dataCallActive
+	t.callActivity(p)
 	t.debugf(p, "data call started")
+	t.event(p, &CallStarted{Call: DataCall, Group: slot.call.group})
 	return nil
 }
 
 func (t *Terminal) voiceCallEnd(p *dmr.Packet) error {
 	slot := t.slot[p.Timeslot]
 
-	if t.state != voiceCallActive {
+	if slot.state != voiceCallActive {
 		return nil
 	}
 
 	slot.voice.streamID = 0
-	t.state = idle
+	slot.state = idle
+	slot.call.end = time.Now()
+	if slot.hang != nil {
+		slot.hang.Stop()
+	}
 	t.debugf(p, "voice call ended")
+	t.callEnded(p, VoiceCall)
 	return nil
 }
 
-func (t *Terminal) voiceCallStart(p *dmr.Packet) error {
+// callEnded emits the call ended event with the call statistics.
+func (t *Terminal) callEnded(p *dmr.Packet, call uint8) {
+	slot := t.slot[p.Timeslot]
+	t.event(p, &CallEnded{
+		Call:     call,
+		Group:    slot.call.group,
+		Duration: slot.call.end.Sub(slot.call.start),
+		Frames:   slot.call.frames,
+		Lost:     slot.call.lost,
+	})
+}
+
+// voiceCallStart starts a voice call, late entry is set if the call starts
+// without a voice LC header.
+func (t *Terminal) voiceCallStart(p *dmr.Packet, lateEntry bool) error {
 	slot := t.slot[p.Timeslot]
 
 	if slot.dstID != p.DstID || slot.srcID != p.SrcID {
@@ -354,13 +475,59 @@ func (t *Terminal) voiceCallStart(p *dmr.Packet) error {
 		}
 	}
 
-	slot.voice.streamID = p.StreamID
-	t.state = voiceCallActive
+	// This ends data calls (if any)
+	if err := t.dataCallEnd(p); err != nil {
+		return err
+	}
 
-	t.debugf(p, "voice call started")
+	slot.call.start = time.Now()
+	slot.call.end = time.Time{}
+	slot.call.group = p.CallType == dmr.CallTypeGroup
+	slot.call.frames = 0
+	slot.call.lost = 0
+	slot.dstID = p.DstID
+	slot.srcID = p.SrcID
+	slot.voice.streamID = p.StreamID
+	slot.voice.alias.header = nil
+	slot.voice.alias.blocks = [3]*lc.TalkerAliasBlockPDU{}
+	slot.voice.alias.alias = ""
+	slot.state = voiceCallActive
+	t.callActivity(p)
+
+	t.debugf(p, "voice call started, late entry %t", lateEntry)
+	t.event(p, &CallStarted{Call: VoiceCall, Group: slot.call.group, LateEntry: lateEntry})
 	return nil
 }
 
+// callActivity restarts the hang timer of the call on the slot.
+func (t *Terminal) callActivity(p *dmr.Packet) {
+	slot := t.slot[p.Timeslot]
+	slot.hangTime = CallHangTime
+	if slot.hang == nil {
+		ts := p.Timeslot
+		slot.hang = time.AfterFunc(slot.hangTime, func() { t.callHangExpired(ts) })
+		return
+	}
+	slot.hang.Reset(slot.hangTime)
+}
+
+// callHangExpired ends the call on the slot if no packets were received
+// within the hang time.
+func (t *Terminal) callHangExpired(ts uint8) {
+	t.rx.Lock()
+	defer t.rx.Unlock()
+
+	slot := t.slot[ts]
+	if slot.state == idle || time.Since(slot.last.packetReceived) < slot.hangTime {
+		// Call ended, or the timer was restarted while we were waiting
+		return
+	}
+
+	p := &dmr.Packet{Timeslot: ts, SrcID: slot.srcID, DstID: slot.dstID}
+	t.debugf(p, "call hang time of %s expired", slot.hangTime)
+	t.callEnd(p)
+}
+
 func (t *Terminal) handlePacket(r dmr.Repeater, p *dmr.Packet) error {
 	// Ignore packets not addressed to us or any of the talk groups we monitor
 	if false && !t.accept[p.DstID] {
@@ -368,6 +535,9 @@ func (t *Terminal) handlePacket(r dmr.Repeater, p *dmr.Packet) error {
 		return nil
 	}
 
+	t.rx.Lock()
+	defer t.rx.Unlock()
+
 	var err error
 
 	t.warningf(p, "handle packet: %s", dmr.DataTypeName[p.DataType])
@@ -381,6 +551,12 @@ func (t *Terminal) handlePacket(r dmr.Repeater, p *dmr.Packet) error {
 	case dmr.Data:
 		err = t.handleData(p)
 		break
+	case dmr.Rate1Data:
+		err = t.handleRate1Data(p)
+		break
+	case dmr.Rate12Data:
+		err = t.handleRate12Data(p)
+		break
 	case dmr.Rate34Data:
 		err = t.handleRate34Data(p)
 		break
@@ -429,6 +605,7 @@ func (t *Terminal) handleControlBlock(p *dmr.Packet) error {
 	}
 
 	t.debugf(p, cb.String())
+	t.event(p, &ControlBlockReceived{ControlBlock: cb})
 
 	return nil
 }
@@ -456,13 +633,69 @@ func (t *Terminal) handleData(p *dmr.Packet) error {
 		return err
 	}
 
+	t.debugf(p, h.String())
+
+	// Responses are not part of the data call we may be receiving
+	if d, ok := h.Data.(*dmr.ResponseData); ok {
+		if h.DstID != t.ID {
+			t.debugf(p, "ignored response, not sent to me")
+			return nil
+		}
+		return t.handleResponse(p, h, d)
+	}
+
+	// Retransmission of the blocks we requested with a selective ACK
+	if blocks, ok := retransmittedBlocks(h); ok {
+		if slot.data.retransmit && slot.data.header != nil && slot.data.header.SrcID == h.SrcID {
+			// The call may have ended on the hang timer while the sender was
+			// waiting for our selective ACK, the received blocks are kept
+			if slot.state != dataCallActive {
+				if err := t.dataCallStart(p); err != nil {
+					return err
+				}
+			}
+			slot.data.header = h
+			slot.data.packetHeaderValid = true
+			slot.data.blocksReceived = 0
+			slot.data.blocksExpected = blocks
+			t.callActivity(p)
+			t.debugf(p, "expecting %d retransmitted data blocks", blocks)
+			return nil
+		}
+		t.debugf(p, "ignored retransmission, no selective ACK was sent")
+		return nil
+	}
+
 	slot.data.packetHeaderValid = false
 	slot.data.blocksReceived = 0
+	slot.data.retransmit = false
+	slot.data.duplicate = false
 	slot.selectiveAckRequestsSent = 0
 	slot.rxSequence = 0
 
-	t.debugf(p, h.String())
 	switch d := h.Data.(type) {
+	case *dmr.ConfirmedData:
+		// A retry of the first packet after a resync is sent with the resync
+		// flag set as well
+		slot.data.duplicate = slot.data.delivered &&
+			slot.data.srcID == h.SrcID &&
+			slot.data.sendSequence == d.SendSequenceNumber &&
+			(!d.Resync || slot.data.resync)
+		slot.fullMessageBlocks = int(d.BlocksToFollow)
+		slot.data.blocks = make([]*dmr.DataBlock, slot.fullMessageBlocks)
+		slot.data.blocksExpected = int(d.BlocksToFollow)
+		t.debugf(p, "expecting %d data blocks, N(S) %d", slot.fullMessageBlocks, d.SendSequenceNumber)
+		err = t.dataCallStart(p)
+		break
+
+	case *dmr.UnconfirmedData:
+		slot.fullMessageBlocks = int(d.BlocksToFollow)
+		slot.data.blocks = make([]*dmr.DataBlock, slot.fullMessageBlocks)
+		slot.data.blocksExpected = int(d.BlocksToFollow)
+		t.debugf(p, "expecting %d data blocks", slot.fullMessageBlocks)
+		err = t.dataCallStart(p)
+		break
+
 	case *dmr.ShortDataDefinedData:
 		if d.FullMessage {
 			slot.fullMessageBlocks = int(d.AppendedBlocks)
@@ -485,36 +718,94 @@ func (t *Terminal) handleData(p *dmr.Packet) error {
 	return err
 }
 
-func (t *Terminal) handleRate34Data(p *dmr.Packet) error {
-	slot := t.slot[p.Timeslot]
-	slot.last.packetReceived = time.Now()
-
-	if t.state != dataCallActive {
-		t.debugf(p, "no data call in process, ignoring rate ¾ data")
-		return nil
+func (t *Terminal) handleRate1Data(p *dmr.Packet) error {
+	data, err := dmr.Rate1Bytes(p.InfoBits())
+	if err != nil {
+		return err
 	}
-	if slot.data.header == nil {
-		t.warningf(p, "got rate ¾ data, but no data header stored")
-		return nil
+	return t.handleDataBlock(p, dmr.Rate1Data, data)
+}
+
+func (t *Terminal) handleRate12Data(p *dmr.Packet) error {
+	var (
+		bits = p.InfoBits()
+		data = make([]byte, 12)
+	)
+
+	if err := bptc.Decode(bits, data); err != nil {
+		return err
 	}
+	return t.handleDataBlock(p, dmr.Rate12Data, data)
+}
 
+func (t *Terminal) handleRate34Data(p *dmr.Packet) error {
 	var (
 		bits = p.InfoBits()
 		data = make([]byte, 18)
 	)
 
 	if err := trellis.Decode(bits, data); err != nil {
-		return err
+		// The block CRC fails as well, keep the block so we can request
+		// retransmission
+		t.warningf(p, "%v", err)
+	}
+	return t.handleDataBlock(p, dmr.Rate34Data, data)
+}
+
+// handleDataBlock parses a decoded data block and adds it to the data call.
+func (t *Terminal) handleDataBlock(p *dmr.Packet, dataType uint8, data []byte) error {
+	slot := t.slot[p.Timeslot]
+	slot.last.packetReceived = time.Now()
+
+	if slot.state != dataCallActive {
+		t.debugf(p, "no data call in process, ignoring %s", dmr.DataTypeName[dataType])
+		return nil
+	}
+	t.callActivity(p)
+	slot.call.frames++
+	if slot.data.header == nil {
+		t.warningf(p, "got %s, but no data header stored", dmr.DataTypeName[dataType])
+		return nil
 	}
 
-	db, err := dmr.ParseDataBlock(data, dmr.Rate34Data, slot.data.header.ResponseRequested)
+	db, err := dmr.ParseDataBlock(data, dataType, slot.data.header.ResponseRequested)
 	if err != nil {
-		return err
+		if db == nil {
+			return err
+		}
+		// Keep track of the failed block, so we can request retransmission
+		t.warningf(p, "data block %d: %v", db.Serial, err)
 	}
 
 	return t.dataBlock(p, db)
 }
 
+// encodeDataBlock encodes a data block to info bits, the inverse of the
+// rate 1, ½ and ¾ data handlers.
+func encodeDataBlock(db *dmr.DataBlock, dataType uint8, confirmed bool) ([]byte, error) {
+	var (
+		data = db.Bytes(dataType, confirmed)
+		bits = make([]byte, dmr.InfoBits)
+	)
+
+	switch dataType {
+	case dmr.Rate1Data:
+		return dmr.Rate1Bits(data)
+	case dmr.Rate12Data:
+		if err := bptc.Encode(data, bits); err != nil {
+			return nil, err
+		}
+	case dmr.Rate34Data:
+		if err := trellis.Encode(data, bits); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("terminal: can't encode data blocks as %s", dmr.DataTypeName[dataType])
+	}
+
+	return bits, nil
+}
+
 func (t *Terminal) handleTerminatorWithLC(p *dmr.Packet) error {
 	// This ends both data and voice calls
 	if err := t.callEnd(p); err != nil {
@@ -548,18 +839,30 @@ func (t *Terminal) handleVoice(p *dmr.Packet) error {
 	slot := t.slot[p.Timeslot]
 	slot.last.packetReceived = time.Now()
 
-	switch t.state {
+	switch slot.state {
 	case voiceCallActive:
 		if p.StreamID != slot.voice.streamID {
 			// Only accept voice frames from the same stream
 			t.debugf(p, "ignored frame, active stream id: %#08x, this stream id: %#08x", slot.voice.streamID, p.StreamID)
 			return nil
 		}
+		t.callActivity(p)
 	default:
-		t.voiceCallStart(p)
+		t.voiceCallStart(p, true)
 		break
 	}
 
+	// Voice bursts A to F repeat, gaps are lost frames
+	if slot.call.frames > 0 {
+		var expect = slot.voice.lastFrame + 1
+		if slot.voice.lastFrame == dmr.VoiceBurstF {
+			expect = dmr.VoiceBurstA
+		}
+		slot.call.lost += (int(p.DataType) - int(expect) + 6) % 6
+	}
+	slot.call.frames++
+	slot.voice.lastFrame = p.DataType
+
 	// Check sync frame
 	sync := p.SyncBits()
 	patt := dmr.SyncPattern(sync)
@@ -580,7 +883,19 @@ func (t *Terminal) handleVoice(p *dmr.Packet) error {
 		// Handling embedded signalling LC
 		switch emb.LCSS {
 		case dmr.SingleFragment:
-			return nil // FIXME(pd0mz): unhandled
+			frag, err := dmr.ParseEmbeddedSignallingLCFromSyncBits(sync)
+			if err != nil {
+				return err
+			}
+			rc, err := dmr.ParseReverseChannel(frag)
+			if err != nil {
+				return err
+			}
+			if rc != nil {
+				t.infof(p, "%s", rc)
+				t.event(p, &ReverseChannelReceived{ReverseChannel: rc})
+			}
+			break
 		case dmr.FirstFragment:
 			slot.embeddedSignalling.Clear()
 			break
@@ -618,6 +933,7 @@ func (t *Terminal) handleVoice(p *dmr.Packet) error {
 				return err
 			}
 			t.debugf(p, "voice embedded lc: %s", lc.String())
+			t.embeddedLC(p, lc)
 		}
 	}
 
@@ -657,5 +973,47 @@ func (t *Terminal) handleVoiceLC(p *dmr.Packet) error {
 
 	t.debugf(p, "voice header lc: %s", lc.String())
 
+	// The voice LC header is repeated, a new stream starts a new call
+	slot := t.slot[p.Timeslot]
+	if slot.state != voiceCallActive || slot.voice.streamID != p.StreamID {
+		if err := t.voiceCallEnd(p); err != nil {
+			return err
+		}
+		if err := t.voiceCallStart(p, false); err != nil {
+			return err
+		}
+	}
+	slot.last.packetReceived = time.Now()
+	t.event(p, &VoiceLCReceived{LC: lc})
+
 	return nil
 }
+
+// embeddedLC handles the LC embedded in voice bursts, talker aliases are
+// assembled from their header and blocks.
+func (t *Terminal) embeddedLC(p *dmr.Packet, l *lc.LC) {
+	slot := t.slot[p.Timeslot]
+	t.event(p, &EmbeddedLCReceived{LC: l})
+
+	switch l.Opcode {
+	case lc.TalkerAliasHeader:
+		slot.voice.alias.header = l.TalkerAliasHeader
+	case lc.TalkerAliasBlk1, lc.TalkerAliasBlk2, lc.TalkerAliasBlk3:
+		var i = l.Opcode - lc.TalkerAliasBlk1
+		slot.voice.alias.blocks[i] = l.TalkerAliasBlocks[i]
+	case lc.GpsInfo:
+		lat, lon := l.GpsInfo.Coordinates()
+		t.infof(p, "position %f,%f", lat, lon)
+		t.event(p, &GPSReceived{Latitude: lat, Longitude: lon, Info: l.GpsInfo})
+		return
+	default:
+		return
+	}
+
+	alias, ok := lc.TalkerAlias(slot.voice.alias.header, slot.voice.alias.blocks)
+	if ok && alias != slot.voice.alias.alias {
+		slot.voice.alias.alias = alias
+		t.infof(p, "talker alias %q", alias)
+		t.event(p, &TalkerAliasReceived{Alias: alias})
+	}
+}
@@ -0,0 +1,403 @@
+package terminal
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pd0mz/go-dmr"
+	"github.com/pd0mz/go-dmr/bptc"
+	"github.com/pd0mz/go-dmr/lc"
+)
+
+// testRepeater records the packets sent.
+type testRepeater struct {
+	mutex sync.Mutex
+	pf    dmr.PacketFunc
+	sent  []*dmr.Packet
+}
+
+func (r *testRepeater) Active() bool                   { return true }
+func (r *testRepeater) Close() error                   { return nil }
+func (r *testRepeater) ListenAndServe() error          { return nil }
+func (r *testRepeater) GetPacketFunc() dmr.PacketFunc  { return r.pf }
+func (r *testRepeater) SetPacketFunc(f dmr.PacketFunc) { r.pf = f }
+func (r *testRepeater) Send(p *dmr.Packet) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.sent = append(r.sent, p)
+	return nil
+}
+
+// testLoopback passes the packets sent by one terminal to the other, the
+// filter can modify packets in transit, or drop them by returning false.
+type testLoopback struct {
+	mutex  sync.Mutex
+	pf     dmr.PacketFunc
+	peer   *testLoopback
+	filter func(*dmr.Packet) bool
+	sent   []*dmr.Packet
+}
+
+func (r *testLoopback) Active() bool                   { return true }
+func (r *testLoopback) Close() error                   { return nil }
+func (r *testLoopback) ListenAndServe() error          { return nil }
+func (r *testLoopback) GetPacketFunc() dmr.PacketFunc  { return r.pf }
+func (r *testLoopback) SetPacketFunc(f dmr.PacketFunc) { r.pf = f }
+func (r *testLoopback) Send(p *dmr.Packet) error {
+	var cp = *p
+	cp.Bits = append([]byte{}, p.Bits...)
+
+	r.mutex.Lock()
+	r.sent = append(r.sent, p)
+	pass := r.filter == nil || r.filter(&cp)
+	r.mutex.Unlock()
+
+	if pass {
+		r.peer.pf(r.peer, &cp)
+	}
+	return nil
+}
+
+// packets returns the packets sent so far.
+func (r *testLoopback) packets() []*dmr.Packet {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]*dmr.Packet{}, r.sent...)
+}
+
+// testTerminals returns two terminals with ID 1 and 2 that are linked by
+// loopback repeaters.
+func testTerminals() (*Terminal, *testLoopback, *Terminal, *testLoopback) {
+	var ra, rb = &testLoopback{}, &testLoopback{}
+	ra.peer, rb.peer = rb, ra
+	return New(1, "A", ra), ra, New(2, "B", rb), rb
+}
+
+func testVoiceBurst(t *testing.T, ts uint8, streamID uint32) *dmr.Packet {
+	p := &dmr.Packet{
+		Timeslot: ts,
+		SrcID:    1000 + uint32(ts),
+		DstID:    9,
+		StreamID: streamID,
+		DataType: dmr.VoiceBurstA,
+		CallType: dmr.CallTypeGroup,
+	}
+	if err := p.SetVoiceBits(make([]byte, dmr.VoiceBits), dmr.SyncPatternFor(dmr.SourceBS, true, ts)); err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	return p
+}
+
+func testControlBlock(t *testing.T, ts uint8) *dmr.Packet {
+	cb := &dmr.ControlBlock{
+		Last:   true,
+		Opcode: dmr.PreambleOpcode,
+		SrcID:  1000 + uint32(ts),
+		DstID:  9,
+		Data:   &dmr.Preamble{DstIsGroup: true},
+	}
+	data, err := cb.Bytes()
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	var info = make([]byte, dmr.InfoBits)
+	if err = bptc.Encode(data, info); err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+
+	p := &dmr.Packet{
+		Timeslot: ts,
+		SrcID:    cb.SrcID,
+		DstID:    cb.DstID,
+		DataType: dmr.CSBK,
+		CallType: dmr.CallTypeGroup,
+	}
+	st := &dmr.SlotType{DataType: dmr.CSBK}
+	if err = p.SetInfoBits(info, st.Bits(), dmr.SyncPatternFor(dmr.SourceBS, false, ts)); err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	return p
+}
+
+func testState(term *Terminal, ts uint8) uint8 {
+	term.rx.Lock()
+	defer term.rx.Unlock()
+	return term.slot[ts].state
+}
+
+func TestSlotCallState(t *testing.T) {
+	defer func(d time.Duration) { DataBurstInterval = d }(DataBurstInterval)
+	DataBurstInterval = 0
+
+	// Data call on TS2
+	var (
+		tx     = &testRepeater{}
+		sender = New(1, "A", tx)
+		opts   = DefaultMessageOptions
+	)
+	opts.Timeslot = 1
+	if err := sender.SendMessage(2, false, "CQCQCQ PD0MZ", &opts); err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+
+	var (
+		rx       = &testRepeater{}
+		term     = New(2, "B", rx)
+		frames   = make([]int, 2)
+		messages []*Message
+	)
+	term.SetVoiceFrameFunc(func(p *dmr.Packet, _ []byte) { frames[p.Timeslot]++ })
+	term.SetMessageFunc(func(m *Message) { messages = append(messages, m) })
+
+	// Voice call on TS1, interleaved with the data call on TS2
+	term.handlePacket(rx, testVoiceBurst(t, 0, 1))
+	for i, p := range tx.sent {
+		term.handlePacket(rx, p)
+		term.handlePacket(rx, testVoiceBurst(t, 0, 1))
+
+		if state := testState(term, 0); state != voiceCallActive {
+			t.Fatalf("TS1 voice call ended by data burst %d on TS2, state %d", i, state)
+		}
+		if i == 0 {
+			if state := testState(term, 1); state != dataCallActive {
+				t.Fatalf("TS2 data call not started, state %d", state)
+			}
+		}
+	}
+	if frames[0] != len(tx.sent)+1 {
+		t.Fatalf("expected %d voice frames on TS1, got %d", len(tx.sent)+1, frames[0])
+	}
+	if len(messages) != 1 || messages[0].Timeslot != 1 || messages[0].Text != "CQCQCQ PD0MZ" {
+		t.Fatalf("expected message on TS2, got %+v", messages)
+	}
+	if state := testState(term, 1); state != idle {
+		t.Fatalf("TS2 data call not ended, state %d", state)
+	}
+
+	// Voice on TS2, frames of another stream on TS1 are ignored
+	term.handlePacket(rx, testVoiceBurst(t, 1, 2))
+	term.handlePacket(rx, testVoiceBurst(t, 0, 3))
+	if frames[0] != len(tx.sent)+1 || frames[1] != 1 {
+		t.Fatalf("unexpected voice frames %v", frames)
+	}
+
+	// Control blocks only end the call on their own timeslot
+	term.handlePacket(rx, testControlBlock(t, 1))
+	if state := testState(term, 1); state != idle {
+		t.Fatalf("TS2 voice call not ended, state %d", state)
+	}
+	if state := testState(term, 0); state != voiceCallActive {
+		t.Fatalf("TS1 voice call ended by control block on TS2, state %d", state)
+	}
+	term.handlePacket(rx, testControlBlock(t, 0))
+	if state := testState(term, 0); state != idle {
+		t.Fatalf("TS1 voice call not ended, state %d", state)
+	}
+}
+
+func TestSlotHangTime(t *testing.T) {
+	defer func(d time.Duration) { CallHangTime = d }(CallHangTime)
+	CallHangTime = time.Millisecond * 50
+
+	var (
+		rx   = &testRepeater{}
+		term = New(2, "B", rx)
+	)
+	term.handlePacket(rx, testVoiceBurst(t, 0, 1))
+	term.handlePacket(rx, testVoiceBurst(t, 1, 2))
+
+	// Keep the call on TS2 going, the call on TS1 hangs
+	for i := 0; i < 15; i++ {
+		time.Sleep(time.Millisecond * 10)
+		term.handlePacket(rx, testVoiceBurst(t, 1, 2))
+	}
+	if state := testState(term, 0); state != idle {
+		t.Fatalf("TS1 voice call not ended after hang time, state %d", state)
+	}
+	if state := testState(term, 1); state != voiceCallActive {
+		t.Fatalf("TS2 voice call ended by hang time of TS1, state %d", state)
+	}
+
+	time.Sleep(CallHangTime * 3)
+	if state := testState(term, 1); state != idle {
+		t.Fatalf("TS2 voice call not ended after hang time, state %d", state)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	defer func(d time.Duration) { DataBurstInterval = d }(DataBurstInterval)
+	DataBurstInterval = 0
+
+	var (
+		rx     = &testRepeater{}
+		term   = New(2, "B", rx)
+		events []Event
+	)
+	term.SetEventFunc(func(e Event) { events = append(events, e) })
+
+	// Late entry voice call on TS1, burst C is lost
+	term.handlePacket(rx, testVoiceBurst(t, 0, 1))
+	for _, dataType := range []uint8{dmr.VoiceBurstB, dmr.VoiceBurstD} {
+		p := testVoiceBurst(t, 0, 1)
+		p.DataType = dataType
+		emb := &dmr.EMB{LCSS: dmr.SingleFragment}
+		if err := p.SetVoiceEmbeddedBits(make([]byte, dmr.VoiceBits), emb, make([]byte, dmr.EMBSignallingLCFragmentBits)); err != nil {
+			t.Fatalf("encode failed: %v", err)
+		}
+		term.handlePacket(rx, p)
+	}
+	term.handlePacket(rx, testControlBlock(t, 0))
+
+	// Text message on TS2
+	var (
+		tx     = &testRepeater{}
+		sender = New(1, "A", tx)
+		opts   = DefaultMessageOptions
+	)
+	opts.Timeslot = 1
+	if err := sender.SendMessage(2, false, "CQCQCQ PD0MZ", &opts); err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	for _, p := range tx.sent {
+		term.handlePacket(rx, p)
+	}
+
+	if len(events) != 6 {
+		t.Fatalf("expected 6 events, got %d: %v", len(events), events)
+	}
+	if e, ok := events[0].(*CallStarted); !ok || e.Call != VoiceCall || !e.LateEntry || !e.Group || e.Timeslot != 0 {
+		t.Fatalf("expected late entry voice call started, got %s", events[0])
+	}
+	if e, ok := events[1].(*CallEnded); !ok || e.Call != VoiceCall || e.Frames != 3 || e.Lost != 1 {
+		t.Fatalf("expected voice call ended with 3 frames and 1 lost, got %s", events[1])
+	}
+	if _, ok := events[2].(*ControlBlockReceived); !ok {
+		t.Fatalf("expected control block, got %s", events[2])
+	}
+	if e, ok := events[3].(*CallStarted); !ok || e.Call != DataCall || e.Timeslot != 1 || e.SrcID != 1 || e.DstID != 2 {
+		t.Fatalf("expected data call started, got %s", events[3])
+	}
+	if e, ok := events[4].(*MessageReceived); !ok || e.Message.Text != "CQCQCQ PD0MZ" {
+		t.Fatalf("expected message, got %s", events[4])
+	}
+	if e, ok := events[5].(*CallEnded); !ok || e.Call != DataCall || e.Frames != len(tx.sent)-1 || e.Lost != 0 {
+		t.Fatalf("expected data call ended, got %s", events[5])
+	}
+}
+
+func TestVoiceCall(t *testing.T) {
+	defer func(d time.Duration) { VoiceBurstInterval = d }(VoiceBurstInterval)
+	VoiceBurstInterval = 0
+
+	var (
+		tx     = &testRepeater{}
+		sender = New(1, "A", tx)
+		opts   = DefaultVoiceCallOptions
+	)
+	sender.ColorCode = 1
+	opts.Timeslot = 1
+	opts.TalkerAlias = "PD0MZ"
+	opts.GpsInfo = lc.NewGpsInfoPDU(52.3676, 4.9041, lc.ErrorLT20m)
+	call, err := sender.StartVoiceCall(9, true, &opts)
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	call.SetReverseChannel(dmr.RCCeaseTransmission)
+
+	// Four superframes, written in odd sizes
+	voice := make([]byte, VoiceFrameSize*24)
+	for len(voice) > 0 {
+		n := 10
+		if n > len(voice) {
+			n = len(voice)
+		}
+		if _, err = call.Write(voice[:n]); err != nil {
+			t.Fatalf("encode failed: %v", err)
+		}
+		voice = voice[n:]
+	}
+	if err = call.Close(); err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	if _, err = call.Write(make([]byte, VoiceFrameSize)); err == nil {
+		t.Fatal("expected write after close to fail")
+	}
+
+	if len(tx.sent) != 26 {
+		t.Fatalf("expected 26 packets, got %d", len(tx.sent))
+	}
+	for i, p := range tx.sent {
+		var dataType uint8
+		switch i {
+		case 0:
+			dataType = dmr.VoiceLC
+		case len(tx.sent) - 1:
+			dataType = dmr.TerminatorWithLC
+		default:
+			dataType = dmr.VoiceBurstA + uint8(i-1)%6
+		}
+		if p.DataType != dataType {
+			t.Fatalf("packet %d: expected data type %d, got %d", i, dataType, p.DataType)
+		}
+		if p.Sequence != uint8(i) || p.StreamID != tx.sent[0].StreamID || p.Timeslot != 1 {
+			t.Fatalf("packet %d: unexpected sequence %d, stream %#08x or timeslot %d", i, p.Sequence, p.StreamID, p.Timeslot)
+		}
+		if p.SrcID != 1 || p.DstID != 9 || p.CallType != dmr.CallTypeGroup {
+			t.Fatalf("packet %d: unexpected addressing %d->%d", i, p.SrcID, p.DstID)
+		}
+		if dataType > dmr.VoiceBurstA && dataType <= dmr.VoiceBurstF {
+			bits, err := dmr.ParseEMBBitsFromSync(p.SyncBits())
+			if err != nil {
+				t.Fatalf("packet %d: decode failed: %v", i, err)
+			}
+			emb, err := dmr.ParseEMB(bits)
+			if err != nil {
+				t.Fatalf("packet %d: decode failed: %v", i, err)
+			}
+			lcss := dmr.SingleFragment
+			if dataType < dmr.VoiceBurstF {
+				lcss = embeddedLCSS[dataType-dmr.VoiceBurstB]
+			}
+			if emb.ColorCode != 1 || emb.LCSS != lcss {
+				t.Fatalf("packet %d: unexpected EMB %s", i, emb)
+			}
+		}
+	}
+
+	var (
+		rx     = &testRepeater{}
+		term   = New(2, "B", rx)
+		events []Event
+	)
+	term.SetEventFunc(func(e Event) { events = append(events, e) })
+	for _, p := range tx.sent {
+		term.handlePacket(rx, p)
+	}
+	if len(events) != 10 {
+		t.Fatalf("expected 10 events, got %d: %v", len(events), events)
+	}
+	if e, ok := events[0].(*CallStarted); !ok || e.Call != VoiceCall || e.LateEntry || !e.Group || e.Timeslot != 1 {
+		t.Fatalf("expected voice call started, got %s", events[0])
+	}
+	if e, ok := events[1].(*VoiceLCReceived); !ok || e.LC.VoiceChannelUser == nil || e.LC.VoiceChannelUser.SrcID != 1 || e.LC.VoiceChannelUser.DstID != 9 {
+		t.Fatalf("expected voice LC, got %s", events[1])
+	}
+	for _, i := range []int{2, 6} {
+		if e, ok := events[i].(*EmbeddedLCReceived); !ok || e.LC.VoiceChannelUser == nil || e.LC.VoiceChannelUser.DstID != 9 {
+			t.Fatalf("expected embedded voice LC, got %s", events[i])
+		}
+	}
+	if e, ok := events[3].(*ReverseChannelReceived); !ok || e.ReverseChannel.Command != dmr.RCCeaseTransmission {
+		t.Fatalf("expected reverse channel, got %s", events[3])
+	}
+	if e, ok := events[5].(*TalkerAliasReceived); !ok || e.Alias != "PD0MZ" {
+		t.Fatalf("expected talker alias, got %s", events[5])
+	}
+	if e, ok := events[8].(*GPSReceived); !ok || e.Latitude < 52.36 || e.Latitude > 52.37 || e.Longitude < 4.90 || e.Longitude > 4.91 {
+		t.Fatalf("expected GPS, got %s", events[8])
+	}
+	if e, ok := events[9].(*CallEnded); !ok || e.Call != VoiceCall || e.Frames != 24 || e.Lost != 0 {
+		t.Fatalf("expected voice call ended, got %s", events[9])
+	}
+}
@@ -0,0 +1,265 @@
+package terminal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/pd0mz/go-dmr"
+	"github.com/pd0mz/go-dmr/bptc"
+	"github.com/pd0mz/go-dmr/lc"
+	"github.com/pd0mz/go-dmr/lc/serviceoptions"
+)
+
+// VoiceBurstInterval is the time between voice bursts we send.
+var VoiceBurstInterval = VoiceFrameDuration
+
+// VoiceFrameSize is the size of the three AMBE+2 frames in a voice burst.
+const VoiceFrameSize = dmr.VoiceBits / 8
+
+// CRC masks of the full LC, see DMR AI. spec. page 143.
+const (
+	voiceLCHeaderMask    uint8 = 0x96
+	terminatorWithLCMask uint8 = 0x99
+)
+
+// embeddedLCSS are the link control start/stop values of voice bursts B to E.
+var embeddedLCSS = [4]uint8{
+	dmr.FirstFragment,
+	dmr.Continuation,
+	dmr.Continuation,
+	dmr.LastFragment,
+}
+
+// VoiceCallOptions control how a voice call is sent.
+type VoiceCallOptions struct {
+	Timeslot       uint8 // Timeslot to send on, 0 for TS1
+	ServiceOptions serviceoptions.ServiceOptions
+	TalkerAlias    string         // Talker alias, sent as embedded LC
+	GpsInfo        *lc.GpsInfoPDU // Position, sent as embedded LC
+}
+
+// DefaultVoiceCallOptions are used if no options are passed to StartVoiceCall.
+var DefaultVoiceCallOptions = VoiceCallOptions{
+	Timeslot: 0,
+}
+
+// VoiceStream is a voice call we send. Voice is written as AMBE+2 frames, every
+// VoiceFrameSize bytes are sent as a voice burst. Writes block to pace the
+// bursts at VoiceBurstInterval.
+type VoiceStream struct {
+	t        *Terminal
+	opts     VoiceCallOptions
+	lc       *lc.LC
+	group    bool
+	streamID uint32
+
+	// Embedded LC, every other superframe carries the voice channel user LC,
+	// the others cycle through the talker alias and GPS info
+	embedded   []*lc.LC
+	superframe int
+	fragments  [][]byte
+
+	// Reverse channel, sent in the next voice burst F
+	rc *dmr.ReverseChannel
+
+	mutex    sync.Mutex
+	sequence uint8
+	burst    uint8     // Position in the superframe, 0 is burst A
+	next     time.Time // Time the next burst is due
+	buffer   []byte    // Incomplete voice burst
+	closed   bool
+}
+
+var _ io.WriteCloser = (*VoiceStream)(nil)
+
+// StartVoiceCall starts a voice call by sending the voice LC header, the call
+// is ended by closing it.
+func (t *Terminal) StartVoiceCall(dst uint32, group bool, opts *VoiceCallOptions) (*VoiceStream, error) {
+	if opts == nil {
+		opts = &DefaultVoiceCallOptions
+	}
+	if opts.Timeslot > 1 {
+		return nil, fmt.Errorf("terminal: invalid timeslot %d", opts.Timeslot)
+	}
+
+	c := &VoiceStream{
+		t:     t,
+		opts:  *opts,
+		group: group,
+		lc: &lc.LC{
+			Opcode: lc.UnitToUnitVoiceChannelUser,
+			VoiceChannelUser: &lc.VoiceChannelUserPDU{
+				ServiceOptions: opts.ServiceOptions,
+				DstID:          dst,
+				SrcID:          t.ID,
+			},
+		},
+		streamID: rand.Uint32(),
+		next:     time.Now(),
+	}
+	if group {
+		c.lc.Opcode = lc.GroupVoiceChannelUser
+	}
+	if opts.TalkerAlias != "" {
+		c.embedded = append(c.embedded, lc.TalkerAliasLC(opts.TalkerAlias)...)
+	}
+	if opts.GpsInfo != nil {
+		c.embedded = append(c.embedded, &lc.LC{Opcode: lc.GpsInfo, GpsInfo: opts.GpsInfo})
+	}
+
+	log.Infof("[slot %d] starting voice call to %d\n", opts.Timeslot+1, dst)
+	if err := c.sendLC(dmr.VoiceLC, voiceLCHeaderMask); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Write sends the voice frames, incomplete bursts are kept until the next
+// write.
+func (c *VoiceStream) Write(b []byte) (int, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.closed {
+		return 0, errors.New("terminal: voice call closed")
+	}
+
+	c.buffer = append(c.buffer, b...)
+	for len(c.buffer) >= VoiceFrameSize {
+		if err := c.sendVoice(c.buffer[:VoiceFrameSize]); err != nil {
+			return 0, err
+		}
+		c.buffer = c.buffer[VoiceFrameSize:]
+	}
+	return len(b), nil
+}
+
+// SetReverseChannel sends the reverse channel command in the next voice burst
+// F, instead of the null embedded message.
+func (c *VoiceStream) SetReverseChannel(command uint8) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.rc = &dmr.ReverseChannel{Command: command}
+}
+
+// Close ends the voice call by sending the terminator with LC, an incomplete
+// voice burst is discarded.
+func (c *VoiceStream) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.closed {
+		return errors.New("terminal: voice call closed")
+	}
+	c.closed = true
+	c.buffer = nil
+
+	log.Infof("[slot %d] ending voice call to %d\n", c.opts.Timeslot+1, c.lc.VoiceChannelUser.DstID)
+	return c.sendLC(dmr.TerminatorWithLC, terminatorWithLCMask)
+}
+
+// sendLC sends the full LC as voice LC header or terminator with LC.
+func (c *VoiceStream) sendLC(dataType, mask uint8) error {
+	var (
+		data = c.lc.FullBytes()
+		info = make([]byte, dmr.InfoBits)
+	)
+
+	// Applying CRC mask to the checksum. See DMR AI. spec. page 143.
+	data[9] ^= mask
+	data[10] ^= mask
+	data[11] ^= mask
+
+	if err := bptc.Encode(data, info); err != nil {
+		return err
+	}
+
+	p := c.packet(dataType)
+	st := &dmr.SlotType{ColorCode: c.t.ColorCode, DataType: dataType}
+	if err := p.SetInfoBits(info, st.Bits(), dmr.SyncPatternFor(dmr.SourceBS, false, c.opts.Timeslot)); err != nil {
+		return err
+	}
+	return c.send(p)
+}
+
+// sendVoice sends the next voice burst of the superframe. Burst A carries
+// the voice SYNC, bursts B to E carry the embedded LC and burst F carries a
+// reverse channel or null embedded message.
+func (c *VoiceStream) sendVoice(frames []byte) error {
+	var (
+		voice = dmr.BytesToBits(frames)
+		p     = c.packet(dmr.VoiceBurstA + c.burst)
+		emb   = &dmr.EMB{ColorCode: c.t.ColorCode, LCSS: dmr.SingleFragment}
+		err   error
+	)
+
+	switch c.burst {
+	case 0:
+		err = p.SetVoiceBits(voice, dmr.SyncPatternFor(dmr.SourceBS, true, c.opts.Timeslot))
+		break
+	case 5:
+		var fragment = dmr.NullEmbeddedMessage()
+		if c.rc != nil {
+			fragment = c.rc.Bits()
+			c.rc = nil
+		}
+		err = p.SetVoiceEmbeddedBits(voice, emb, fragment)
+		c.superframe++
+		break
+	default:
+		if c.burst == 1 {
+			if c.fragments, err = c.embeddedLC().EmbeddedFragments(); err != nil {
+				return err
+			}
+		}
+		emb.LCSS = embeddedLCSS[c.burst-1]
+		err = p.SetVoiceEmbeddedBits(voice, emb, c.fragments[c.burst-1])
+		break
+	}
+	if err != nil {
+		return err
+	}
+
+	c.burst = (c.burst + 1) % 6
+	return c.send(p)
+}
+
+// embeddedLC returns the LC embedded in the current superframe.
+func (c *VoiceStream) embeddedLC() *lc.LC {
+	if len(c.embedded) == 0 || c.superframe%2 == 0 {
+		return c.lc
+	}
+	return c.embedded[(c.superframe/2)%len(c.embedded)]
+}
+
+func (c *VoiceStream) packet(dataType uint8) *dmr.Packet {
+	p := &dmr.Packet{
+		Timeslot: c.opts.Timeslot,
+		Sequence: c.sequence,
+		SrcID:    c.lc.VoiceChannelUser.SrcID,
+		DstID:    c.lc.VoiceChannelUser.DstID,
+		StreamID: c.streamID,
+		DataType: dataType,
+		CallType: dmr.CallTypePrivate,
+	}
+	if c.group {
+		p.CallType = dmr.CallTypeGroup
+	}
+	c.sequence++
+	return p
+}
+
+// send sends the burst when it is due.
+func (c *VoiceStream) send(p *dmr.Packet) error {
+	if d := time.Until(c.next); d > 0 {
+		time.Sleep(d)
+	} else {
+		c.next = time.Now()
+	}
+	c.next = c.next.Add(VoiceBurstInterval)
+	return c.t.Send(p)
+}
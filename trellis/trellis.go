@@ -30,7 +30,25 @@ var (
 )
 
 // Decode is a convenience function that takes 196 Info bits and decodes them to 18 bytes (144 bits) binary using Trellis decoding.
+// Error-free Info bits are decoded directly, symbol errors are corrected using the hard-decision Viterbi decoder, see DecodeViterbi.
+// An error is returned if the path metric exceeds MaxPathMetric.
 func Decode(bits []byte, bytes []byte) error {
+	if err := decodeDirect(bits, bytes); err == nil {
+		return nil
+	}
+	metric, err := DecodeViterbi(bits, bytes)
+	if err != nil {
+		return err
+	}
+	if metric > MaxPathMetric {
+		return fmt.Errorf("trellis: path metric %.1f exceeds %.1f, data is corrupted", metric, MaxPathMetric)
+	}
+	return nil
+}
+
+// decodeDirect decodes the Info bits by walking the constellation points
+// through the encoder state table, it fails on any symbol error.
+func decodeDirect(bits []byte, bytes []byte) error {
 	if bytes == nil {
 		return errors.New("trellis: bytes can't be nil")
 	}
@@ -227,3 +245,101 @@ func ExtractBinary(tribits []uint8) ([]byte, error) {
 
 	return bits, nil
 }
+
+// constellationDibits maps constellation points to dibit pairs, the inverse
+// of ConstellationPoints.
+var constellationDibits = [16][2]int8{
+	{+1, -1}, {-1, -1}, {+3, -3}, {-3, -3},
+	{-3, -1}, {+3, -1}, {-1, -3}, {+1, -3},
+	{-3, +3}, {+3, +3}, {-1, +1}, {+1, +1},
+	{+1, +3}, {-1, +3}, {+3, +1}, {-3, +1},
+}
+
+// Encode is a convenience function that takes 18 bytes (144 bits) binary and encodes them to 196 Info bits using Trellis encoding.
+func Encode(bytes []byte, bits []byte) error {
+	if bytes == nil {
+		return errors.New("trellis: bytes can't be nil")
+	}
+	if len(bytes) < 18 {
+		return fmt.Errorf("trellis: need at least 18 bytes, got %d", len(bytes))
+	}
+	if len(bits) < dmr.InfoBits {
+		return fmt.Errorf("trellis: need buffer of at least %d bits, got %d", dmr.InfoBits, len(bits))
+	}
+
+	tribits := extractTribitsFromBinary(dmr.BytesToBits(bytes[:18]))
+	points := encodeTribits(tribits)
+	dibits := constellationToDibits(points)
+	interleaved, err := Interleave(dibits)
+	if err != nil {
+		return err
+	}
+	copy(bits, dibitsToBits(interleaved))
+	return nil
+}
+
+// extractTribitsFromBinary splits 144 bits in 48 tribits, followed by the
+// flushing tribit.
+func extractTribitsFromBinary(bits []byte) []uint8 {
+	var tribits = make([]uint8, 49)
+	for i := 0; i < 144; i += 3 {
+		tribits[i/3] = bits[i]<<2 | bits[i+1]<<1 | bits[i+2]
+	}
+	return tribits
+}
+
+// encodeTribits runs the tribits through the Trellis state machine according to DMR AI protocol spec. page 129.
+func encodeTribits(tribits []uint8) []uint8 {
+	var (
+		last   uint8
+		points = make([]uint8, len(tribits))
+	)
+	for i, tribit := range tribits {
+		points[i] = encoderStateTransition[int(last)*8+int(tribit)]
+		last = tribit
+	}
+	return points
+}
+
+func constellationToDibits(points []uint8) []int8 {
+	var dibits = make([]int8, 98)
+	for i, point := range points {
+		dibits[i*2] = constellationDibits[point][0]
+		dibits[i*2+1] = constellationDibits[point][1]
+	}
+	return dibits
+}
+
+// Interleave the dibits according to DMR AI protocol spec. page 130.
+func Interleave(dibits []int8) ([]int8, error) {
+	if dibits == nil {
+		return nil, errors.New("trellis: dibits can't be nil")
+	}
+	if len(dibits) != 98 {
+		return nil, fmt.Errorf("trellis: expected 98 dibits, got %d", len(dibits))
+	}
+
+	var interleaved = make([]int8, 98)
+	for i := 0; i < 98; i++ {
+		interleaved[i] = dibits[interleaveMatrix[i]]
+	}
+	return interleaved, nil
+}
+
+// dibitsToBits maps dibits to bits, the inverse of ExtractDibits.
+func dibitsToBits(dibits []int8) []byte {
+	var bits = make([]byte, dmr.InfoBits)
+	for i, dibit := range dibits {
+		switch dibit {
+		case +3:
+			bits[i*2], bits[i*2+1] = 0, 1
+		case +1:
+			bits[i*2], bits[i*2+1] = 0, 0
+		case -1:
+			bits[i*2], bits[i*2+1] = 1, 0
+		case -3:
+			bits[i*2], bits[i*2+1] = 1, 1
+		}
+	}
+	return bits
+}
@@ -0,0 +1,201 @@
+package trellis
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/pd0mz/go-dmr"
+)
+
+func testRoundTrip(t *testing.T, want []byte) {
+	var bits = make([]byte, dmr.InfoBits)
+	if err := Encode(want, bits); err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+
+	var test = make([]byte, 18)
+	if err := Decode(bits, test); err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if !bytes.Equal(test, want) {
+		t.Fatalf("decode failed: expected %x, got %x", want, test)
+	}
+}
+
+func TestTrellis(t *testing.T) {
+	var want = make([]byte, 18)
+	testRoundTrip(t, want)
+
+	for i := range want {
+		want[i] = 0xff
+	}
+	testRoundTrip(t, want)
+
+	for i := range want {
+		want[i] = byte(i * 37)
+	}
+	testRoundTrip(t, want)
+}
+
+func TestTrellisReference(t *testing.T) {
+	// All zero tribits stay in state 0, so every constellation point is 0,
+	// dibits +1 -1. Interleaving keeps even and odd dibits in place, giving
+	// the Info bits 00 10 repeated.
+	var bits = make([]byte, dmr.InfoBits)
+	if err := Encode(make([]byte, 18), bits); err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	for i := 0; i < dmr.InfoBits; i += 4 {
+		if !bytes.Equal(bits[i:i+4], []byte{0, 0, 1, 0}) {
+			t.Fatalf("encode failed: expected bits 0010 at %d, got %v", i, bits[i:i+4])
+		}
+	}
+
+	// The direct decoder walks the encoder state table, independent of the
+	// encoder and the Viterbi decoder
+	var want = make([]byte, 18)
+	for n := 0; n < 16; n++ {
+		for i := range want {
+			want[i] = byte(n*31 + i*i*7)
+		}
+		if err := Encode(want, bits); err != nil {
+			t.Fatalf("encode failed: %v", err)
+		}
+		var test = make([]byte, 18)
+		if err := decodeDirect(bits, test); err != nil {
+			t.Fatalf("decode failed: %v", err)
+		}
+		if !bytes.Equal(test, want) {
+			t.Fatalf("decode failed: expected %x, got %x", want, test)
+		}
+	}
+
+	// A symbol error breaks the direct decoder
+	bits[10] ^= 1
+	if err := decodeDirect(bits, make([]byte, 18)); err == nil {
+		t.Fatal("decode of corrupted bits did not fail")
+	}
+}
+
+func TestTrellisDataBlocks(t *testing.T) {
+	var fragment = &dmr.DataFragment{Data: make([]byte, 64)}
+	for i := range fragment.Data {
+		fragment.Data[i] = byte(i)
+	}
+
+	blocks, err := fragment.DataBlocks(dmr.Rate34Data, true)
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	for _, block := range blocks {
+		testRoundTrip(t, block.Bytes(dmr.Rate34Data, true))
+	}
+}
+
+func TestViterbi(t *testing.T) {
+	var want = make([]byte, 18)
+	for i := range want {
+		want[i] = byte(i*91 + 7)
+	}
+	var bits = make([]byte, dmr.InfoBits)
+	if err := Encode(want, bits); err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+
+	var test = make([]byte, 18)
+	metric, err := DecodeViterbi(bits, test)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if metric != 0 {
+		t.Fatalf("decode failed: expected path metric 0, got %f", metric)
+	}
+
+	// Corrupt some dibits, far enough apart to be corrected
+	var corrupt = make([]byte, len(bits))
+	copy(corrupt, bits)
+	for _, i := range []int{10, 90, 170} {
+		corrupt[i] ^= 1
+	}
+	if metric, err = DecodeViterbi(corrupt, test); err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if !bytes.Equal(test, want) {
+		t.Fatalf("decode failed: expected %x, got %x", want, test)
+	}
+	if metric == 0 {
+		t.Fatal("decode failed: expected non-zero path metric")
+	}
+	t.Logf("hard decision path metric with 3 symbol errors: %f", metric)
+
+	// Mark the corrupted dibits as erased
+	var confidence = make([]float64, 98)
+	for i := range confidence {
+		confidence[i] = 1
+	}
+	for _, i := range []int{10, 90, 170} {
+		confidence[i/2] = 0
+	}
+	if metric, err = DecodeSoft(corrupt, confidence, test); err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if !bytes.Equal(test, want) {
+		t.Fatalf("decode failed: expected %x, got %x", want, test)
+	}
+	if metric != 0 {
+		t.Fatalf("decode failed: expected path metric 0 for erasures, got %f", metric)
+	}
+}
+
+func TestViterbiErrors(t *testing.T) {
+	var want = make([]byte, 18)
+	for i := range want {
+		want[i] = byte(i*53 + 11)
+	}
+	var bits = make([]byte, dmr.InfoBits)
+	if err := Encode(want, bits); err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+
+	// Each corrected bit error adds one to the path metric
+	var (
+		corrupt = make([]byte, len(bits))
+		test    = make([]byte, 18)
+	)
+	copy(corrupt, bits)
+	for n, i := range []int{6, 60, 120, 180} {
+		corrupt[i] ^= 1
+		metric, err := DecodeViterbi(corrupt, test)
+		if err != nil {
+			t.Fatalf("decode failed: %v", err)
+		}
+		if metric != float64(n+1) {
+			t.Fatalf("decode failed: expected path metric %d, got %f", n+1, metric)
+		}
+		if !bytes.Equal(test, want) {
+			t.Fatalf("decode failed: expected %x, got %x", want, test)
+		}
+		if err = Decode(corrupt, test); err != nil {
+			t.Fatalf("decode failed: %v", err)
+		}
+	}
+
+	// Random Info bits exceed the path metric threshold
+	var r = rand.New(rand.NewSource(1))
+	for n := 0; n < 100; n++ {
+		for i := range corrupt {
+			corrupt[i] = byte(r.Intn(2))
+		}
+		metric, err := DecodeViterbi(corrupt, test)
+		if err != nil {
+			t.Fatalf("decode failed: %v", err)
+		}
+		if metric <= MaxPathMetric {
+			t.Fatalf("decode failed: expected path metric above %f for random bits, got %f", MaxPathMetric, metric)
+		}
+		if err = Decode(corrupt, test); err == nil {
+			t.Fatal("decode of random bits did not fail")
+		}
+	}
+}
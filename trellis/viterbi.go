@@ -0,0 +1,141 @@
+package trellis
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/pd0mz/go-dmr"
+)
+
+// MaxPathMetric is the highest path metric Decode accepts. Random Info bits
+// decode with a path metric of 8 or more, a block with more symbol errors is
+// reported as corrupted. Blocks below the threshold may still be decoded
+// wrongly, callers should verify the CRC of the decoded data.
+var MaxPathMetric = 6.0
+
+// DecodeViterbi decodes 196 Info bits to 18 bytes (144 bits) binary using a
+// hard-decision Viterbi decoder. It returns the path metric of the decoded
+// data, which is the number of Info bits that were corrected. No error is
+// returned for corrupted data, callers should check the path metric.
+func DecodeViterbi(bits []byte, bytes []byte) (float64, error) {
+	var confidence = make([]float64, 98)
+	for i := range confidence {
+		confidence[i] = 1
+	}
+	return DecodeSoft(bits, confidence, bytes)
+}
+
+// DecodeSoft decodes 196 Info bits to 18 bytes (144 bits) binary using a
+// soft-decision Viterbi decoder. The confidence contains a weight for each of
+// the 98 dibits in the order they were received, where 0 means the dibit is
+// unknown (erased) and 1 means the dibit is certain. It returns the path
+// metric of the decoded data, the sum of the confidences of the corrected bits.
+func DecodeSoft(bits []byte, confidence []float64, bytes []byte) (float64, error) {
+	if bytes == nil {
+		return 0, errors.New("trellis: bytes can't be nil")
+	}
+	if len(bytes) < 18 {
+		return 0, fmt.Errorf("trellis: need buffer of at least 18 bytes, got %d", len(bytes))
+	}
+	if len(confidence) != 98 {
+		return 0, fmt.Errorf("trellis: expected 98 dibit confidences, got %d", len(confidence))
+	}
+
+	dibits, err := ExtractDibits(bits)
+	if err != nil {
+		return 0, err
+	}
+	deinterleaved, err := Deinterleave(dibits)
+	if err != nil {
+		return 0, err
+	}
+	var weights = make([]float64, 98)
+	for i := 0; i < 98; i++ {
+		weights[interleaveMatrix[i]] = confidence[i]
+	}
+
+	tribits, metric := viterbi(deinterleaved, weights)
+	binary, err := ExtractBinary(tribits[:48])
+	if err != nil {
+		return 0, err
+	}
+	copy(bytes, dmr.BitsToBytes(binary))
+	return metric, nil
+}
+
+// dibitBits maps a dibit symbol to its two bits, see ExtractDibits.
+func dibitBits(dibit int8) uint8 {
+	switch dibit {
+	case +3:
+		return 1
+	case +1:
+		return 0
+	case -1:
+		return 2
+	default:
+		return 3
+	}
+}
+
+// branchMetric is the weighted number of bits in the received dibits that
+// differ from the dibits of a constellation point.
+func branchMetric(dibits []int8, weights []float64, point uint8) float64 {
+	var metric float64
+	for i := 0; i < 2; i++ {
+		switch dibitBits(dibits[i]) ^ dibitBits(constellationDibits[point][i]) {
+		case 1, 2:
+			metric += weights[i]
+		case 3:
+			metric += 2 * weights[i]
+		}
+	}
+	return metric
+}
+
+// viterbi finds the most likely sequence of 49 tribits for the 98
+// deinterleaved dibits. The encoder state is the previous tribit, it starts
+// and ends (after the flushing tribit) in state 0.
+func viterbi(dibits []int8, weights []float64) ([]uint8, float64) {
+	const states = 8
+	var (
+		steps    = len(dibits) / 2
+		metrics  [states]float64
+		previous = make([][states]uint8, steps)
+	)
+	for s := 1; s < states; s++ {
+		metrics[s] = math.Inf(1)
+	}
+
+	for i := 0; i < steps; i++ {
+		var next [states]float64
+		for s := range next {
+			next[s] = math.Inf(1)
+		}
+		for s := 0; s < states; s++ {
+			if math.IsInf(metrics[s], 1) {
+				continue
+			}
+			for t := 0; t < states; t++ {
+				point := encoderStateTransition[s*8+t]
+				m := metrics[s] + branchMetric(dibits[i*2:], weights[i*2:], point)
+				if m < next[t] {
+					next[t] = m
+					previous[i][t] = uint8(s)
+				}
+			}
+		}
+		metrics = next
+	}
+
+	// Trace back from the final state, the tribit is the state it leads to
+	var (
+		tribits = make([]uint8, steps)
+		state   uint8
+	)
+	for i := steps - 1; i >= 0; i-- {
+		tribits[i] = state
+		state = previous[i][state]
+	}
+	return tribits, metrics[0]
+}
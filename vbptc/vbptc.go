@@ -146,6 +146,70 @@ func (v *VBPTC) GetData(bits []byte) error {
 	return nil
 }
 
+// SetData places the data bits in the vbptc matrix and adds the Hamming
+// (16,11) and parity check bits, the cursor is reset so the matrix can be read
+// with GetBurst.
+func (v *VBPTC) SetData(bits []byte) error {
+	if v.matrix == nil || v.expectedRows < 2 {
+		return errors.New("vbptc: matrix can't be nil")
+	}
+	if bits == nil {
+		return errors.New("vbptc: bits can't be nil")
+	}
+	var size = (int(v.expectedRows) - 1) * 11
+	if len(bits) < size {
+		return fmt.Errorf("vbptc: need at least %d bits, got %d", size, len(bits))
+	}
+
+	var (
+		row, col uint8
+		errs     = make([]byte, 5)
+	)
+	for row = 0; row < v.expectedRows-1; row++ {
+		copy(v.matrix[row*16:row*16+11], bits[int(row)*11:])
+		getParity(v.matrix[row*16:], errs)
+		copy(v.matrix[row*16+11:row*16+16], errs)
+	}
+
+	// The last row contains the single parity check bits
+	for col = 0; col < 16; col++ {
+		var parity uint8
+		for row = 0; row < v.expectedRows-1; row++ {
+			parity ^= v.matrix[row*16+col]
+		}
+		v.matrix[(v.expectedRows-1)*16+col] = parity
+	}
+
+	v.row = 0
+	v.col = 0
+	return nil
+}
+
+// GetBurst reads the next embedded signalling data from the matrix.
+func (v *VBPTC) GetBurst(bits []byte) error {
+	if v.matrix == nil {
+		return errors.New("vbptc: matrix can't be nil")
+	}
+	if bits == nil {
+		return errors.New("vbptc: bits can't be nil")
+	}
+	var free = v.freeSpace()
+	if len(bits) > free {
+		return fmt.Errorf("vbptc: %d bits left in matrix, need %d", free, len(bits))
+	}
+
+	for i := range bits {
+		bits[i] = v.matrix[v.col+v.row*16]
+		v.row++
+		if v.row == v.expectedRows {
+			v.col++
+			v.row = 0
+		}
+	}
+
+	return nil
+}
+
 func checkRow(bits, errs []byte) bool {
 	if bits == nil || errs == nil {
 		return false
@@ -193,3 +257,65 @@ func getParity(bits, errs []byte) {
 	errs[3] = (bits[0] ^ bits[1] ^ bits[2] ^ bits[4] ^ bits[6] ^ bits[7] ^ bits[10])
 	errs[4] = (bits[0] ^ bits[2] ^ bits[5] ^ bits[6] ^ bits[8] ^ bits[9] ^ bits[10])
 }
+
+// EncodeSingleBurst encodes the 11 information bits with the single burst
+// variable length BPTC, as used for the reverse channel. The first row is a
+// Hamming (16,11) codeword, the second row contains the odd parity of each
+// column. The returned 32 bits are interleaved for transmission.
+//
+// ref: ETSI TS 102 361-1 B.2.2
+func EncodeSingleBurst(info []byte) ([]byte, error) {
+	if len(info) != 11 {
+		return nil, fmt.Errorf("vbptc: expected 11 info bits, got %d", len(info))
+	}
+
+	var (
+		matrix = make([]byte, 32)
+		bits   = make([]byte, 32)
+	)
+	copy(matrix, info)
+	getParity(matrix, matrix[11:16])
+	for col := 0; col < 16; col++ {
+		matrix[16+col] = matrix[col] ^ 1
+	}
+
+	for i, b := range matrix {
+		bits[(i*17)%32] = b
+	}
+	return bits, nil
+}
+
+// DecodeSingleBurst decodes the single burst variable length BPTC, a single
+// bit error in the Hamming (16,11) row is repaired.
+func DecodeSingleBurst(bits []byte) ([]byte, error) {
+	if len(bits) != 32 {
+		return nil, fmt.Errorf("vbptc: expected 32 bits, got %d", len(bits))
+	}
+
+	var (
+		matrix = make([]byte, 32)
+		errs   = make([]byte, 5)
+	)
+	for i := range matrix {
+		matrix[i] = bits[(i*17)%32]
+	}
+
+	if !checkRow(matrix, errs) {
+		pos, found := findPosition(errs)
+		if !found {
+			return nil, errors.New("vbptc: hamming(16,11) check error, can't repair single burst")
+		}
+		matrix[pos] ^= 1
+		if !checkRow(matrix, errs) {
+			return nil, errors.New("vbptc: hamming(16,11) check error, couldn't repair single burst")
+		}
+	}
+
+	for col := 0; col < 16; col++ {
+		if matrix[col]^matrix[16+col] != 1 {
+			return nil, fmt.Errorf("vbptc: parity check error in column #%d", col)
+		}
+	}
+
+	return matrix[:11], nil
+}
@@ -88,6 +88,31 @@ type EmbeddedSignallingLC struct {
 	Checksum []byte
 }
 
+// NewEmbeddedSignallingLC builds the embedded signalling LC from the 9 LC
+// bytes and calculates the 5-bit checksum.
+func NewEmbeddedSignallingLC(data []byte) (*EmbeddedSignallingLC, error) {
+	if len(data) != 9 {
+		return nil, fmt.Errorf("dmr/emb lc: expected 9 bytes, got %d", len(data))
+	}
+
+	var verify uint16
+	for _, b := range data {
+		verify += uint16(b)
+	}
+
+	var (
+		checksum = uint8(verify % 31)
+		eslc     = &EmbeddedSignallingLC{
+			Bits:     BytesToBits(data),
+			Checksum: make([]byte, 5),
+		}
+	)
+	for i := range eslc.Checksum {
+		eslc.Checksum[i] = (checksum >> uint(4-i)) & 1
+	}
+	return eslc, nil
+}
+
 // Check verifies the checksum in the embedded signalling LC.
 func (eslc *EmbeddedSignallingLC) Check() bool {
 	var checksum uint8